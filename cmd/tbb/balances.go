@@ -7,6 +7,8 @@ import (
 	"os"
 )
 
+const flagAsset = "asset"
+
 func balancesCmd() *cobra.Command {
 	var balancesCmd = &cobra.Command{
 		Use:   "balances",
@@ -28,24 +30,43 @@ func balancesListCmd() *cobra.Command {
 		Use:   "list",
 		Short: "Lists all balances.",
 		Run: func(cmd *cobra.Command, args []string) {
-			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
+			asset, _ := cmd.Flags().GetString(flagAsset)
+
+			state, err := database.NewStateFromDiskReadOnly(getDataDirFromCmd(cmd))
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
 			}
 			defer state.Close()
 
-			fmt.Printf("Accounts balances at %x:\n", state.LatestBlockHash())
+			balances := state.BalancesOf(database.AssetID(asset))
+			if balances == nil {
+				fmt.Fprintf(os.Stderr, "asset '%s' doesn't exist\n", asset)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Accounts %s balances at %x:\n", asset, state.LatestBlockHash())
 			fmt.Println("____________________")
 			fmt.Println("")
-			for account, balance := range state.Balances {
-				fmt.Println(fmt.Sprintf("%s: %d", account, balance))
+			for account, balance := range balances {
+				fmt.Println(fmt.Sprintf("%s: %s %s", account, balance.Format(database.DenominationTBB), asset))
+			}
+
+			if asset != string(database.NativeAsset) {
+				return
+			}
+
+			for account, locked := range state.LockedBalances() {
+				if locked > 0 {
+					fmt.Println(fmt.Sprintf("%s: %s locked by vesting", account, locked))
+				}
 			}
 
 		},
 	}
 
 	addDefaultFlags(balancesListCmd)
+	balancesListCmd.Flags().String(flagAsset, string(database.NativeAsset), "asset to list the balances of")
 
 	return balancesListCmd
 }
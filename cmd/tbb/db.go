@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jsrhodes15/the-blockchain-bar/database"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+func dbCmd() *cobra.Command {
+	var dbCmd = &cobra.Command{
+		Use:   "db",
+		Short: "Manage the blockchain database (upgrade, import, export, backup...).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	dbCmd.AddCommand(dbUpgradeCmd())
+	dbCmd.AddCommand(dbImportCmd())
+	dbCmd.AddCommand(dbExportCmd())
+	dbCmd.AddCommand(dbImportChainCmd())
+	dbCmd.AddCommand(dbBackupCmd())
+	dbCmd.AddCommand(dbRestoreCmd())
+
+	return dbCmd
+}
+
+func dbUpgradeCmd() *cobra.Command {
+	var dbUpgradeCmd = &cobra.Command{
+		Use:   "upgrade",
+		Short: "Rewrites an older on-disk database format into the current one.",
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+
+			fromVersion, err := database.UpgradeDataDir(dataDir)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if fromVersion == database.DbVersion {
+				fmt.Printf("Database in '%s' is already at format version %d.\n", dataDir, database.DbVersion)
+				return
+			}
+
+			fmt.Printf("Database in '%s' upgraded from format version %d to %d.\n", dataDir, fromVersion, database.DbVersion)
+		},
+	}
+
+	addDefaultFlags(dbUpgradeCmd)
+
+	return dbUpgradeCmd
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jsrhodes15/the-blockchain-bar/database"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+const flagForce = "force"
+
+func dbBackupCmd() *cobra.Command {
+	var dbBackupCmd = &cobra.Command{
+		Use:   "backup <dest>",
+		Short: "Writes a consistent, checksummed archive of the database, even while a node is running.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dest := args[0]
+
+			f, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			manifest, err := database.Backup(getDataDirFromCmd(cmd), f)
+			if err == nil {
+				err = f.Sync()
+			}
+			f.Close()
+			if err != nil {
+				os.Remove(dest)
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Backed up %d files to '%s':\n", len(manifest.Files), dest)
+			for _, file := range manifest.Files {
+				fmt.Printf("\t%s %s (%d bytes)\n", file.SHA256, file.Name, file.Size)
+			}
+		},
+	}
+
+	addDefaultFlags(dbBackupCmd)
+
+	return dbBackupCmd
+}
+
+func dbRestoreCmd() *cobra.Command {
+	var dbRestoreCmd = &cobra.Command{
+		Use:   "restore <archive>",
+		Short: "Verifies a backup archive and installs it into the data directory.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+			force, _ := cmd.Flags().GetBool(flagForce)
+
+			manifest, err := database.Restore(args[0], dataDir, force)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Restored %d verified files into '%s'.\n", len(manifest.Files), dataDir)
+
+			if manifest.DbVersion < database.DbVersion {
+				fmt.Printf("The backup uses the outdated format version %d, run 'tbb db upgrade --datadir=%s' before using it.\n", manifest.DbVersion, dataDir)
+			}
+		},
+	}
+
+	addDefaultFlags(dbRestoreCmd)
+	dbRestoreCmd.Flags().Bool(flagForce, false, "replace an existing database, the replaced one is kept aside as 'database.replaced-<unix time>'")
+
+	return dbRestoreCmd
+}
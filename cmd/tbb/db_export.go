@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/jsrhodes15/the-blockchain-bar/database"
+	"github.com/spf13/cobra"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+)
+
+const flagFromBlock = "from"
+const flagToBlock = "to"
+const flagOut = "out"
+const flagGenesis = "genesis"
+
+const exportFormatJsonl = "jsonl"
+const exportFormatCsv = "csv"
+const exportFormatNdjsonGz = "ndjson-gz"
+
+var exportCsvHeader = []string{"block_number", "block_hash", "parent_hash", "block_time", "tx_index", "from", "to", "value", "data", "type", "asset"}
+
+func dbExportCmd() *cobra.Command {
+	var dbExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Exports a consistent copy of the blockchain as blocks (jsonl, ndjson-gz) or flattened TXs (csv).",
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString(flagFormat)
+			from, _ := cmd.Flags().GetUint64(flagFromBlock)
+			to, _ := cmd.Flags().GetUint64(flagToBlock)
+			out, _ := cmd.Flags().GetString(flagOut)
+
+			if from > to {
+				fmt.Fprintf(os.Stderr, "--%s must not be greater than --%s\n", flagFromBlock, flagToBlock)
+				os.Exit(1)
+			}
+
+			var w io.Writer = os.Stdout
+			if out != "" && out != "-" {
+				f, err := os.OpenFile(out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				defer f.Close()
+
+				w = f
+			}
+
+			count, err := exportChain(getDataDirFromCmd(cmd), w, format, from, to)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if w != os.Stdout {
+				fmt.Printf("Exported %d blocks to '%s'.\n", count, out)
+			}
+		},
+	}
+
+	addDefaultFlags(dbExportCmd)
+	dbExportCmd.Flags().String(flagFormat, exportFormatJsonl, "export format: jsonl, csv or ndjson-gz")
+	dbExportCmd.Flags().Uint64(flagFromBlock, 0, "number of the first exported block")
+	dbExportCmd.Flags().Uint64(flagToBlock, math.MaxUint64, "number of the last exported block")
+	dbExportCmd.Flags().String(flagOut, "-", "file to write the export to (default: stdout)")
+
+	return dbExportCmd
+}
+
+func dbImportChainCmd() *cobra.Command {
+	var dbImportChainCmd = &cobra.Command{
+		Use:   "import-chain <file>",
+		Short: "Validates a jsonl or ndjson-gz chain export and rebuilds a data directory from it.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			dataDir := getDataDirFromCmd(cmd)
+			genesisPath, _ := cmd.Flags().GetString(flagGenesis)
+
+			var genesisContent []byte
+			if genesisPath != "" {
+				var err error
+				genesisContent, err = ioutil.ReadFile(genesisPath)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			count := 0
+			latestBlockHash := database.Hash{}
+			err := database.RebuildDataDir(dataDir, genesisContent, func(state *database.State) error {
+				var err error
+				count, err = importChain(args[0], state)
+				latestBlockHash = state.LatestBlockHash()
+
+				return err
+			})
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Imported %d blocks into '%s', latest block is %x.\n", count, dataDir, latestBlockHash)
+		},
+	}
+
+	addDefaultFlags(dbImportChainCmd)
+	dbImportChainCmd.Flags().String(flagGenesis, "", "genesis.json to initialize the new data directory with (default: the built-in genesis)")
+
+	return dbImportChainCmd
+}
+
+func exportChain(dataDir string, w io.Writer, format string, from uint64, to uint64) (int, error) {
+	var write func(blockFs database.BlockFS) error
+	var flush func() error
+
+	switch format {
+	case exportFormatJsonl, exportFormatNdjsonGz:
+		var gz *gzip.Writer
+		if format == exportFormatNdjsonGz {
+			gz = gzip.NewWriter(w)
+			w = gz
+		}
+
+		buffered := bufio.NewWriter(w)
+		encoder := json.NewEncoder(buffered)
+
+		write = func(blockFs database.BlockFS) error {
+			return encoder.Encode(blockFs)
+		}
+		flush = func() error {
+			err := buffered.Flush()
+			if err != nil || gz == nil {
+				return err
+			}
+
+			return gz.Close()
+		}
+	case exportFormatCsv:
+		csvWriter := csv.NewWriter(w)
+
+		err := csvWriter.Write(exportCsvHeader)
+		if err != nil {
+			return 0, err
+		}
+
+		write = func(blockFs database.BlockFS) error {
+			header := blockFs.Value.Header
+
+			for i, tx := range blockFs.Value.TXs {
+				err := csvWriter.Write([]string{
+					strconv.FormatUint(header.Number, 10),
+					blockFs.Key.Hex(),
+					header.Parent.Hex(),
+					strconv.FormatUint(header.Time, 10),
+					strconv.Itoa(i),
+					string(tx.From),
+					string(tx.To),
+					tx.Value.Format(database.DenominationTBB),
+					tx.Data,
+					string(tx.Type),
+					string(tx.AssetID()),
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+		flush = func() error {
+			csvWriter.Flush()
+
+			return csvWriter.Error()
+		}
+	default:
+		return 0, fmt.Errorf("unsupported export format '%s', use jsonl, csv or ndjson-gz", format)
+	}
+
+	count := 0
+	err := database.ForEachBlock(dataDir, func(blockFs database.BlockFS) error {
+		number := blockFs.Value.Header.Number
+		if number < from || number > to {
+			return nil
+		}
+
+		count++
+
+		return write(blockFs)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, flush()
+}
+
+func importChain(path string, state *database.State) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+
+	// ndjson-gz exports are recognized by the gzip magic number
+	magic, err := reader.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+
+		reader = bufio.NewReader(gz)
+	}
+
+	count := 0
+	decoder := json.NewDecoder(reader)
+	for {
+		var blockFs database.BlockFS
+		err := decoder.Decode(&blockFs)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("unable to read block #%d of the export, only jsonl and ndjson-gz exports can be imported. %s", count, err.Error())
+		}
+
+		number := blockFs.Value.Header.Number
+		// The first block of a chain may be numbered 0 or 1, every other one follows the latest block
+		if !state.LatestBlockHash().IsEmpty() && number != state.NextBlockNumber() {
+			return count, fmt.Errorf("export block '%x' is number %d, the data directory expects block %d next", blockFs.Key, number, state.NextBlockNumber())
+		}
+
+		hash, err := blockFs.Value.Hash()
+		if err != nil {
+			return count, err
+		}
+
+		if hash != blockFs.Key {
+			return count, fmt.Errorf("block %d hash is '%x' but the export claims '%x'", number, hash, blockFs.Key)
+		}
+
+		_, err = state.AddBlock(blockFs.Value)
+		if err != nil {
+			return count, fmt.Errorf("invalid block %d. %s", number, err.Error())
+		}
+
+		count++
+	}
+}
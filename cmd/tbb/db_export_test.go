@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/jsrhodes15/the-blockchain-bar/database"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestDataDir(t *testing.T) string {
+	t.Helper()
+
+	dataDir, err := ioutil.TempDir("", "tbb-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dataDir) })
+
+	return dataDir
+}
+
+// newTestChain returns a data dir holding a chain of three blocks.
+func newTestChain(t *testing.T) string {
+	t.Helper()
+
+	dataDir := newTestDataDir(t)
+	state, err := database.NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	blocks := [][]database.Tx{
+		{database.NewTx("jrhodes", "meads", database.NewAmount(2000), ""), database.NewTx("jrhodes", "jrhodes", database.NewAmount(100), "reward")},
+		{database.NewTx("meads", "lhendricks", database.NewAmount(1000), "")},
+		{database.NewTx("lhendricks", "babayaga", database.NewAmount(10), "rum")},
+	}
+
+	for i, txs := range blocks {
+		_, err = state.AddBlock(database.NewBlock(state.LatestBlockHash(), state.NextBlockNumber(), 1600000000+15*uint64(i), txs))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dataDir
+}
+
+func exportTestChain(t *testing.T, dataDir string, format string, from uint64, to uint64) ([]byte, int) {
+	t.Helper()
+
+	var export bytes.Buffer
+	count, err := exportChain(dataDir, &export, format, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return export.Bytes(), count
+}
+
+func TestExportImportChainRoundTrip(t *testing.T) {
+	dataDir := newTestChain(t)
+
+	for _, format := range []string{exportFormatJsonl, exportFormatNdjsonGz} {
+		export, count := exportTestChain(t, dataDir, format, 0, ^uint64(0))
+		if count != 3 {
+			t.Errorf("%s: exported %d blocks, expected 3", format, count)
+		}
+
+		exportPath := filepath.Join(newTestDataDir(t), "chain."+format)
+		err := ioutil.WriteFile(exportPath, export, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		importDir := newTestDataDir(t)
+		state, err := database.NewStateFromDisk(importDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count, err = importChain(exportPath, state)
+		state.Close()
+		if err != nil {
+			t.Errorf("%s: importing the export failed: %s", format, err)
+			continue
+		}
+
+		if count != 3 {
+			t.Errorf("%s: imported %d blocks, expected 3", format, count)
+		}
+
+		original, err := ioutil.ReadFile(filepath.Join(dataDir, "database", "block.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		imported, err := ioutil.ReadFile(filepath.Join(importDir, "database", "block.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(original, imported) {
+			t.Errorf("%s: the rebuilt block.db doesn't match the exported one", format)
+		}
+	}
+}
+
+func TestExportBlockRange(t *testing.T) {
+	dataDir := newTestChain(t)
+
+	tests := []struct {
+		from     uint64
+		to       uint64
+		expected int
+	}{
+		{0, ^uint64(0), 3},
+		{1, ^uint64(0), 2},
+		{0, 0, 1},
+		{1, 1, 1},
+		{5, 10, 0},
+	}
+
+	for _, test := range tests {
+		export, count := exportTestChain(t, dataDir, exportFormatJsonl, test.from, test.to)
+		if count != test.expected || strings.Count(string(export), "\n") != test.expected {
+			t.Errorf("exporting blocks %d to %d exported %d blocks, expected %d", test.from, test.to, count, test.expected)
+		}
+	}
+}
+
+func TestExportCsv(t *testing.T) {
+	dataDir := newTestChain(t)
+
+	export, count := exportTestChain(t, dataDir, exportFormatCsv, 1, ^uint64(0))
+	if count != 2 {
+		t.Errorf("exported %d blocks, expected 2", count)
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(export)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3 || strings.Join(records[0], ",") != strings.Join(exportCsvHeader, ",") {
+		t.Fatalf("exported %v, expected the header and one row per TX", records)
+	}
+
+	expected := [][]string{
+		{"1", "0", "meads", "lhendricks", "1000", ""},
+		{"2", "0", "lhendricks", "babayaga", "10", "rum"},
+	}
+	for i, record := range records[1:] {
+		row := []string{record[0], record[4], record[5], record[6], record[7], record[8]}
+		if strings.Join(row, ",") != strings.Join(expected[i], ",") {
+			t.Errorf("row %d is %v, expected %v", i, row, expected[i])
+		}
+	}
+
+	_, err = exportChain(dataDir, ioutil.Discard, "xml", 0, 1)
+	if err == nil || !strings.Contains(err.Error(), "unsupported export format 'xml'") {
+		t.Errorf("expected an unsupported format to be refused, got '%v'", err)
+	}
+}
+
+func TestImportChainRejectsInvalidExports(t *testing.T) {
+	dataDir := newTestChain(t)
+	export, _ := exportTestChain(t, dataDir, exportFormatJsonl, 0, ^uint64(0))
+	lines := strings.SplitAfter(string(export), "\n")
+	csvExport, _ := exportTestChain(t, dataDir, exportFormatCsv, 0, ^uint64(0))
+
+	overspending := database.NewBlock(database.Hash{}, 0, 1600000000, []database.Tx{database.NewTx("meads", "jrhodes", database.NewAmount(1), "")})
+	overspendingHash, err := overspending.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	overspendingJson, err := json.Marshal(database.BlockFS{Key: overspendingHash, Value: overspending})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		export string
+		err    string
+	}{
+		{"missing block", lines[0] + lines[2], "is number 2, the data directory expects block 1 next"},
+		{"tampered block", lines[0] + strings.Replace(lines[1], `"value":1000`, `"value":1001`, 1), "block 1 hash is"},
+		{"invalid block", string(overspendingJson) + "\n", "invalid block 0"},
+		{"csv export", string(csvExport), "only jsonl and ndjson-gz exports can be imported"},
+	}
+
+	for _, test := range tests {
+		exportPath := filepath.Join(newTestDataDir(t), "chain.jsonl")
+		err := ioutil.WriteFile(exportPath, []byte(test.export), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state, err := database.NewStateFromDisk(newTestDataDir(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = importChain(exportPath, state)
+		state.Close()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+	}
+}
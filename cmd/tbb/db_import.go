@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/jsrhodes15/the-blockchain-bar/database"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const flagFormat = "format"
+const flagDryRun = "dry-run"
+
+const importFormatJson = "json"
+const importFormatYaml = "yaml"
+const importFormatCsv = "csv"
+
+// importEntry is either a single TX or, when it carries 'txs', a whole block of TXs.
+//
+// Consecutive TX entries are imported together as one block.
+type importEntry struct {
+	From  string          `json:"from" yaml:"from"`
+	To    string          `json:"to" yaml:"to"`
+	Value database.Amount `json:"value" yaml:"value"`
+	Data  string          `json:"data" yaml:"data"`
+	Type  string          `json:"type" yaml:"type"`
+	Asset string          `json:"asset" yaml:"asset"`
+	Time  uint64          `json:"time" yaml:"time"`
+	TXs   []importEntry   `json:"txs" yaml:"txs"`
+}
+
+func (e importEntry) isBlock() bool {
+	return len(e.TXs) > 0
+}
+
+func (e importEntry) tx() database.Tx {
+	tx := database.NewAssetTx(database.NewAccount(e.From), database.NewAccount(e.To), e.Value, database.AssetID(e.Asset), e.Data)
+	tx.Type = database.TxType(e.Type)
+
+	return tx
+}
+
+type importBlock struct {
+	time uint64
+	txs  []database.Tx
+	// grouped blocks gather TXs listed on their own and may be split to respect the block limits
+	grouped bool
+}
+
+func dbImportCmd() *cobra.Command {
+	var dbImportCmd = &cobra.Command{
+		Use:   "import <file>",
+		Short: "Appends the TXs or blocks listed in a JSON, YAML or CSV file to the blockchain.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			format, _ := cmd.Flags().GetString(flagFormat)
+			dryRun, _ := cmd.Flags().GetBool(flagDryRun)
+			signer, _ := cmd.Flags().GetString(flagSigner)
+			signerKeyPath, _ := cmd.Flags().GetString(flagSignerKey)
+
+			blocks, err := readImportFile(args[0], format)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			key := database.SealKey{Account: database.NewAccount(signer)}
+			if signerKeyPath != "" {
+				key.PrivateKey, err = readKeyFile(signerKeyPath)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			// A dry run doesn't write anything, so it doesn't need to wait for a running node
+			newState := database.NewStateFromDisk
+			if dryRun {
+				newState = database.NewStateFromDiskReadOnly
+			}
+
+			state, err := newState(getDataDirFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			target := state
+			if dryRun {
+				target = state.DryRun()
+			}
+
+			blocks = splitImportBlocks(blocks, target.Limits().MaxBlockTxs)
+
+			txsCount, err := importBlocks(target, blocks, key)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			if !dryRun {
+				fmt.Printf("Imported %d blocks with %d TXs, latest block is %x.\n", len(blocks), txsCount, target.LatestBlockHash())
+				return
+			}
+
+			fmt.Printf("Dry run: %d blocks with %d TXs would be imported, resulting balances at %x:\n", len(blocks), txsCount, target.LatestBlockHash())
+			fmt.Println("____________________")
+			fmt.Println("")
+
+			accounts := make([]string, 0, len(target.Balances))
+			for account := range target.Balances {
+				accounts = append(accounts, string(account))
+			}
+			sort.Strings(accounts)
+
+			for _, account := range accounts {
+				fmt.Println(fmt.Sprintf("%s: %s", account, target.Balances[database.NewAccount(account)]))
+			}
+		},
+	}
+
+	addDefaultFlags(dbImportCmd)
+	dbImportCmd.Flags().String(flagFormat, "", "file format: json, yaml or csv (default: detected from the file extension)")
+	dbImportCmd.Flags().Bool(flagDryRun, false, "validate the import and report the resulting balances without persisting anything")
+	dbImportCmd.Flags().String(flagSigner, "", "PoA signer, PoS validator or PoW miner account the imported blocks are sealed as")
+	dbImportCmd.Flags().String(flagSignerKey, "", "key file of the signer or validator")
+
+	return dbImportCmd
+}
+
+// importBlocks seals the blocks through the consensus of the State, as a node produces them, and adds them.
+// It returns how many TXs were imported.
+func importBlocks(state *database.State, blocks []importBlock, key database.SealKey) (int, error) {
+	consensus := state.ConsensusAt(state.NextBlockNumber())
+	if consensus.Name() != database.ConsensusInstantSeal && key.Account == "" {
+		return 0, fmt.Errorf("the data directory runs the '%s' consensus, pass --%s and --%s to seal the imported blocks", consensus.Name(), flagSigner, flagSignerKey)
+	}
+
+	txsCount := 0
+	for _, ib := range blocks {
+		blockTime := ib.time
+		if blockTime == 0 {
+			blockTime = state.NextBlockTime()
+		}
+
+		block := database.NewBlock(state.LatestBlockHash(), state.NextBlockNumber(), blockTime, ib.txs)
+
+		consensus = state.ConsensusAt(block.Header.Number)
+		err := consensus.Prepare(&block.Header, state)
+		if err == nil {
+			block, err = consensus.Seal(block, state, key)
+		}
+		if err == nil {
+			_, err = state.AddBlock(block)
+		}
+		if err != nil {
+			return txsCount, fmt.Errorf("unable to import block %d. %s", block.Header.Number, err.Error())
+		}
+
+		txsCount += len(ib.txs)
+	}
+
+	return txsCount, nil
+}
+
+func readImportFile(path string, format string) ([]importBlock, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch format {
+	case importFormatJson, importFormatYaml, "yml":
+		content, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+
+		var entries []importEntry
+		if format == importFormatJson {
+			err = json.Unmarshal(content, &entries)
+		} else {
+			err = yaml.UnmarshalStrict(content, &entries)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse import file '%s'. %s", path, err.Error())
+		}
+
+		return groupImportEntries(entries)
+	case importFormatCsv:
+		return readImportCsv(f)
+	}
+
+	return nil, fmt.Errorf("unsupported import format '%s', use json, yaml or csv", format)
+}
+
+func groupImportEntries(entries []importEntry) ([]importBlock, error) {
+	blocks := make([]importBlock, 0)
+	pending := make([]database.Tx, 0)
+
+	for _, e := range entries {
+		if !e.isBlock() {
+			pending = append(pending, e.tx())
+			continue
+		}
+
+		if len(pending) > 0 {
+			blocks = append(blocks, importBlock{0, pending, true})
+			pending = make([]database.Tx, 0)
+		}
+
+		txs := make([]database.Tx, 0, len(e.TXs))
+		for _, blockTx := range e.TXs {
+			if blockTx.isBlock() {
+				return nil, fmt.Errorf("blocks can't be nested inside of other blocks")
+			}
+
+			txs = append(txs, blockTx.tx())
+		}
+
+		blocks = append(blocks, importBlock{e.Time, txs, false})
+	}
+
+	if len(pending) > 0 {
+		blocks = append(blocks, importBlock{0, pending, true})
+	}
+
+	return blocks, nil
+}
+
+// readImportCsv reads TXs with a "from,to,value[,data][,type][,asset][,block]" header.
+//
+// Consecutive rows sharing the same 'block' label are imported as one block.
+func readImportCsv(r io.Reader) ([]importBlock, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CSV header. %s", err.Error())
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	for _, required := range []string{"from", "to", "value"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the '%s' column", required)
+		}
+	}
+
+	column := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	blocks := make([]importBlock, 0)
+	currentLabel := ""
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := database.ParseAmount(column(record, "value"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value on CSV line %d. %s", line, err.Error())
+		}
+
+		tx := database.NewAssetTx(
+			database.NewAccount(column(record, "from")),
+			database.NewAccount(column(record, "to")),
+			value,
+			database.AssetID(column(record, "asset")),
+			column(record, "data"),
+		)
+		tx.Type = database.TxType(column(record, "type"))
+
+		label := column(record, "block")
+		if len(blocks) == 0 || label != currentLabel {
+			blocks = append(blocks, importBlock{0, make([]database.Tx, 0), label == ""})
+			currentLabel = label
+		}
+
+		blocks[len(blocks)-1].txs = append(blocks[len(blocks)-1].txs, tx)
+	}
+
+	return blocks, nil
+}
+
+func splitImportBlocks(blocks []importBlock, maxBlockTxs uint64) []importBlock {
+	split := make([]importBlock, 0, len(blocks))
+
+	for _, ib := range blocks {
+		for ib.grouped && uint64(len(ib.txs)) > maxBlockTxs {
+			split = append(split, importBlock{ib.time, ib.txs[:maxBlockTxs], true})
+			ib.txs = ib.txs[maxBlockTxs:]
+		}
+
+		split = append(split, ib)
+	}
+
+	return split
+}
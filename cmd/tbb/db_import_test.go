@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/jsrhodes15/the-blockchain-bar/database"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeImportFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "tbb-import-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestReadImportFile(t *testing.T) {
+	tx := func(from string, to string, value uint64, data string) database.Tx {
+		return database.NewTx(database.NewAccount(from), database.NewAccount(to), database.NewAmount(value), data)
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		format   string
+		content  string
+		expected []importBlock
+	}{
+		{
+			"consecutive JSON TXs make one block", "seed.json", "",
+			`[{"from": "jrhodes", "to": "meads", "value": 2000}, {"from": "jrhodes", "to": "jrhodes", "value": 100, "data": "reward"}]`,
+			[]importBlock{{0, []database.Tx{tx("jrhodes", "meads", 2000, ""), tx("jrhodes", "jrhodes", 100, "reward")}, true}},
+		},
+		{
+			"JSON blocks keep their time", "seed.json", "",
+			`[{"from": "jrhodes", "to": "meads", "value": 1}, {"time": 1600000000, "txs": [{"from": "meads", "to": "lhendricks", "value": 1}]}, {"from": "jrhodes", "to": "meads", "value": 2}]`,
+			[]importBlock{
+				{0, []database.Tx{tx("jrhodes", "meads", 1, "")}, true},
+				{1600000000, []database.Tx{tx("meads", "lhendricks", 1, "")}, false},
+				{0, []database.Tx{tx("jrhodes", "meads", 2, "")}, true},
+			},
+		},
+		{
+			"YAML", "seed.yaml", "",
+			"- txs:\n    - {from: jrhodes, to: meads, value: 2000}\n    - {from: jrhodes, to: jrhodes, value: 100, data: reward}\n- {from: meads, to: lhendricks, value: 1000}\n",
+			[]importBlock{
+				{0, []database.Tx{tx("jrhodes", "meads", 2000, ""), tx("jrhodes", "jrhodes", 100, "reward")}, false},
+				{0, []database.Tx{tx("meads", "lhendricks", 1000, "")}, true},
+			},
+		},
+		{
+			"CSV rows grouped by block label", "seed.csv", "",
+			"from,to,value,data,block\njrhodes,meads,2000,,1\njrhodes,jrhodes,100,reward,1\nmeads,lhendricks,1000,,2\n",
+			[]importBlock{
+				{0, []database.Tx{tx("jrhodes", "meads", 2000, ""), tx("jrhodes", "jrhodes", 100, "reward")}, false},
+				{0, []database.Tx{tx("meads", "lhendricks", 1000, "")}, false},
+			},
+		},
+		{
+			"CSV without block column is one block", "seed.csv", "",
+			"value, to, from\n3, meads, jrhodes\n4, lhendricks, meads\n",
+			[]importBlock{{0, []database.Tx{tx("jrhodes", "meads", 3, ""), tx("meads", "lhendricks", 4, "")}, true}},
+		},
+		{
+			"format flag overrides the extension", "seed.txt", "csv",
+			"from,to,value\njrhodes,meads,1\n",
+			[]importBlock{{0, []database.Tx{tx("jrhodes", "meads", 1, "")}, true}},
+		},
+	}
+
+	for _, test := range tests {
+		blocks, err := readImportFile(writeImportFile(t, test.file, test.content), test.format)
+		if err != nil {
+			t.Errorf("%s: reading the import file failed: %s", test.name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(blocks, test.expected) {
+			t.Errorf("%s: read %+v, expected %+v", test.name, blocks, test.expected)
+		}
+	}
+}
+
+func TestReadImportFileRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		err     string
+	}{
+		{"unsupported format", "seed.xml", "<txs/>", "unsupported import format 'xml'"},
+		{"invalid JSON", "seed.json", `[{"from": "jrhodes"`, "unable to parse import file"},
+		{"unknown YAML field", "seed.yaml", "- {from: jrhodes, to: meads, amount: 1}\n", "unable to parse import file"},
+		{"nested blocks", "seed.json", `[{"txs": [{"txs": [{"from": "jrhodes", "to": "meads", "value": 1}]}]}]`, "can't be nested"},
+		{"missing CSV column", "seed.csv", "from,to\njrhodes,meads\n", "missing the 'value' column"},
+		{"invalid CSV value", "seed.csv", "from,to,value\njrhodes,meads,-1\n", "invalid value on CSV line 2"},
+		{"empty CSV", "seed.csv", "", "unable to read CSV header"},
+	}
+
+	for _, test := range tests {
+		_, err := readImportFile(writeImportFile(t, test.file, test.content), "")
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+	}
+}
+
+func TestSplitImportBlocks(t *testing.T) {
+	tx := database.NewTx("jrhodes", "meads", 1, "")
+	txs := func(count int) []database.Tx {
+		list := make([]database.Tx, count)
+		for i := range list {
+			list[i] = tx
+		}
+		return list
+	}
+
+	blocks := []importBlock{
+		{0, txs(5), true},
+		{1600000000, txs(5), false},
+		{0, txs(2), true},
+	}
+
+	split := splitImportBlocks(blocks, 2)
+
+	expected := []int{2, 2, 1, 5, 2}
+	if len(split) != len(expected) {
+		t.Fatalf("split into %d blocks, expected %d", len(split), len(expected))
+	}
+
+	for i, ib := range split {
+		if len(ib.txs) != expected[i] {
+			t.Errorf("block %d has %d TXs, expected %d", i, len(ib.txs), expected[i])
+		}
+	}
+
+	if split[3].time != 1600000000 {
+		t.Errorf("a block listed in the import must keep its time")
+	}
+}
+
+// newTestConsensusState returns the State of a data dir initialized with the genesis.
+func newTestConsensusState(t *testing.T, gen map[string]interface{}) *database.State {
+	t.Helper()
+
+	gen["balances"] = map[string]uint64{"jrhodes": 1000000}
+	genesisContent, err := json.Marshal(gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir := newTestDataDir(t)
+	err = database.InitDataDir(dataDir, genesisContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := database.NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { state.Close() })
+
+	return state
+}
+
+func TestImportBlocksSealsThroughTheConsensus(t *testing.T) {
+	publicKey, privateKey, err := database.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := database.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	poa := map[string]interface{}{"consensus": database.ConsensusPoA, "signers": map[string]database.PublicKey{"alice": publicKey}}
+
+	tests := []struct {
+		name    string
+		genesis map[string]interface{}
+		key     database.SealKey
+		err     string
+	}{
+		{"instant seal", map[string]interface{}{}, database.SealKey{}, ""},
+		{"PoA without a signer", poa, database.SealKey{}, "runs the 'poa' consensus, pass --signer and --signer-key"},
+		{"PoA with another key", poa, database.SealKey{Account: "alice", PrivateKey: otherKey}, "'alice' isn't an authorized signer with the node key"},
+		{"PoA signer", poa, database.SealKey{Account: "alice", PrivateKey: privateKey}, ""},
+		{"PoW without a miner", map[string]interface{}{"consensus": database.ConsensusPoW}, database.SealKey{}, "runs the 'pow' consensus"},
+		{"PoW miner", map[string]interface{}{"consensus": database.ConsensusPoW, "pow": map[string]uint64{"difficulty": 1}}, database.SealKey{Account: "jrhodes"}, ""},
+	}
+
+	for _, test := range tests {
+		state := newTestConsensusState(t, test.genesis)
+		blocks := []importBlock{{0, []database.Tx{database.NewTx("jrhodes", "meads", database.NewAmount(1), "")}, true}}
+
+		count, err := importBlocks(state, blocks, test.key)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if count != 1 || state.Balances["meads"] != database.NewAmount(1) {
+			t.Errorf("%s: imported %d TXs, meads balance is %s, expected 1 TX of 1 TBB", test.name, count, state.Balances["meads"])
+		}
+	}
+}
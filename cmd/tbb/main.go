@@ -12,6 +12,10 @@ import (
 const flagDataDir = "datadir"
 const flagIP = "ip"
 const flagPort = "port"
+const flagConsensus = "consensus"
+const flagSigner = "signer"
+const flagSignerKey = "signer-key"
+const flagCheckpoint = "checkpoint"
 
 const defaultDataDirname = ".tbb"
 
@@ -24,12 +28,11 @@ func main() {
 		},
 	}
 
-	tbbCmd.AddCommand(migrateCmd())
 	tbbCmd.AddCommand(versionCmd)
 	tbbCmd.AddCommand(runCmd())
 	tbbCmd.AddCommand(balancesCmd())
-	// TODO refactor txCmd so we can add it back to list of commands
-	//tbbCmd.AddCommand(txCmd())
+	tbbCmd.AddCommand(dbCmd())
+	tbbCmd.AddCommand(txCmd())
 
 	err := tbbCmd.Execute()
 	if err != nil {
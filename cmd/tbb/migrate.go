@@ -1,79 +0,0 @@
-package main
-
-import (
-	"github.com/spf13/cobra"
-	"fmt"
-	"github.com/jsrhodes15/the-blockchain-bar/database"
-	"os"
-	"time"
-)
-
-var migrateCmd = func() *cobra.Command {
-	var migrateCmd = &cobra.Command{
-		Use:   "migrate",
-		Short: "Migrates the blockchain database according to new business rules.",
-		Run: func(cmd *cobra.Command, args []string) {
-			state, err := database.NewStateFromDisk(getDataDirFromCmd(cmd))
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
-			}
-			defer state.Close()
-
-			block0 := database.NewBlock(
-				database.Hash{},
-				state.NextBlockNumber(),
-				uint64(time.Now().Unix()),
-				[]database.Tx{
-					database.NewTx("jrhodes", "jrhodes", 3, ""),
-					database.NewTx("jrhodes", "jrhodes", 700, "reward"),
-				},
-			)
-
-			block0hash, err := state.AddBlock(block0)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
-			}
-
-			block1 := database.NewBlock(
-				block0hash,
-				state.NextBlockNumber(),
-				uint64(time.Now().Unix()),
-				[]database.Tx{
-					database.NewTx("jrhodes", "meads", 2000, ""),
-					database.NewTx("jrhodes", "jrhodes", 100, "reward"),
-					database.NewTx("meads", "jrhodes", 1, ""),
-					database.NewTx("meads", "lhendricks", 1000, ""),
-					database.NewTx("meads", "jrhodes", 50, ""),
-					database.NewTx("jrhodes", "jrhodes", 600, "reward"),
-				},
-			)
-
-			block1hash, err := state.AddBlock(block1)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
-			}
-
-			block2 := database.NewBlock(
-				block1hash,
-				2,
-				uint64(time.Now().Unix()),
-				[]database.Tx{
-					database.NewTx("jrhodes", "jrhodes", 24700, "reward"),
-				},
-			)
-
-			_, err = state.AddBlock(block2)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
-				os.Exit(1)
-			}
-		},
-	}
-
-	addDefaultFlags(migrateCmd)
-
-	return migrateCmd
-}
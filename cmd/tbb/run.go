@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"github.com/jsrhodes15/the-blockchain-bar/database"
 	"github.com/jsrhodes15/the-blockchain-bar/node"
 	"github.com/spf13/cobra"
 	"os"
@@ -14,6 +15,30 @@ func runCmd() *cobra.Command{
 		Run: func(cmd *cobra.Command, args []string) {
 			ip, _ := cmd.Flags().GetString(flagIP)
 			port, _ :=  cmd.Flags().GetUint64(flagPort)
+			consensus, _ := cmd.Flags().GetString(flagConsensus)
+			signer, _ := cmd.Flags().GetString(flagSigner)
+			signerKeyPath, _ := cmd.Flags().GetString(flagSignerKey)
+
+			consensusConfig := node.ConsensusConfig{Engine: consensus}
+			consensusConfig.SealKey.Account = database.NewAccount(signer)
+			if signerKeyPath != "" {
+				signerKey, err := readKeyFile(signerKeyPath)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				consensusConfig.SealKey.PrivateKey = signerKey
+			}
+
+			rawCheckpoints, _ := cmd.Flags().GetStringArray(flagCheckpoint)
+			for _, raw := range rawCheckpoints {
+				checkpoint, err := database.ParseCheckpoint(raw)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				consensusConfig.Checkpoints = append(consensusConfig.Checkpoints, checkpoint)
+			}
 
 			fmt.Printf("Launching TBB node and its HTTP API...\n\t- Configuration and data in %s directory.\n", getDataDirFromCmd(cmd))
 
@@ -24,7 +49,7 @@ func runCmd() *cobra.Command{
 					false,
 				)
 
-			n := node.New(getDataDirFromCmd(cmd), ip, port, bootstrap)
+			n := node.New(getDataDirFromCmd(cmd), ip, port, bootstrap, consensusConfig)
 			err := n.Run()
 			if err != nil {
 				fmt.Println(err)
@@ -36,6 +61,10 @@ func runCmd() *cobra.Command{
 	addDefaultFlags(runCmd)
 	runCmd.Flags().String(flagIP, node.DefaultIP, "exposed IP address for communication with peers")
 	runCmd.Flags().Uint64P(flagPort, "p", node.DefaultHttpPort, "exposed HTTP port for communication with peers")
+	runCmd.Flags().String(flagConsensus, "", "consensus genesis must use, 'instant', 'pow', 'poa' or 'pos' (default: the genesis one)")
+	runCmd.Flags().String(flagSigner, "", "PoA signer, PoS validator or PoW miner account the node seals its blocks as")
+	runCmd.Flags().String(flagSignerKey, "", "key file of the signer or validator")
+	runCmd.Flags().StringArray(flagCheckpoint, nil, "block declared final on top of the genesis checkpoints, as 'number:hash' (repeatable)")
 
 	return runCmd
 }
@@ -0,0 +1,1086 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jsrhodes15/the-blockchain-bar/database"
+	"github.com/jsrhodes15/the-blockchain-bar/node"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+const flagFrom = "from"
+const flagTo = "to"
+const flagValue = "value"
+const flagData = "data"
+const flagNode = "node"
+const flagKey = "key"
+const flagPolicy = "policy"
+const flagThreshold = "threshold"
+const flagPubKey = "pubkey"
+const flagNonce = "nonce"
+const flagName = "name"
+const flagAddress = "address"
+const flagUnlockHeight = "unlock-height"
+const flagUnlockTime = "unlock-time"
+const flagScript = "script"
+const flagArg = "arg"
+const flagGas = "gas"
+const flagHashLock = "hashlock"
+const flagPreimage = "preimage"
+const flagTimeout = "timeout"
+const flagChannel = "channel"
+const flagChallenge = "challenge"
+const flagPaid = "paid"
+const flagUpdate = "update"
+const flagCandidate = "candidate"
+const flagRemove = "remove"
+const flagEvidence = "evidence"
+
+type keyFile struct {
+	PublicKey  database.PublicKey `json:"public_key"`
+	PrivateKey string             `json:"private_key"`
+}
+
+func txCmd() *cobra.Command {
+	var txsCmd = &cobra.Command{
+		Use:   "tx",
+		Short: "Interact with txs (add, multisig...).",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return incorrectUsageErr()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+		},
+	}
+
+	txsCmd.AddCommand(txAddCmd())
+	txsCmd.AddCommand(txRegisterNameCmd())
+	txsCmd.AddCommand(txDeployCmd())
+	txsCmd.AddCommand(txCallCmd())
+	txsCmd.AddCommand(txHtlcSecretCmd())
+	txsCmd.AddCommand(txHtlcLockCmd())
+	txsCmd.AddCommand(txHtlcClaimCmd())
+	txsCmd.AddCommand(txHtlcRefundCmd())
+	txsCmd.AddCommand(txChannelOpenCmd())
+	txsCmd.AddCommand(txChannelPayCmd())
+	txsCmd.AddCommand(txChannelCloseCmd())
+	txsCmd.AddCommand(txPoaVoteCmd())
+	txsCmd.AddCommand(txBondCmd())
+	txsCmd.AddCommand(txUnbondCmd())
+	txsCmd.AddCommand(txSlashCmd())
+	txsCmd.AddCommand(txKeygenCmd())
+	txsCmd.AddCommand(txMultisigCmd())
+	txsCmd.AddCommand(txCreateCmd())
+	txsCmd.AddCommand(txSignCmd())
+	txsCmd.AddCommand(txCombineCmd())
+	txsCmd.AddCommand(txSubmitCmd())
+
+	return txsCmd
+}
+
+func txAddCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "add",
+		Short: "Adds new TX to the ledger through a running node.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			value, _ := cmd.Flags().GetString(flagValue)
+			data, _ := cmd.Flags().GetString(flagData)
+			asset, _ := cmd.Flags().GetString(flagAsset)
+			unlockHeight, _ := cmd.Flags().GetUint64(flagUnlockHeight)
+			unlockTime, _ := cmd.Flags().GetUint64(flagUnlockTime)
+
+			amount, err := database.ParseAmount(value)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{
+				From:         from,
+				To:           to,
+				Value:        amount,
+				Data:         data,
+				Asset:        asset,
+				UnlockHeight: unlockHeight,
+				UnlockTime:   unlockTime,
+			})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "From what account or registered name to send tokens")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagTo, "", "To what account or registered name to send tokens")
+	cmd.MarkFlagRequired(flagTo)
+
+	cmd.Flags().String(flagValue, "", "How many tokens to send, e.g. '5' or '1.25TBB'")
+	cmd.MarkFlagRequired(flagValue)
+
+	cmd.Flags().String(flagData, "", "Possible values: 'reward'")
+	cmd.Flags().String(flagAsset, "", "Asset to send instead of TBB")
+	addUnlockFlags(cmd)
+
+	return cmd
+}
+
+func txRegisterNameCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "register-name",
+		Short: "Registers a human-readable name for an address through a running node.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			name, _ := cmd.Flags().GetString(flagName)
+			address, _ := cmd.Flags().GetString(flagAddress)
+			if address == "" {
+				address = from
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{From: from, To: address, Type: string(database.TxTypeNameRegister), Name: name})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Account registering, and owning, the name")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagName, "", "Name to register, e.g. 'jrhodes'")
+	cmd.MarkFlagRequired(flagName)
+
+	cmd.Flags().String(flagAddress, "", "Address the name points to (default: the --from account)")
+
+	return cmd
+}
+
+func txDeployCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "deploy",
+		Short: "Deploys a script to a new account through a running node.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			value, _ := cmd.Flags().GetString(flagValue)
+			scriptPath, _ := cmd.Flags().GetString(flagScript)
+
+			amount, err := database.ParseAmount(value)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			script, err := ioutil.ReadFile(scriptPath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{
+				From:   from,
+				To:     to,
+				Value:  amount,
+				Type:   string(database.TxTypeScriptDeploy),
+				Script: string(script),
+			})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Account deploying, and funding, the script")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagTo, "", "New account the script is deployed to")
+	cmd.MarkFlagRequired(flagTo)
+
+	cmd.Flags().String(flagValue, "0", "How many tokens to fund the script account with")
+
+	cmd.Flags().String(flagScript, "", "file containing the script source")
+	cmd.MarkFlagRequired(flagScript)
+
+	return cmd
+}
+
+func txCallCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "call",
+		Short: "Sends tokens to a script account and runs its script through a running node.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			value, _ := cmd.Flags().GetString(flagValue)
+			scriptArgs, _ := cmd.Flags().GetStringArray(flagArg)
+			gas, _ := cmd.Flags().GetUint64(flagGas)
+
+			amount, err := database.ParseAmount(value)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{
+				From:     from,
+				To:       to,
+				Value:    amount,
+				Type:     string(database.TxTypeScriptCall),
+				Args:     scriptArgs,
+				GasLimit: gas,
+			})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Account calling the script")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagTo, "", "Script account or registered name to call")
+	cmd.MarkFlagRequired(flagTo)
+
+	cmd.Flags().String(flagValue, "0", "How many tokens to send to the script account")
+	cmd.Flags().StringArray(flagArg, []string{}, "Script argument, repeat for more arguments")
+	cmd.Flags().Uint64(flagGas, 10000, "Maximum gas the script may use")
+
+	return cmd
+}
+
+func txHtlcSecretCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "htlc-secret",
+		Short: "Generates an HTLC preimage and the hash lock it opens.",
+		Run: func(cmd *cobra.Command, args []string) {
+			preimage, hashLock, err := database.NewHtlcSecret()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Preimage (keep it secret until claiming): %x\n", preimage)
+			fmt.Printf("Hash lock: %s\n", hashLock.Hex())
+		},
+	}
+
+	return cmd
+}
+
+func txHtlcLockCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "htlc-lock",
+		Short: "Locks tokens for a recipient under a hash lock until a timeout height.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			value, _ := cmd.Flags().GetString(flagValue)
+			asset, _ := cmd.Flags().GetString(flagAsset)
+			timeout, _ := cmd.Flags().GetUint64(flagTimeout)
+
+			amount, err := database.ParseAmount(value)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			hashLock, err := getHashFromCmd(cmd, flagHashLock)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{
+				From:          from,
+				To:            to,
+				Value:         amount,
+				Asset:         asset,
+				Type:          string(database.TxTypeHtlcLock),
+				HashLock:      &hashLock,
+				TimeoutHeight: timeout,
+			})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Account locking the tokens, refunded after the timeout")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagTo, "", "Account or registered name able to claim the tokens")
+	cmd.MarkFlagRequired(flagTo)
+
+	cmd.Flags().String(flagValue, "", "How many tokens to lock")
+	cmd.MarkFlagRequired(flagValue)
+
+	cmd.Flags().String(flagAsset, "", "Asset to lock instead of TBB")
+
+	cmd.Flags().String(flagHashLock, "", "hex encoded SHA-256 hash of the preimage")
+	cmd.MarkFlagRequired(flagHashLock)
+
+	cmd.Flags().Uint64(flagTimeout, 0, "block number from which the tokens can only be refunded")
+	cmd.MarkFlagRequired(flagTimeout)
+
+	return cmd
+}
+
+func txHtlcClaimCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "htlc-claim",
+		Short: "Claims the tokens of an HTLC by revealing its preimage.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			preimage, _ := cmd.Flags().GetString(flagPreimage)
+
+			submitTxAddReq(cmd, node.TxAddReq{From: from, Type: string(database.TxTypeHtlcClaim), Preimage: preimage})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Recipient of the HTLC")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagPreimage, "", "hex encoded preimage of the hash lock")
+	cmd.MarkFlagRequired(flagPreimage)
+
+	return cmd
+}
+
+func txHtlcRefundCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "htlc-refund",
+		Short: "Takes back the tokens of a timed out HTLC.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+
+			hashLock, err := getHashFromCmd(cmd, flagHashLock)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{From: from, Type: string(database.TxTypeHtlcRefund), HashLock: &hashLock})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Sender of the HTLC")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagHashLock, "", "hex encoded hash lock of the HTLC")
+	cmd.MarkFlagRequired(flagHashLock)
+
+	return cmd
+}
+
+func txChannelOpenCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "channel-open",
+		Short: "Opens a payment channel locking a deposit for off-chain payments.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			to, _ := cmd.Flags().GetString(flagTo)
+			value, _ := cmd.Flags().GetString(flagValue)
+			asset, _ := cmd.Flags().GetString(flagAsset)
+			keyPath, _ := cmd.Flags().GetString(flagKey)
+			challenge, _ := cmd.Flags().GetUint64(flagChallenge)
+
+			amount, err := database.ParseAmount(value)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			var key keyFile
+			err = readJsonFile(keyPath, &key)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{
+				From:            from,
+				To:              to,
+				Value:           amount,
+				Asset:           asset,
+				Type:            string(database.TxTypeChannelOpen),
+				ChannelKey:      &key.PublicKey,
+				ChallengePeriod: challenge,
+			})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Payer locking the deposit")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagTo, "", "Payee account or registered name")
+	cmd.MarkFlagRequired(flagTo)
+
+	cmd.Flags().String(flagValue, "", "How many tokens to deposit")
+	cmd.MarkFlagRequired(flagValue)
+
+	cmd.Flags().String(flagAsset, "", "Asset to deposit instead of TBB")
+
+	cmd.Flags().String(flagKey, "", "key file of the key signing the channel updates")
+	cmd.MarkFlagRequired(flagKey)
+
+	cmd.Flags().Uint64(flagChallenge, 10, "blocks the payee has to dispute a close")
+
+	return cmd
+}
+
+func txChannelPayCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "channel-pay",
+		Short: "Signs an off-chain channel update paying the payee a new total.",
+		Run: func(cmd *cobra.Command, args []string) {
+			paid, _ := cmd.Flags().GetString(flagPaid)
+			keyPath, _ := cmd.Flags().GetString(flagKey)
+			out, _ := cmd.Flags().GetString(flagOut)
+
+			channel, err := getHashFromCmd(cmd, flagChannel)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			amount, err := database.ParseAmount(paid)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			privateKey, err := readKeyFile(keyPath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			update, err := database.ChannelUpdate{Channel: channel, Paid: amount}.Sign(privateKey)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			err = writeJsonFile(out, update, 0644, false)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Channel update paying %s written to '%s', hand it to the payee.\n", amount, out)
+		},
+	}
+
+	cmd.Flags().String(flagChannel, "", "ID of the channel")
+	cmd.MarkFlagRequired(flagChannel)
+
+	cmd.Flags().String(flagPaid, "", "Total paid to the payee so far, not the increment")
+	cmd.MarkFlagRequired(flagPaid)
+
+	cmd.Flags().String(flagKey, "", "key file of the channel key")
+	cmd.MarkFlagRequired(flagKey)
+
+	cmd.Flags().String(flagOut, "", "file to write the signed update to")
+	cmd.MarkFlagRequired(flagOut)
+
+	return cmd
+}
+
+func txChannelCloseCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "channel-close",
+		Short: "Closes a payment channel, or disputes its closing, with the latest update.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			updatePath, _ := cmd.Flags().GetString(flagUpdate)
+
+			update := database.ChannelUpdate{}
+			if updatePath != "" {
+				err := readJsonFile(updatePath, &update)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			} else {
+				channel, err := getHashFromCmd(cmd, flagChannel)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+				update.Channel = channel
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{From: from, Type: string(database.TxTypeChannelClose), ChannelUpdate: &update})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Payer or payee of the channel")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagUpdate, "", "signed channel update file")
+	cmd.Flags().String(flagChannel, "", "ID of the channel, to close it without any update")
+
+	return cmd
+}
+
+func txPoaVoteCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "poa-vote",
+		Short: "Votes, as a PoA signer, to authorize a new signer or to remove one.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			candidate, _ := cmd.Flags().GetString(flagCandidate)
+			remove, _ := cmd.Flags().GetBool(flagRemove)
+			pubKey, _ := cmd.Flags().GetString(flagPubKey)
+
+			vote := database.PoaVote{Authorize: !remove}
+			if !remove {
+				err := vote.PublicKey.UnmarshalText([]byte(pubKey))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{From: from, To: candidate, Type: string(database.TxTypePoaVote), Vote: &vote})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Signer casting the vote, the node must seal as this signer")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagCandidate, "", "Account to authorize or remove as a signer")
+	cmd.MarkFlagRequired(flagCandidate)
+
+	cmd.Flags().Bool(flagRemove, false, "vote to remove the candidate instead of authorizing it")
+	cmd.Flags().String(flagPubKey, "", "public key of the candidate to authorize")
+
+	return cmd
+}
+
+func txBondCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "bond",
+		Short: "Bonds TBB to the validator stake of an account.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			value, _ := cmd.Flags().GetString(flagValue)
+			pubKey, _ := cmd.Flags().GetString(flagPubKey)
+
+			amount, err := database.ParseAmount(value)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			req := node.TxAddReq{From: from, Value: amount, Type: string(database.TxTypeStakeBond)}
+			if pubKey != "" {
+				req.ValidatorKey = &database.PublicKey{}
+				err = req.ValidatorKey.UnmarshalText([]byte(pubKey))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			submitTxAddReq(cmd, req)
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Validator account bonding its TBB")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagValue, "", "How many TBB to bond")
+	cmd.MarkFlagRequired(flagValue)
+
+	cmd.Flags().String(flagPubKey, "", "validator public key, required by the first bond")
+
+	return cmd
+}
+
+func txUnbondCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "unbond",
+		Short: "Unbonds TBB from a validator stake, returned after the unbonding period.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			value, _ := cmd.Flags().GetString(flagValue)
+
+			amount, err := database.ParseAmount(value)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{From: from, Value: amount, Type: string(database.TxTypeStakeUnbond)})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Validator account unbonding its TBB")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagValue, "", "How many TBB to unbond")
+	cmd.MarkFlagRequired(flagValue)
+
+	return cmd
+}
+
+func txSlashCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "slash",
+		Short: "Slashes a validator which sealed two different blocks at the same height.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			evidencePath, _ := cmd.Flags().GetString(flagEvidence)
+
+			var evidence database.DoubleSignEvidence
+			err := readJsonFile(evidencePath, &evidence)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{From: from, Type: string(database.TxTypeStakeSlash), Evidence: &evidence})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	cmd.Flags().String(flagFrom, "", "Account reporting the double sign")
+	cmd.MarkFlagRequired(flagFrom)
+
+	cmd.Flags().String(flagEvidence, "", "file with the 'first' and 'second' blocks sealed by the validator")
+	cmd.MarkFlagRequired(flagEvidence)
+
+	return cmd
+}
+
+func getHashFromCmd(cmd *cobra.Command, flag string) (database.Hash, error) {
+	value, _ := cmd.Flags().GetString(flag)
+
+	hash := database.Hash{}
+	if len(value) != 2*len(hash) {
+		return database.Hash{}, fmt.Errorf("--%s must be %d hex characters", flag, 2*len(hash))
+	}
+
+	err := hash.UnmarshalText([]byte(value))
+	if err != nil {
+		return database.Hash{}, err
+	}
+
+	return hash, nil
+}
+
+func txKeygenCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "keygen",
+		Short: "Generates a key pair to sign TXs with.",
+		Run: func(cmd *cobra.Command, args []string) {
+			out, _ := cmd.Flags().GetString(flagOut)
+
+			publicKey, privateKey, err := database.GenerateKey()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			err = writeJsonFile(out, keyFile{publicKey, hex.EncodeToString(privateKey)}, 0600, true)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Key written to '%s', public key:\n%x\n", out, publicKey)
+		},
+	}
+
+	cmd.Flags().String(flagOut, "", "file to write the new key to")
+	cmd.MarkFlagRequired(flagOut)
+
+	return cmd
+}
+
+func txMultisigCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "multisig",
+		Short: "Defines an M-of-N multisig account from its owners public keys.",
+		Run: func(cmd *cobra.Command, args []string) {
+			threshold, _ := cmd.Flags().GetUint(flagThreshold)
+			pubKeys, _ := cmd.Flags().GetStringSlice(flagPubKey)
+			out, _ := cmd.Flags().GetString(flagOut)
+
+			keys := make([]database.PublicKey, len(pubKeys))
+			for i, pubKey := range pubKeys {
+				err := keys[i].UnmarshalText([]byte(pubKey))
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+
+			policy, err := database.NewMultisigPolicy(threshold, keys)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			account, err := policy.Account()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			err = writeJsonFile(out, policy, 0644, true)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("%d-of-%d policy written to '%s', account:\n%s\n", threshold, len(keys), out, account)
+		},
+	}
+
+	cmd.Flags().Uint(flagThreshold, 0, "How many owners must sign a TX")
+	cmd.MarkFlagRequired(flagThreshold)
+
+	cmd.Flags().StringSlice(flagPubKey, nil, "Public key of an owner, repeat for every owner")
+	cmd.MarkFlagRequired(flagPubKey)
+
+	cmd.Flags().String(flagOut, "", "file to write the policy to")
+	cmd.MarkFlagRequired(flagOut)
+
+	return cmd
+}
+
+func txCreateCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "create",
+		Short: "Creates an unsigned TX spending from a multisig account, for its owners to sign.",
+		Run: func(cmd *cobra.Command, args []string) {
+			policyPath, _ := cmd.Flags().GetString(flagPolicy)
+			to, _ := cmd.Flags().GetString(flagTo)
+			value, _ := cmd.Flags().GetString(flagValue)
+			data, _ := cmd.Flags().GetString(flagData)
+			asset, _ := cmd.Flags().GetString(flagAsset)
+			nonce, _ := cmd.Flags().GetUint64(flagNonce)
+			out, _ := cmd.Flags().GetString(flagOut)
+
+			var policy database.MultisigPolicy
+			err := readJsonFile(policyPath, &policy)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			from, err := policy.Account()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			amount, err := database.ParseAmount(value)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			state, err := database.NewStateFromDiskReadOnly(getDataDirFromCmd(cmd))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			defer state.Close()
+
+			if nonce == 0 {
+				nonce = state.NextNonce(from)
+			}
+
+			tx := database.NewAssetTx(from, state.ResolveAccount(to), amount, database.AssetID(asset), data)
+			tx.UnlockHeight, _ = cmd.Flags().GetUint64(flagUnlockHeight)
+			tx.UnlockTime, _ = cmd.Flags().GetUint64(flagUnlockTime)
+			tx.Nonce = nonce
+			tx.Multisig = &policy
+
+			err = writeJsonFile(out, tx, 0644, true)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Unsigned TX from '%s' with nonce %d written to '%s'.\n", from, nonce, out)
+		},
+	}
+
+	addDefaultFlags(cmd)
+
+	cmd.Flags().String(flagPolicy, "", "multisig policy file of the account to spend from")
+	cmd.MarkFlagRequired(flagPolicy)
+
+	cmd.Flags().String(flagTo, "", "To what account or registered name to send tokens")
+	cmd.MarkFlagRequired(flagTo)
+
+	cmd.Flags().String(flagValue, "", "How many tokens to send, e.g. '5' or '1.25TBB'")
+	cmd.MarkFlagRequired(flagValue)
+
+	cmd.Flags().String(flagData, "", "TX data")
+	cmd.Flags().String(flagAsset, "", "Asset to send instead of TBB")
+	cmd.Flags().Uint64(flagNonce, 0, "nonce of the TX (default: the account next nonce read from --datadir)")
+	addUnlockFlags(cmd)
+
+	cmd.Flags().String(flagOut, "", "file to write the unsigned TX to")
+	cmd.MarkFlagRequired(flagOut)
+
+	return cmd
+}
+
+func txSignCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "sign <tx file>",
+		Short: "Adds a partial signature to a TX file.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			keyPath, _ := cmd.Flags().GetString(flagKey)
+			out, _ := cmd.Flags().GetString(flagOut)
+			if out == "" {
+				out = args[0]
+			}
+
+			privateKey, err := readKeyFile(keyPath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			var tx database.Tx
+			err = readJsonFile(args[0], &tx)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			tx, err = tx.Sign(privateKey)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			err = writeJsonFile(out, tx, 0644, false)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("TX signed, it now carries %d signatures.\n", len(tx.Signatures))
+		},
+	}
+
+	cmd.Flags().String(flagKey, "", "key file to sign with")
+	cmd.MarkFlagRequired(flagKey)
+
+	cmd.Flags().String(flagOut, "", "file to write the signed TX to (default: the TX file itself)")
+
+	return cmd
+}
+
+func txCombineCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "combine <tx file>...",
+		Short: "Combines the partial signatures of several copies of the same TX into one TX file.",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			out, _ := cmd.Flags().GetString(flagOut)
+
+			var combined database.Tx
+			var combinedHash database.Hash
+
+			for i, path := range args {
+				var tx database.Tx
+				err := readJsonFile(path, &tx)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+
+				signingHash, err := tx.SigningHash()
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+
+				if i == 0 {
+					combined = tx
+					combinedHash = signingHash
+					continue
+				}
+
+				if signingHash != combinedHash {
+					fmt.Fprintf(os.Stderr, "'%s' is a different TX than '%s'\n", path, args[0])
+					os.Exit(1)
+				}
+
+				combined = combined.WithSignatures(tx.Signatures)
+			}
+
+			err := writeJsonFile(out, combined, 0644, false)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Combined TX with %d signatures written to '%s'.\n", len(combined.Signatures), out)
+		},
+	}
+
+	cmd.Flags().String(flagOut, "", "file to write the combined TX to")
+	cmd.MarkFlagRequired(flagOut)
+
+	return cmd
+}
+
+func txSubmitCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "submit <tx file>",
+		Short: "Submits a signed TX file to a running node.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var tx database.Tx
+			err := readJsonFile(args[0], &tx)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+
+			submitTxAddReq(cmd, node.TxAddReq{
+				From:         string(tx.From),
+				To:           string(tx.To),
+				Value:        tx.Value,
+				Data:         tx.Data,
+				Type:         string(tx.Type),
+				Asset:        string(tx.Asset),
+				UnlockHeight: tx.UnlockHeight,
+				UnlockTime:   tx.UnlockTime,
+				Nonce:        tx.Nonce,
+				Multisig:     tx.Multisig,
+				Signatures:   tx.Signatures,
+			})
+		},
+	}
+
+	addNodeFlag(cmd)
+
+	return cmd
+}
+
+func addUnlockFlags(cmd *cobra.Command) {
+	cmd.Flags().Uint64(flagUnlockHeight, 0, "only credit the recipient from this block number on")
+	cmd.Flags().Uint64(flagUnlockTime, 0, "only credit the recipient from this unix time on")
+}
+
+func addNodeFlag(cmd *cobra.Command) {
+	cmd.Flags().String(flagNode, fmt.Sprintf("%s:%d", node.DefaultIP, node.DefaultHttpPort), "address of the node to send the TX to")
+}
+
+func submitTxAddReq(cmd *cobra.Command, req node.TxAddReq) {
+	nodeAddress, _ := cmd.Flags().GetString(flagNode)
+
+	reqJson, err := json.Marshal(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	res, err := http.Post(fmt.Sprintf("http://%s/tx/add", nodeAddress), "application/json", bytes.NewReader(reqJson))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		errRes := node.ErrRes{}
+		json.NewDecoder(res.Body).Decode(&errRes)
+		fmt.Fprintf(os.Stderr, "node rejected the TX. %s\n", errRes.Error)
+		os.Exit(1)
+	}
+
+	txAddRes := node.TxAddRes{}
+	err = json.NewDecoder(res.Body).Decode(&txAddRes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("TX successfully added to the ledger in block %x.\n", txAddRes.Hash)
+}
+
+func readKeyFile(path string) (ed25519.PrivateKey, error) {
+	var key keyFile
+	err := readJsonFile(path, &key)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := hex.DecodeString(key.PrivateKey)
+	if err != nil || len(privateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("key file '%s' doesn't hold a valid private key", path)
+	}
+
+	if !bytes.Equal(ed25519.PrivateKey(privateKey).Public().(ed25519.PublicKey), key.PublicKey[:]) {
+		return nil, fmt.Errorf("key file '%s' private key doesn't match its public key", path)
+	}
+
+	return privateKey, nil
+}
+
+func readJsonFile(path string, v interface{}) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(content, v)
+	if err != nil {
+		return fmt.Errorf("unable to parse '%s'. %s", path, err.Error())
+	}
+
+	return nil
+}
+
+func writeJsonFile(path string, v interface{}, perm os.FileMode, exclusive bool) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	if exclusive {
+		flags = os.O_CREATE | os.O_EXCL | os.O_WRONLY
+	}
+
+	f, err := os.OpenFile(path, flags, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(content, '\n'))
+
+	return err
+}
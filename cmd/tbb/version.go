@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"github.com/jsrhodes15/the-blockchain-bar/database"
 	"github.com/spf13/cobra"
 )
 
@@ -14,6 +15,11 @@ var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Describes version.",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Printf("Version: %s.%s.%s-beta %s", Major, Minor, Patch, Description)
+		fmt.Printf("Version: %s.%s.%s-beta %s\n", Major, Minor, Patch, Description)
+
+		fmt.Println("Supported upgrades:")
+		for _, upgrade := range database.Upgrades {
+			fmt.Printf("\t%-14s %s\n", upgrade.Name, upgrade.Description)
+		}
 	},
 }
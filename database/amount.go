@@ -0,0 +1,160 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Amount is a fixed-decimal quantity of TBB, counted in its smallest unit, the uTBB.
+//
+// Amounts are serialized as a decimal number of TBB, so whole amounts keep the
+// exact JSON (and block hashes) they had before sub-units existed.
+type Amount uint64
+
+type Denomination struct {
+	Name  string
+	Units Amount
+}
+
+const MicroTBB Amount = 1
+const MilliTBB Amount = 1000 * MicroTBB
+const TBB Amount = 1000 * MilliTBB
+
+// AmountDecimals is the number of decimals a TBB amount can have.
+const AmountDecimals = 6
+
+const maxAmount = ^Amount(0)
+
+var DenominationTBB = Denomination{"TBB", TBB}
+var DenominationMilliTBB = Denomination{"mTBB", MilliTBB}
+var DenominationMicroTBB = Denomination{"uTBB", MicroTBB}
+
+var Denominations = []Denomination{DenominationTBB, DenominationMilliTBB, DenominationMicroTBB}
+
+// NewAmount converts a whole number of TBB into an Amount.
+func NewAmount(tbb uint64) Amount {
+	return Amount(tbb) * TBB
+}
+
+// ParseAmount parses a decimal amount with an optional denomination, such as "1.25TBB",
+// "250 mTBB" or "3". Amounts without a denomination are in TBB.
+func ParseAmount(value string) (Amount, error) {
+	value = strings.TrimSpace(value)
+	denomination := DenominationTBB
+	suffix := ""
+
+	// 'TBB' is a suffix of 'mTBB' and 'uTBB' too, the longest matching name wins
+	for _, d := range Denominations {
+		if strings.HasSuffix(value, d.Name) && len(d.Name) > len(suffix) {
+			denomination = d
+			suffix = d.Name
+		}
+	}
+
+	return parseDecimalAmount(strings.TrimSpace(strings.TrimSuffix(value, suffix)), denomination)
+}
+
+func parseDecimalAmount(value string, d Denomination) (Amount, error) {
+	whole, frac := value, ""
+	if i := strings.Index(value, "."); i >= 0 {
+		whole, frac = value[:i], value[i+1:]
+	}
+
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount '%s'", value)
+	}
+
+	decimals := len(strconv.FormatUint(uint64(d.Units), 10)) - 1
+	if len(frac) > decimals {
+		return 0, fmt.Errorf("invalid amount '%s', %s can't have more than %d decimals", value, d.Name, decimals)
+	}
+
+	units := uint64(0)
+	if whole != "" {
+		w, err := strconv.ParseUint(whole, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid amount '%s'", value)
+		}
+
+		if w > uint64(maxAmount/d.Units) {
+			return 0, fmt.Errorf("amount '%s' %s is too large", value, d.Name)
+		}
+		units = w * uint64(d.Units)
+	}
+
+	if frac != "" {
+		f, err := strconv.ParseUint(frac+strings.Repeat("0", decimals-len(frac)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid amount '%s'", value)
+		}
+
+		if f > uint64(maxAmount)-units {
+			return 0, fmt.Errorf("amount '%s' %s is too large", value, d.Name)
+		}
+		units += f
+	}
+
+	return Amount(units), nil
+}
+
+// Format returns the amount as a decimal number of the given denomination, without its name.
+func (a Amount) Format(d Denomination) string {
+	whole := strconv.FormatUint(uint64(a/d.Units), 10)
+	frac := uint64(a % d.Units)
+
+	if frac == 0 {
+		return whole
+	}
+
+	decimals := len(strconv.FormatUint(uint64(d.Units), 10)) - 1
+	fracStr := strconv.FormatUint(frac, 10)
+	fracStr = strings.Repeat("0", decimals-len(fracStr)) + fracStr
+
+	return whole + "." + strings.TrimRight(fracStr, "0")
+}
+
+func (a Amount) String() string {
+	return a.Format(DenominationTBB) + " " + DenominationTBB.Name
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.Format(DenominationTBB)), nil
+}
+
+// UnmarshalJSON accepts a JSON number of TBB, or a JSON string with an optional denomination.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '"' {
+		var value string
+		err := json.Unmarshal(data, &value)
+		if err != nil {
+			return err
+		}
+
+		return a.UnmarshalText([]byte(value))
+	}
+
+	parsed, err := parseDecimalAmount(string(data), DenominationTBB)
+	if err != nil {
+		return err
+	}
+
+	*a = parsed
+
+	return nil
+}
+
+func (a *Amount) UnmarshalText(text []byte) error {
+	parsed, err := ParseAmount(string(text))
+	if err != nil {
+		return err
+	}
+
+	*a = parsed
+
+	return nil
+}
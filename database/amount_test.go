@@ -0,0 +1,151 @@
+package database
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected Amount
+	}{
+		{"3", NewAmount(3)},
+		{"0", 0},
+		{"1.25TBB", 1250 * MilliTBB},
+		{"1.25 TBB", 1250 * MilliTBB},
+		{" 0.000001TBB ", MicroTBB},
+		{".5", 500 * MilliTBB},
+		{"7.", NewAmount(7)},
+		{"250mTBB", 250 * MilliTBB},
+		{"250 mTBB", 250 * MilliTBB},
+		{"0.001mTBB", MicroTBB},
+		{"5uTBB", 5 * MicroTBB},
+		{"18446744073709551615uTBB", maxAmount},
+		{"18446744073709.551615", maxAmount},
+	}
+
+	for _, test := range tests {
+		amount, err := ParseAmount(test.value)
+		if err != nil {
+			t.Errorf("ParseAmount(%q) failed: %s", test.value, err)
+			continue
+		}
+
+		if amount != test.expected {
+			t.Errorf("ParseAmount(%q) = %d uTBB, expected %d uTBB", test.value, amount, test.expected)
+		}
+	}
+}
+
+func TestParseAmountRejectsInvalidAmounts(t *testing.T) {
+	tests := []string{
+		"",
+		".",
+		"TBB",
+		"-1",
+		"1.5.2",
+		"abc",
+		"1,5",
+		// Amounts are never rounded, more decimals than the denomination has are rejected
+		"0.0000001TBB",
+		"0.0001mTBB",
+		"1.5uTBB",
+		// Overflows
+		"18446744073709551616uTBB",
+		"18446744073710TBB",
+		"18446744073709.551616",
+	}
+
+	for _, value := range tests {
+		amount, err := ParseAmount(value)
+		if err == nil {
+			t.Errorf("ParseAmount(%q) = %d uTBB, expected an error", value, amount)
+		}
+	}
+}
+
+func TestAmountFormat(t *testing.T) {
+	tests := []struct {
+		amount       Amount
+		denomination Denomination
+		expected     string
+	}{
+		{0, DenominationTBB, "0"},
+		{NewAmount(3), DenominationTBB, "3"},
+		{1250 * MilliTBB, DenominationTBB, "1.25"},
+		{MicroTBB, DenominationTBB, "0.000001"},
+		{1250 * MilliTBB, DenominationMilliTBB, "1250"},
+		{1500 * MicroTBB, DenominationMilliTBB, "1.5"},
+		{5 * MicroTBB, DenominationMicroTBB, "5"},
+		{maxAmount, DenominationTBB, "18446744073709.551615"},
+	}
+
+	for _, test := range tests {
+		formatted := test.amount.Format(test.denomination)
+		if formatted != test.expected {
+			t.Errorf("%d uTBB formatted in %s = %q, expected %q", test.amount, test.denomination.Name, formatted, test.expected)
+		}
+	}
+}
+
+func TestAmountRoundTrip(t *testing.T) {
+	amounts := []Amount{0, MicroTBB, 999 * MicroTBB, MilliTBB, 1001 * MicroTBB, TBB, 1250 * MilliTBB, NewAmount(1000000) + 7*MicroTBB, maxAmount}
+
+	for _, amount := range amounts {
+		for _, d := range Denominations {
+			value := amount.Format(d) + d.Name
+
+			parsed, err := ParseAmount(value)
+			if err != nil {
+				t.Errorf("ParseAmount(%q) failed: %s", value, err)
+				continue
+			}
+
+			if parsed != amount {
+				t.Errorf("%d uTBB round-tripped through %q as %d uTBB", amount, value, parsed)
+			}
+		}
+
+		amountJson, err := json.Marshal(amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var unmarshalled Amount
+		err = json.Unmarshal(amountJson, &unmarshalled)
+		if err != nil {
+			t.Errorf("unmarshalling %s failed: %s", amountJson, err)
+			continue
+		}
+
+		if unmarshalled != amount {
+			t.Errorf("%d uTBB round-tripped through JSON %s as %d uTBB", amount, amountJson, unmarshalled)
+		}
+	}
+}
+
+func TestAmountUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json     string
+		expected Amount
+	}{
+		{`700`, NewAmount(700)},
+		{`1.5`, 1500 * MilliTBB},
+		{`"250mTBB"`, 250 * MilliTBB},
+		{`"5uTBB"`, 5 * MicroTBB},
+	}
+
+	for _, test := range tests {
+		var amount Amount
+		err := json.Unmarshal([]byte(test.json), &amount)
+		if err != nil {
+			t.Errorf("unmarshalling %s failed: %s", test.json, err)
+			continue
+		}
+
+		if amount != test.expected {
+			t.Errorf("unmarshalling %s = %d uTBB, expected %d uTBB", test.json, amount, test.expected)
+		}
+	}
+}
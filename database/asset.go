@@ -0,0 +1,77 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// AssetID is the ticker identifying an asset on the ledger, such as "TAB" or "PTS".
+type AssetID string
+
+// NativeAsset is the TBB currency itself, tracked in State.Balances.
+const NativeAsset AssetID = "TBB"
+
+var assetIDPattern = regexp.MustCompile(`^[A-Z][A-Z0-9]{1,11}$`)
+
+type Asset struct {
+	ID     AssetID `json:"id"`
+	Issuer Account `json:"issuer"`
+	Supply Amount  `json:"supply"`
+}
+
+// Assets returns every asset issued on the ledger, TBB excluded.
+func (s *State) Assets() map[AssetID]Asset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.assets
+}
+
+// BalancesOf returns the balances of an asset, nil if the asset doesn't exist.
+func (s *State) BalancesOf(asset AssetID) map[Account]Amount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if asset == "" || asset == NativeAsset {
+		return s.Balances
+	}
+
+	return s.assetBalances[asset]
+}
+
+func applyAssetIssue(tx Tx, s *State) error {
+	if tx.IsTimeLocked() {
+		return fmt.Errorf("bad TX. Asset issue TXs can't be time-locked")
+	}
+
+	id := tx.AssetID()
+
+	if id == NativeAsset || !assetIDPattern.MatchString(string(id)) {
+		return fmt.Errorf("bad TX. '%s' is not a valid asset ID, it must be 2 to 12 upper-case letters or digits other than '%s'", id, NativeAsset)
+	}
+
+	asset, exists := s.assets[id]
+	if exists && asset.Issuer != tx.From {
+		return fmt.Errorf("bad TX. Asset '%s' can only be issued by '%s'", id, asset.Issuer)
+	}
+
+	if !exists {
+		asset = Asset{ID: id, Issuer: tx.From}
+		s.assetBalances[id] = make(map[Account]Amount)
+	}
+
+	if tx.Value > maxAmount-asset.Supply {
+		return fmt.Errorf("bad TX. Issuing %s of '%s' overflows its supply of %s", tx.Value.Format(DenominationTBB), id, asset.Supply.Format(DenominationTBB))
+	}
+
+	balances := s.assetBalances[id]
+	if tx.Value > maxAmount-balances[tx.To] {
+		return &BalanceOverflowError{tx.To, id, balances[tx.To], tx.Value}
+	}
+
+	asset.Supply += tx.Value
+	balances[tx.To] += tx.Value
+	s.assets[id] = asset
+
+	return nil
+}
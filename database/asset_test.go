@@ -0,0 +1,139 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssetIssueAndTransfer(t *testing.T) {
+	issue := NewAssetIssueTx("jrhodes", "jrhodes", NewAmount(100), "TAB")
+
+	tests := []struct {
+		name     string
+		txs      []Tx
+		err      string
+		balances map[Account]Amount
+		supply   Amount
+	}{
+		{
+			"issue",
+			[]Tx{issue},
+			"",
+			map[Account]Amount{"jrhodes": NewAmount(100)},
+			NewAmount(100),
+		},
+		{
+			"issue more and transfer",
+			[]Tx{issue, NewAssetIssueTx("jrhodes", "meads", NewAmount(50), "TAB"), NewAssetTx("jrhodes", "meads", NewAmount(30), "TAB", "")},
+			"",
+			map[Account]Amount{"jrhodes": NewAmount(70), "meads": NewAmount(80)},
+			NewAmount(150),
+		},
+		{
+			"issue by another account",
+			[]Tx{issue, NewAssetIssueTx("meads", "meads", NewAmount(50), "TAB")},
+			"Asset 'TAB' can only be issued by 'jrhodes'",
+			nil,
+			0,
+		},
+		{
+			"invalid asset ID",
+			[]Tx{NewAssetIssueTx("jrhodes", "jrhodes", NewAmount(100), "tab")},
+			"'tab' is not a valid asset ID",
+			nil,
+			0,
+		},
+		{
+			"issue TBB",
+			[]Tx{NewAssetIssueTx("jrhodes", "jrhodes", NewAmount(100), NativeAsset)},
+			"'TBB' is not a valid asset ID",
+			nil,
+			0,
+		},
+		{
+			"transfer over the balance",
+			[]Tx{issue, NewAssetTx("jrhodes", "meads", NewAmount(101), "TAB", "")},
+			"Sender 'jrhodes' balance is 100 TAB. Tx cost is 101 TAB",
+			nil,
+			0,
+		},
+		{
+			"transfer of an unknown asset",
+			[]Tx{NewAssetTx("jrhodes", "meads", NewAmount(1), "PTS", "")},
+			"Asset 'PTS' doesn't exist",
+			nil,
+			0,
+		},
+		{
+			"reward in an asset",
+			[]Tx{issue, NewAssetTx("jrhodes", "jrhodes", NewAmount(1), "TAB", "reward")},
+			"Rewards can only be paid in TBB",
+			nil,
+			0,
+		},
+	}
+
+	for _, test := range tests {
+		s := newTestState(t, testGenesis)
+
+		_, err := s.AddBlock(nextTestBlock(s, test.txs...))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+			}
+
+			if len(s.Assets()) != 0 {
+				t.Errorf("%s: a rejected block must not issue assets", test.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: expected the block to be accepted, got '%s'", test.name, err)
+			continue
+		}
+
+		balances := s.BalancesOf("TAB")
+		for account, expected := range test.balances {
+			if balances[account] != expected {
+				t.Errorf("%s: '%s' holds %s TAB, expected %s", test.name, account, balances[account].Format(DenominationTBB), expected.Format(DenominationTBB))
+			}
+		}
+
+		asset := s.Assets()["TAB"]
+		if asset.Issuer != "jrhodes" || asset.Supply != test.supply {
+			t.Errorf("%s: asset is %+v, expected a supply of %s issued by 'jrhodes'", test.name, asset, test.supply.Format(DenominationTBB))
+		}
+
+		if s.Balances["jrhodes"] != NewAmount(1000000) || s.TotalSupply() != NewAmount(1000000) {
+			t.Errorf("%s: assets must not move TBB", test.name)
+		}
+	}
+}
+
+func TestAssetsReloadFromDisk(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addTestBlock(t, s, SealKey{}, NewAssetIssueTx("jrhodes", "jrhodes", NewAmount(100), "TAB"))
+	addTestBlock(t, s, SealKey{}, NewAssetTx("jrhodes", "meads", NewAmount(40), "TAB", ""))
+	s.Close()
+
+	s, err = NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.BalancesOf("TAB")["meads"] != NewAmount(40) || s.Assets()["TAB"].Supply != NewAmount(100) {
+		t.Errorf("asset balances are %v after reloading the State", s.BalancesOf("TAB"))
+	}
+
+	if s.BalancesOf("PTS") != nil {
+		t.Errorf("an unknown asset must have no balances")
+	}
+}
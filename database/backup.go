@@ -0,0 +1,368 @@
+package database
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const backupManifestName = "MANIFEST.json"
+
+type BackupManifest struct {
+	CreatedAt uint64       `json:"created_at"`
+	DbVersion uint         `json:"db_version"`
+	Files     []BackupFile `json:"files"`
+}
+
+type BackupFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Backup writes a gzipped tar archive of the data dir database, followed by a manifest
+// with the checksum of every archived file.
+//
+// The data dir doesn't have to be idle. The blocks db is append-only so only the blocks
+// fully written when the backup started are archived, giving a consistent copy of the chain.
+func Backup(dataDir string, w io.Writer) (BackupManifest, error) {
+	version, err := readDbVersion(dataDir)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	names := backupFileNames(dataDir)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest := BackupManifest{
+		CreatedAt: uint64(time.Now().Unix()),
+		DbVersion: version,
+		Files:     make([]BackupFile, 0, len(names)),
+	}
+
+	for _, name := range names {
+		file, err := backupFile(tw, dataDir, name)
+		if err != nil {
+			return BackupManifest{}, err
+		}
+
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    backupManifestName,
+		Mode:    0644,
+		Size:    int64(len(manifestJson)),
+		ModTime: time.Unix(int64(manifest.CreatedAt), 0),
+	})
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	_, err = tw.Write(manifestJson)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	return manifest, gz.Close()
+}
+
+// Restore verifies a backup archive and installs it as the database of the data dir.
+//
+// The archive is extracted next to the data dir, its checksums verified and its blocks added one by one
+// to a new State, as a node syncing them would, before it replaces anything. An existing database is only replaced when force is set, in which
+// case it is kept aside as 'database.replaced-<unix time>'.
+func Restore(archivePath string, dataDir string, force bool) (BackupManifest, error) {
+	dbDir := getDatabaseDirPath(dataDir)
+
+	exists, err := dirExists(dbDir)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	if exists && !force {
+		return BackupManifest{}, fmt.Errorf("data directory '%s' already contains a database, use force to replace it", dataDir)
+	}
+
+	var lock *dataDirLock
+	if exists {
+		// Nobody may be writing into the database we are about to replace
+		lock, err = lockDataDir(dataDir)
+		if err != nil {
+			return BackupManifest{}, err
+		}
+		defer func() { lock.release() }()
+	}
+
+	err = os.MkdirAll(dataDir, os.ModePerm)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	tmpDataDir, err := ioutil.TempDir(dataDir, ".restore-")
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	defer os.RemoveAll(tmpDataDir)
+
+	manifest, err := extractBackup(archivePath, tmpDataDir)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	if manifest.DbVersion > DbVersion {
+		return manifest, unsupportedDbVersionErr(archivePath, manifest.DbVersion)
+	}
+
+	// Older formats are restored as they are, 'tbb db upgrade' takes care of them afterwards
+	if manifest.DbVersion == DbVersion {
+		err = validateChain(tmpDataDir)
+		if err != nil {
+			return manifest, fmt.Errorf("backup '%s' doesn't hold a valid chain. %s", archivePath, err.Error())
+		}
+	}
+
+	if exists {
+		replacedDbDir := fmt.Sprintf("%s.replaced-%d", dbDir, time.Now().Unix())
+
+		// The lock file moves away together with the replaced database, the lock stays held
+		err = os.Rename(dbDir, replacedDbDir)
+		if err != nil {
+			return manifest, err
+		}
+	}
+
+	return manifest, os.Rename(getDatabaseDirPath(tmpDataDir), dbDir)
+}
+
+// validateChain adds the blocks of the data dir to a new State sharing its genesis and upgrade heights.
+func validateChain(dataDir string) error {
+	checkDataDir, err := ioutil.TempDir(dataDir, ".check-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(checkDataDir)
+
+	paths := []func(dataDir string) string{getGenesisJsonFilePath, getVersionJsonFilePath, getUpgradesJsonFilePath}
+	err = copyDatabaseFiles(dataDir, checkDataDir, paths)
+	if err != nil {
+		return err
+	}
+
+	err = writeEmptyBlocksDbToDisk(getBlocksDbFilePath(checkDataDir))
+	if err != nil {
+		return err
+	}
+
+	state, err := NewStateFromDisk(checkDataDir)
+	if err != nil {
+		return err
+	}
+
+	err = ForEachBlock(dataDir, func(blockFs BlockFS) error {
+		hash, err := state.AddBlock(blockFs.Value)
+		if err != nil {
+			return fmt.Errorf("invalid block %d. %s", blockFs.Value.Header.Number, err.Error())
+		}
+
+		if hash != blockFs.Key {
+			return fmt.Errorf("block %d hash is '%s' but it's stored as '%s'", blockFs.Value.Header.Number, hash.Hex(), blockFs.Key.Hex())
+		}
+
+		return nil
+	})
+	if err != nil {
+		state.Close()
+		return err
+	}
+
+	return state.Close()
+}
+
+// backupFileNames returns the names of the database files to archive, leaving out the lock
+// and the leftovers of upgrades such as 'block.db.v0.bak'.
+func backupFileNames(dataDir string) []string {
+	names := make([]string, 0, len(databaseFilePaths))
+	for _, path := range databaseFilePaths {
+		if fileExist(path(dataDir)) {
+			names = append(names, filepath.Base(path(dataDir)))
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func backupFile(tw *tar.Writer, dataDir string, name string) (BackupFile, error) {
+	filePath := filepath.Join(getDatabaseDirPath(dataDir), name)
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return BackupFile{}, err
+	}
+
+	size := info.Size()
+	if filePath == getBlocksDbFilePath(dataDir) {
+		size, err = lastCompleteLineEnd(f, size)
+		if err != nil {
+			return BackupFile{}, err
+		}
+	}
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    path.Join("database", name),
+		Mode:    0600,
+		Size:    size,
+		ModTime: info.ModTime(),
+	})
+	if err != nil {
+		return BackupFile{}, err
+	}
+
+	checksum := sha256.New()
+	_, err = io.CopyN(io.MultiWriter(tw, checksum), f, size)
+	if err != nil {
+		return BackupFile{}, err
+	}
+
+	return BackupFile{name, size, hex.EncodeToString(checksum.Sum(nil))}, nil
+}
+
+// lastCompleteLineEnd returns the offset right after the last new line within the first size bytes of f.
+func lastCompleteLineEnd(f *os.File, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+
+		n, err := f.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		for i := n - 1; i >= 0; i-- {
+			if buf[i] == '\n' {
+				return start + int64(i) + 1, nil
+			}
+		}
+
+		end = start
+	}
+
+	return 0, nil
+}
+
+func extractBackup(archivePath string, dataDir string) (BackupManifest, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return BackupManifest{}, fmt.Errorf("'%s' is not a tbb backup. %s", archivePath, err.Error())
+	}
+	defer gz.Close()
+
+	err = os.MkdirAll(getDatabaseDirPath(dataDir), os.ModePerm)
+	if err != nil {
+		return BackupManifest{}, err
+	}
+
+	var manifest *BackupManifest
+	checksums := make(map[string]hash.Hash)
+	sizes := make(map[string]int64)
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return BackupManifest{}, fmt.Errorf("backup '%s' is corrupted. %s", archivePath, err.Error())
+		}
+
+		if header.Name == backupManifestName {
+			manifest = &BackupManifest{}
+			err = json.NewDecoder(tr).Decode(manifest)
+			if err != nil {
+				return BackupManifest{}, fmt.Errorf("backup '%s' has an unreadable manifest. %s", archivePath, err.Error())
+			}
+			continue
+		}
+
+		dir, name := path.Split(header.Name)
+		if dir != "database/" || name == "" || header.Typeflag != tar.TypeReg {
+			return BackupManifest{}, fmt.Errorf("backup '%s' contains the unexpected entry '%s'", archivePath, header.Name)
+		}
+
+		out, err := os.OpenFile(filepath.Join(getDatabaseDirPath(dataDir), name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return BackupManifest{}, err
+		}
+
+		checksum := sha256.New()
+		size, err := io.Copy(io.MultiWriter(out, checksum), tr)
+		out.Close()
+		if err != nil {
+			return BackupManifest{}, err
+		}
+
+		checksums[name] = checksum
+		sizes[name] = size
+	}
+
+	if manifest == nil {
+		return BackupManifest{}, fmt.Errorf("backup '%s' has no manifest", archivePath)
+	}
+
+	if len(manifest.Files) != len(checksums) {
+		return BackupManifest{}, fmt.Errorf("backup '%s' contains %d files but its manifest lists %d", archivePath, len(checksums), len(manifest.Files))
+	}
+
+	for _, file := range manifest.Files {
+		checksum, ok := checksums[file.Name]
+		if !ok {
+			return BackupManifest{}, fmt.Errorf("backup '%s' is missing '%s'", archivePath, file.Name)
+		}
+
+		if sizes[file.Name] != file.Size || hex.EncodeToString(checksum.Sum(nil)) != file.SHA256 {
+			return BackupManifest{}, fmt.Errorf("backup '%s' is corrupted, '%s' doesn't match its checksum", archivePath, file.Name)
+		}
+	}
+
+	return *manifest, nil
+}
@@ -0,0 +1,332 @@
+package database
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestBackupDataDir returns a data dir holding a chain of two blocks.
+func newTestBackupDataDir(t *testing.T) string {
+	t.Helper()
+
+	dataDir := newTestDataDir(t)
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	for i := uint64(0); i < 2; i++ {
+		_, err = state.AddBlock(NewBlock(state.LatestBlockHash(), i, 1600000000+15*i, []Tx{NewTx("jrhodes", "meads", NewAmount(100), "")}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dataDir
+}
+
+func backupTestDataDir(t *testing.T, dataDir string) string {
+	t.Helper()
+
+	archivePath := filepath.Join(newTestDataDir(t), "backup.tar.gz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, err = Backup(dataDir, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return archivePath
+}
+
+// rewriteTestBackup rewrites every archive entry through change.
+func rewriteTestBackup(t *testing.T, archivePath string, change func(name string, content []byte) []byte) {
+	t.Helper()
+
+	content, err := ioutil.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rewritten bytes.Buffer
+	gzw := gzip.NewWriter(&rewritten)
+	tw := tar.NewWriter(gzw)
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entry, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entry = change(header.Name, entry)
+		header.Size = int64(len(entry))
+
+		err = tw.WriteHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tw.Write(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tw.Close()
+	gzw.Close()
+
+	err = ioutil.WriteFile(archivePath, rewritten.Bytes(), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	dataDir := newTestBackupDataDir(t)
+
+	// A block still being written isn't part of the backup
+	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString(`{"hash":"00`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := backupTestDataDir(t, dataDir)
+
+	restoreDir := filepath.Join(newTestDataDir(t), "restored")
+	manifest, err := Restore(archivePath, restoreDir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.DbVersion != DbVersion || len(manifest.Files) == 0 {
+		t.Errorf("manifest is %+v, expected the current version and the archived files", manifest)
+	}
+
+	original, err := NewStateFromDiskReadOnly(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer original.Close()
+
+	restored, err := NewStateFromDisk(restoreDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	if restored.LatestBlockHash() != original.LatestBlockHash() || restored.Balances["meads"] != original.Balances["meads"] {
+		t.Errorf("restored chain ends at '%x', expected '%x'", restored.LatestBlockHash(), original.LatestBlockHash())
+	}
+}
+
+func TestRestoreReplacesDatabaseOnlyWhenForced(t *testing.T) {
+	archivePath := backupTestDataDir(t, newTestBackupDataDir(t))
+
+	dataDir := newTestDataDir(t)
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Close()
+
+	_, err = Restore(archivePath, dataDir, false)
+	if err == nil || !strings.Contains(err.Error(), "already contains a database") {
+		t.Errorf("expected restoring over a database to require force, got '%v'", err)
+	}
+
+	_, err = Restore(archivePath, dataDir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replaced, err := filepath.Glob(getDatabaseDirPath(dataDir) + ".replaced-*")
+	if err != nil || len(replaced) != 1 {
+		t.Errorf("expected the replaced database to be kept aside, found %v", replaced)
+	}
+
+	state, err = NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if state.LatestBlock().Header.Number != 1 {
+		t.Errorf("latest block is %d, expected the restored chain", state.LatestBlock().Header.Number)
+	}
+}
+
+func TestRestoreRejectsInvalidBackups(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(name string, content []byte) []byte
+		err    string
+	}{
+		{
+			"tampered file",
+			func(name string, content []byte) []byte {
+				if name == "database/block.db" {
+					return bytes.Replace(content, []byte(`"value":100`), []byte(`"value":900`), 1)
+				}
+				return content
+			},
+			"'block.db' doesn't match its checksum",
+		},
+		{
+			"truncated file",
+			func(name string, content []byte) []byte {
+				if name == "database/genesis.json" {
+					return content[:len(content)-1]
+				}
+				return content
+			},
+			"'genesis.json' doesn't match its checksum",
+		},
+		{
+			"no manifest",
+			func(name string, content []byte) []byte {
+				if name == backupManifestName {
+					return []byte("{")
+				}
+				return content
+			},
+			"unreadable manifest",
+		},
+	}
+
+	for _, test := range tests {
+		archivePath := backupTestDataDir(t, newTestBackupDataDir(t))
+		rewriteTestBackup(t, archivePath, test.change)
+
+		restoreDir := filepath.Join(newTestDataDir(t), "restored")
+		_, err := Restore(archivePath, restoreDir, false)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+
+		exists, _ := dirExists(getDatabaseDirPath(restoreDir))
+		if exists {
+			t.Errorf("%s: a rejected backup must not be installed", test.name)
+		}
+	}
+
+	_, err := Restore(filepath.Join("testdata", "missing.tar.gz"), newTestDataDir(t), false)
+	if err == nil {
+		t.Errorf("expected restoring a missing archive to fail")
+	}
+}
+
+func TestBackupOnlyArchivesDatabaseFiles(t *testing.T) {
+	dataDir := newTestBackupDataDir(t)
+
+	for _, name := range []string{"block.db.v0.bak", "notes.txt"} {
+		err := ioutil.WriteFile(filepath.Join(getDatabaseDirPath(dataDir), name), []byte("leftover"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var archive bytes.Buffer
+	manifest, err := Backup(dataDir, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(manifest.Files))
+	for _, file := range manifest.Files {
+		names = append(names, file.Name)
+	}
+
+	expected := "block.db,genesis.json,upgrades.json,version.json"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("archived files are %v, expected %s", names, expected)
+	}
+}
+
+func TestRestoreValidatesTheChain(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  Amount
+		change func(blockFs *BlockFS)
+		err    string
+	}{
+		{"overspending block", NewAmount(1000), func(blockFs *BlockFS) {}, "invalid block 2"},
+		{"block stored under another hash", NewAmount(1), func(blockFs *BlockFS) { blockFs.Key = Hash{0x01} }, "but it's stored as"},
+	}
+
+	for _, test := range tests {
+		dataDir := newTestBackupDataDir(t)
+
+		state, err := NewStateFromDiskReadOnly(dataDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := NewBlock(state.LatestBlockHash(), 2, 1600000030, []Tx{NewTx("meads", "jrhodes", test.value, "")})
+		state.Close()
+
+		// The backup checksums the block as it's stored, only adding the chain to a State tells it's invalid
+		hash, err := b.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		blockFs := BlockFS{hash, b}
+		test.change(&blockFs)
+
+		blockFsJson, err := json.Marshal(blockFs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.Write(append(blockFsJson, '\n'))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		restoreDir := filepath.Join(newTestDataDir(t), "restored")
+		_, err = Restore(backupTestDataDir(t, dataDir), restoreDir, false)
+		if err == nil || !strings.Contains(err.Error(), "doesn't hold a valid chain") || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+
+		entries, err := ioutil.ReadDir(restoreDir)
+		if err != nil || len(entries) != 0 {
+			t.Errorf("%s: a rejected backup must leave nothing behind, found %d entries", test.name, len(entries))
+		}
+	}
+}
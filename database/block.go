@@ -46,6 +46,22 @@ type BlockHeader struct {
 	Parent Hash   `json:"parent"`
 	Number uint64 `json:"number"`
 	Time   uint64 `json:"time"`
+
+	// Blocks of a PoA or PoS chain are signed by their signer, PoW blocks are mined by their miner
+	Signer     Account    `json:"signer,omitempty"`
+	Signature  *Signature `json:"signature,omitempty"`
+	Miner      Account    `json:"miner,omitempty"`
+	Nonce      uint64     `json:"nonce,omitempty"`
+	Difficulty uint64     `json:"difficulty,omitempty"`
+}
+
+// Work is how much the block adds to the cumulative work of its chain, its difficulty or 1 when it has none.
+func (h BlockHeader) Work() uint64 {
+	if h.Difficulty == 0 {
+		return 1
+	}
+
+	return h.Difficulty
 }
 
 type BlockFS struct {
@@ -54,5 +70,5 @@ type BlockFS struct {
 }
 
 func NewBlock(parent Hash, number uint64, time uint64, txs []Tx) Block {
-	return Block{BlockHeader{parent, number,time}, txs}
+	return Block{BlockHeader{Parent: parent, Number: number, Time: time}, txs}
 }
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// medianTimeSpan is the number of latest blocks whose median time a new block must be newer than.
+const medianTimeSpan = 11
+
+// MaxFutureBlockTime is how far ahead of the local clock a block may be dated.
+const MaxFutureBlockTime = 2 * time.Hour
+
+// BlockTimeTooOldError is returned for a block not newer than the median time of the latest blocks.
+type BlockTimeTooOldError struct {
+	Time           uint64
+	MedianTimePast uint64
+}
+
+func (e *BlockTimeTooOldError) Error() string {
+	return fmt.Sprintf("block time '%d' must be greater than the median time '%d' of the latest blocks", e.Time, e.MedianTimePast)
+}
+
+// BlockTimeTooNewError is returned for a block dated too far ahead of the local clock.
+type BlockTimeTooNewError struct {
+	Time    uint64
+	MaxTime uint64
+}
+
+func (e *BlockTimeTooNewError) Error() string {
+	return fmt.Sprintf("block time '%d' is too far in the future, it must not be greater than '%d'", e.Time, e.MaxTime)
+}
+
+// NextBlockTime returns the time a new block should be dated with: now, unless
+// the latest blocks are dated in the future and the block must be newer than them.
+func (s *State) NextBlockTime() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := uint64(time.Now().Unix())
+
+	if len(s.recentBlockTimes) > 0 && now <= s.medianTimePast() {
+		return s.medianTimePast() + 1
+	}
+
+	return now
+}
+
+func (s *State) medianTimePast() uint64 {
+	times := make([]uint64, len(s.recentBlockTimes))
+	copy(times, s.recentBlockTimes)
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	return times[len(times)/2]
+}
+
+func (s *State) trackBlockTime(t uint64) {
+	s.recentBlockTimes = append(s.recentBlockTimes, t)
+
+	if len(s.recentBlockTimes) > medianTimeSpan {
+		s.recentBlockTimes = s.recentBlockTimes[len(s.recentBlockTimes)-medianTimeSpan:]
+	}
+}
+
+func validateBlockTime(b Block, s *State) error {
+	if len(s.recentBlockTimes) > 0 && b.Header.Time <= s.medianTimePast() {
+		return &BlockTimeTooOldError{b.Header.Time, s.medianTimePast()}
+	}
+
+	maxTime := uint64(time.Now().Add(MaxFutureBlockTime).Unix())
+	if b.Header.Time > maxTime {
+		return &BlockTimeTooNewError{b.Header.Time, maxTime}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlockTimeValidation(t *testing.T) {
+	now := uint64(time.Now().Unix())
+	maxFuture := uint64(MaxFutureBlockTime / time.Second)
+
+	tests := []struct {
+		name  string
+		time  func(s *State) uint64
+		valid bool
+		err   interface{}
+	}{
+		{"newer than the latest block", func(s *State) uint64 { return s.LatestBlock().Header.Time + 1 }, true, nil},
+		{"older than the latest block, newer than the median", func(s *State) uint64 { return s.medianTimePast() + 1 }, true, nil},
+		{"equal to the median", func(s *State) uint64 { return s.medianTimePast() }, false, &BlockTimeTooOldError{}},
+		{"older than the median", func(s *State) uint64 { return testBlockTime }, false, &BlockTimeTooOldError{}},
+		{"within the future limit", func(s *State) uint64 { return now + maxFuture - 60 }, true, nil},
+		{"beyond the future limit", func(s *State) uint64 { return now + maxFuture + 60 }, false, &BlockTimeTooNewError{}},
+	}
+
+	for _, test := range tests {
+		s := newTestState(t, testGenesis)
+		for i := 0; i < 2*medianTimeSpan; i++ {
+			addTestBlock(t, s, SealKey{}, NewTx("jrhodes", "meads", 1, ""))
+		}
+
+		b := nextTestBlock(s, NewTx("jrhodes", "meads", 1, ""))
+		b.Header.Time = test.time(s)
+
+		_, err := s.AddBlock(b)
+		if test.valid {
+			if err != nil {
+				t.Errorf("%s: expected the block to be accepted, got '%s'", test.name, err)
+			}
+			continue
+		}
+
+		switch test.err.(type) {
+		case *BlockTimeTooOldError:
+			if _, ok := err.(*BlockTimeTooOldError); !ok {
+				t.Errorf("%s: expected a BlockTimeTooOldError, got '%v'", test.name, err)
+			}
+		case *BlockTimeTooNewError:
+			if _, ok := err.(*BlockTimeTooNewError); !ok {
+				t.Errorf("%s: expected a BlockTimeTooNewError, got '%v'", test.name, err)
+			}
+		}
+	}
+}
+
+func TestMedianTimePastSpansTheLatestBlocks(t *testing.T) {
+	dataDir := newTestDataDir(t)
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2*medianTimeSpan; i++ {
+		addTestBlock(t, s, SealKey{}, NewTx("jrhodes", "meads", 1, ""))
+	}
+
+	// The 11 latest blocks are 11 to 21, the median is block 16
+	expected := testBlockTime + 15*16
+	if s.medianTimePast() != expected {
+		t.Errorf("median time past is %d, expected %d", s.medianTimePast(), expected)
+	}
+
+	s.Close()
+
+	reloaded, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	if reloaded.medianTimePast() != expected {
+		t.Errorf("median time past is %d after reloading the State, expected %d", reloaded.medianTimePast(), expected)
+	}
+}
+
+func TestNextBlockTime(t *testing.T) {
+	s := newTestState(t, testGenesis)
+	now := uint64(time.Now().Unix())
+
+	if s.NextBlockTime() < now {
+		t.Errorf("next block time of an empty chain is %d, expected now", s.NextBlockTime())
+	}
+
+	// Blocks dated ahead of the local clock push the next block time past their median
+	for i := uint64(0); i < 3; i++ {
+		b := nextTestBlock(s, NewTx("jrhodes", "meads", 1, ""))
+		b.Header.Time = now + 600 + i
+
+		_, err := s.AddBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if s.NextBlockTime() != now+601+1 {
+		t.Errorf("next block time is %d, expected right after the median time %d", s.NextBlockTime(), now+601)
+	}
+}
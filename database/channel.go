@@ -0,0 +1,245 @@
+package database
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+const TxTypeChannelOpen TxType = "channel_open"
+const TxTypeChannelClose TxType = "channel_close"
+
+// MaxChannelChallengePeriod bounds how many blocks a closing channel can keep its deposit locked.
+const MaxChannelChallengePeriod = 10000
+
+// Channel is a unidirectional payment channel. Its payer locks a deposit on-chain and pays the payee
+// off-chain with ChannelUpdates, signed by the channel key, carrying the total paid so far.
+//
+// Either party closes the channel with the latest update they have. Until the challenge period is over
+// the payee can dispute a close with an update paying more, then the deposit is split by the best update.
+type Channel struct {
+	ID              Hash      `json:"id"`
+	From            Account   `json:"from"`
+	To              Account   `json:"to"`
+	Deposit         Amount    `json:"deposit"`
+	Asset           AssetID   `json:"asset"`
+	PublicKey       PublicKey `json:"public_key"`
+	ChallengePeriod uint64    `json:"challenge_period"`
+	BlockNumber     uint64    `json:"block_number"`
+
+	Closing      bool   `json:"closing"`
+	ClosingBlock uint64 `json:"closing_block,omitempty"`
+	Paid         Amount `json:"paid"`
+}
+
+// ChannelUpdate is an off-chain payment, Paid is the total owed to the payee, not an increment.
+type ChannelUpdate struct {
+	Channel   Hash       `json:"channel"`
+	Paid      Amount     `json:"paid"`
+	Signature *Signature `json:"signature,omitempty"`
+}
+
+// NewChannelOpenTx locks value of an asset into a channel paying to, with updates signed by the public key.
+func NewChannelOpenTx(from Account, to Account, value Amount, asset AssetID, publicKey PublicKey, challengePeriod uint64) Tx {
+	return Tx{From: from, To: to, Value: value, Asset: asset, Type: TxTypeChannelOpen, ChannelKey: &publicKey, ChallengePeriod: challengePeriod}
+}
+
+// NewChannelCloseTx closes a channel, or disputes its closing, with an update.
+func NewChannelCloseTx(from Account, update ChannelUpdate) Tx {
+	return Tx{From: from, Type: TxTypeChannelClose, ChannelUpdate: &update}
+}
+
+func (u ChannelUpdate) SigningHash() (Hash, error) {
+	unsigned := u
+	unsigned.Signature = nil
+
+	updateJson, err := json.Marshal(unsigned)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return sha256.Sum256(updateJson), nil
+}
+
+func (u ChannelUpdate) Sign(privateKey ed25519.PrivateKey) (ChannelUpdate, error) {
+	signingHash, err := u.SigningHash()
+	if err != nil {
+		return ChannelUpdate{}, err
+	}
+
+	var sig Signature
+	copy(sig[:], ed25519.Sign(privateKey, signingHash[:]))
+	u.Signature = &sig
+
+	return u, nil
+}
+
+func (s *State) Channel(id Hash) (Channel, bool) {
+	channel, ok := s.channels[id]
+
+	return channel, ok
+}
+
+// Channels returns the open and closing channels, ordered by the block they were opened in.
+func (s *State) Channels() []Channel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	channels := make([]Channel, 0, len(s.channels))
+	for _, channel := range s.channels {
+		channels = append(channels, channel)
+	}
+
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].BlockNumber != channels[j].BlockNumber {
+			return channels[i].BlockNumber < channels[j].BlockNumber
+		}
+
+		return channels[i].ID.Hex() < channels[j].ID.Hex()
+	})
+
+	return channels
+}
+
+func applyChannelOpen(tx Tx, s *State) error {
+	if tx.IsTimeLocked() {
+		return fmt.Errorf("bad TX. Channel TXs can't be time-locked")
+	}
+
+	if tx.ChannelKey == nil {
+		return fmt.Errorf("bad TX. Opening a channel requires the public key signing its updates")
+	}
+
+	if tx.To == "" || tx.To == tx.From {
+		return fmt.Errorf("bad TX. A channel requires a payee other than its payer")
+	}
+
+	if tx.ChallengePeriod == 0 || tx.ChallengePeriod > MaxChannelChallengePeriod {
+		return fmt.Errorf("bad TX. Channel challenge period must be between 1 and %d blocks", MaxChannelChallengePeriod)
+	}
+
+	id, err := channelID(tx, s.NextBlockNumber())
+	if err != nil {
+		return err
+	}
+
+	if _, exists := s.channels[id]; exists {
+		return fmt.Errorf("bad TX. Channel '%s' is already open", id.Hex())
+	}
+
+	err = s.debit(tx.From, tx.AssetID(), tx.Value)
+	if err != nil {
+		return err
+	}
+
+	s.channels[id] = Channel{
+		ID:              id,
+		From:            tx.From,
+		To:              tx.To,
+		Deposit:         tx.Value,
+		Asset:           tx.AssetID(),
+		PublicKey:       *tx.ChannelKey,
+		ChallengePeriod: tx.ChallengePeriod,
+		BlockNumber:     s.NextBlockNumber(),
+	}
+
+	return nil
+}
+
+// channelID derives the ID of a channel from its open TX and block number. Identical open TXs, such as
+// a channel reopened once the previous one settled, get distinct IDs so older updates can't close them.
+func channelID(tx Tx, number uint64) (Hash, error) {
+	txHash, err := tx.Hash()
+	if err != nil {
+		return Hash{}, err
+	}
+
+	var numberBytes [8]byte
+	binary.BigEndian.PutUint64(numberBytes[:], number)
+
+	return sha256.Sum256(append(txHash[:], numberBytes[:]...)), nil
+}
+
+func applyChannelClose(tx Tx, s *State) error {
+	if tx.IsTimeLocked() {
+		return fmt.Errorf("bad TX. Channel TXs can't be time-locked")
+	}
+
+	if tx.Value != 0 {
+		return fmt.Errorf("bad TX. Closing a channel doesn't transfer any value")
+	}
+
+	if tx.ChannelUpdate == nil {
+		return fmt.Errorf("bad TX. Closing a channel requires a channel update")
+	}
+
+	update := *tx.ChannelUpdate
+	channel, ok := s.channels[update.Channel]
+	if !ok {
+		return fmt.Errorf("bad TX. Channel '%s' isn't open", update.Channel.Hex())
+	}
+
+	if tx.From != channel.From && tx.From != channel.To {
+		return fmt.Errorf("bad TX. Channel '%s' can only be closed by '%s' or '%s'", channel.ID.Hex(), channel.From, channel.To)
+	}
+
+	if update.Paid > channel.Deposit {
+		return fmt.Errorf("bad TX. Channel update pays %s, the deposit is %s", update.Paid, channel.Deposit)
+	}
+
+	// Paying nothing needs no signature, the payer can always close a channel it never paid with
+	if update.Paid > 0 {
+		signingHash, err := update.SigningHash()
+		if err != nil {
+			return err
+		}
+
+		if update.Signature == nil || !ed25519.Verify(channel.PublicKey[:], signingHash[:], update.Signature[:]) {
+			return fmt.Errorf("bad TX. Channel update isn't signed by the channel key")
+		}
+	}
+
+	if channel.Closing {
+		if s.NextBlockNumber() >= channel.ClosingBlock+channel.ChallengePeriod {
+			return fmt.Errorf("bad TX. Channel '%s' challenge period is over", channel.ID.Hex())
+		}
+
+		if update.Paid <= channel.Paid {
+			return fmt.Errorf("bad TX. Disputing channel '%s' requires an update paying more than %s", channel.ID.Hex(), channel.Paid)
+		}
+	} else {
+		channel.Closing = true
+		channel.ClosingBlock = s.NextBlockNumber()
+	}
+
+	channel.Paid = update.Paid
+	s.channels[channel.ID] = channel
+
+	return nil
+}
+
+// settleChannels splits the deposit of the channels whose challenge period ends with the block.
+func settleChannels(header BlockHeader, s *State) error {
+	for _, channel := range s.Channels() {
+		if !channel.Closing || header.Number < channel.ClosingBlock+channel.ChallengePeriod {
+			continue
+		}
+
+		err := s.creditAsset(channel.To, channel.Asset, channel.Paid)
+		if err != nil {
+			return err
+		}
+
+		err = s.creditAsset(channel.From, channel.Asset, channel.Deposit-channel.Paid)
+		if err != nil {
+			return err
+		}
+
+		delete(s.channels, channel.ID)
+	}
+
+	return nil
+}
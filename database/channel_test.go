@@ -0,0 +1,158 @@
+package database
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+)
+
+func signTestChannelUpdate(t *testing.T, key ed25519.PrivateKey, channel Hash, paid Amount) ChannelUpdate {
+	t.Helper()
+
+	update, err := ChannelUpdate{Channel: channel, Paid: paid}.Sign(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return update
+}
+
+func TestChannelCloseAndChallenge(t *testing.T) {
+	publicKey, key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, strangerKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	open := NewChannelOpenTx("jrhodes", "meads", NewAmount(100), NativeAsset, publicKey, 2)
+	id, err := channelID(open, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closeTx := func(from Account, paid Amount) Tx {
+		return NewChannelCloseTx(from, signTestChannelUpdate(t, key, id, paid))
+	}
+
+	tests := []struct {
+		name   string
+		blocks [][]Tx
+		err    string
+		// balances once the challenge period of the last close is over
+		payer Amount
+		payee Amount
+	}{
+		{"payer closes without paying", [][]Tx{{open}, {NewChannelCloseTx("jrhodes", ChannelUpdate{Channel: id})}}, "", NewAmount(1000000), 0},
+		{"payee closes with the latest update", [][]Tx{{open}, {closeTx("meads", NewAmount(30))}}, "", NewAmount(999970), NewAmount(30)},
+		{"payee disputes a stale close", [][]Tx{{open}, {closeTx("jrhodes", NewAmount(10))}, {closeTx("meads", NewAmount(40))}}, "", NewAmount(999960), NewAmount(40)},
+		{"dispute paying less", [][]Tx{{open}, {closeTx("meads", NewAmount(40))}, {closeTx("jrhodes", NewAmount(10))}}, "requires an update paying more than 40 TBB", NewAmount(999960), NewAmount(40)},
+		{"dispute after the challenge period", [][]Tx{{open}, {closeTx("jrhodes", NewAmount(10))}, {}, {closeTx("meads", NewAmount(40))}}, "challenge period is over", NewAmount(999990), NewAmount(10)},
+		{"update over the deposit", [][]Tx{{open}, {closeTx("meads", NewAmount(101))}}, "the deposit is 100 TBB", NewAmount(999900), 0},
+		{"unsigned update", [][]Tx{{open}, {NewChannelCloseTx("meads", ChannelUpdate{Channel: id, Paid: NewAmount(10)})}}, "isn't signed by the channel key", NewAmount(999900), 0},
+		{"update signed by another key", [][]Tx{{open}, {NewChannelCloseTx("meads", signTestChannelUpdate(t, strangerKey, id, NewAmount(10)))}}, "isn't signed by the channel key", NewAmount(999900), 0},
+		{"close by a stranger", [][]Tx{{open}, {closeTx("lhendricks", NewAmount(10))}}, "can only be closed by 'jrhodes' or 'meads'", NewAmount(999900), 0},
+		{"close of an unknown channel", [][]Tx{{NewChannelCloseTx("jrhodes", ChannelUpdate{Channel: id})}}, "isn't open", NewAmount(1000000), 0},
+		{"open without a payee", [][]Tx{{NewChannelOpenTx("jrhodes", "jrhodes", NewAmount(100), NativeAsset, publicKey, 2)}}, "requires a payee other than its payer", NewAmount(1000000), 0},
+		{"open without a challenge period", [][]Tx{{NewChannelOpenTx("jrhodes", "meads", NewAmount(100), NativeAsset, publicKey, 0)}}, "challenge period must be between 1 and", NewAmount(1000000), 0},
+		{"open over the balance", [][]Tx{{NewChannelOpenTx("jrhodes", "meads", NewAmount(1000001), NativeAsset, publicKey, 2)}}, "Tx cost is 1000001 TBB", NewAmount(1000000), 0},
+	}
+
+	for _, test := range tests {
+		s := newTestState(t, testGenesis)
+
+		for _, txs := range test.blocks {
+			_, err = s.AddBlock(nextTestBlock(s, txs...))
+			if err != nil {
+				break
+			}
+		}
+
+		if test.err == "" && err != nil {
+			t.Errorf("%s: expected every block to be accepted, got '%s'", test.name, err)
+		}
+
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+
+		for s.NextBlockNumber() < 6 {
+			addTestBlock(t, s, SealKey{})
+		}
+
+		if s.Balances["jrhodes"] != test.payer || s.Balances["meads"] != test.payee {
+			t.Errorf("%s: jrhodes holds %s and meads %s, expected %s and %s", test.name, s.Balances["jrhodes"], s.Balances["meads"], test.payer, test.payee)
+		}
+	}
+}
+
+func TestChannelSettlesAfterTheChallengePeriod(t *testing.T) {
+	publicKey, key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestState(t, testGenesis)
+	open := NewChannelOpenTx("jrhodes", "meads", NewAmount(100), NativeAsset, publicKey, 3)
+	addTestBlock(t, s, SealKey{}, open)
+	id := s.Channels()[0].ID
+
+	addTestBlock(t, s, SealKey{}, NewChannelCloseTx("meads", signTestChannelUpdate(t, key, id, NewAmount(25))))
+
+	channel, ok := s.Channel(id)
+	if !ok || !channel.Closing || channel.ClosingBlock != 1 || channel.Paid != NewAmount(25) {
+		t.Fatalf("channel is %+v after the close", channel)
+	}
+
+	// Closed at block 1 with a 3 blocks challenge period, the deposit is split by block 4
+	for s.NextBlockNumber() < 4 {
+		addTestBlock(t, s, SealKey{})
+		if _, ok := s.Channel(id); !ok || s.Balances["meads"] != 0 {
+			t.Fatalf("channel settled at block %d, before its challenge period is over", s.LatestBlock().Header.Number)
+		}
+	}
+
+	addTestBlock(t, s, SealKey{})
+	if _, ok := s.Channel(id); ok || s.Balances["meads"] != NewAmount(25) || s.Balances["jrhodes"] != NewAmount(999975) {
+		t.Errorf("expected the channel to settle at block 4, meads holds %s", s.Balances["meads"])
+	}
+}
+
+func TestIdenticalChannelsGetDistinctIDs(t *testing.T) {
+	publicKey, key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestState(t, testGenesis)
+	open := NewChannelOpenTx("jrhodes", "meads", NewAmount(100), NativeAsset, publicKey, 1)
+
+	_, err = s.AddBlock(nextTestBlock(s, open, open))
+	if err == nil || !strings.Contains(err.Error(), "is already open") {
+		t.Errorf("expected a second identical channel in the same block to be rejected, got '%v'", err)
+	}
+
+	addTestBlock(t, s, SealKey{}, open)
+	first := s.Channels()[0].ID
+	stale := signTestChannelUpdate(t, key, first, NewAmount(60))
+	addTestBlock(t, s, SealKey{}, NewChannelCloseTx("meads", stale))
+	addTestBlock(t, s, SealKey{})
+
+	if len(s.Channels()) != 0 || s.Balances["meads"] != NewAmount(60) {
+		t.Fatalf("expected the first channel to settle, meads holds %s", s.Balances["meads"])
+	}
+
+	addTestBlock(t, s, SealKey{}, open)
+	channels := s.Channels()
+	if len(channels) != 1 || channels[0].ID == first {
+		t.Fatalf("expected the reopened channel to get a new ID, channels are %+v", channels)
+	}
+
+	// The payee can't close the new channel with an update of the first one
+	_, err = s.AddBlock(nextTestBlock(s, NewChannelCloseTx("meads", stale)))
+	if err == nil || !strings.Contains(err.Error(), "isn't open") {
+		t.Errorf("expected an update of the settled channel to be rejected, got '%v'", err)
+	}
+}
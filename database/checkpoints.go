@@ -0,0 +1,153 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Checkpoint declares the block with the given number and hash final,
+// no chain conflicting with it is ever accepted and the node never reorgs below it.
+type Checkpoint struct {
+	Number uint64 `json:"number"`
+	Hash   Hash   `json:"hash"`
+}
+
+// CheckpointMismatchError is returned for a block conflicting with a checkpoint.
+type CheckpointMismatchError struct {
+	Number   uint64
+	Expected Hash
+	Actual   Hash
+}
+
+func (e *CheckpointMismatchError) Error() string {
+	return fmt.Sprintf("block %d must be the checkpoint '%s' not '%s'", e.Number, e.Expected.Hex(), e.Actual.Hex())
+}
+
+// ParseCheckpoint parses a checkpoint written as 'number:hash'.
+func ParseCheckpoint(raw string) (Checkpoint, error) {
+	parts := strings.SplitN(raw, ":", 2)
+	if len(parts) != 2 {
+		return Checkpoint{}, fmt.Errorf("checkpoint '%s' must be written as 'number:hash'", raw)
+	}
+
+	number, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return Checkpoint{}, fmt.Errorf("invalid checkpoint number '%s'", parts[0])
+	}
+
+	// A truncated hash would decode as a hash padded with zeros
+	var hash Hash
+	err = hash.UnmarshalText([]byte(parts[1]))
+	if err != nil || len(parts[1]) != 2*len(hash) {
+		return Checkpoint{}, fmt.Errorf("invalid checkpoint hash '%s'", parts[1])
+	}
+
+	return Checkpoint{Number: number, Hash: hash}, nil
+}
+
+// AddCheckpoint declares a block final on top of the genesis checkpoints.
+// The block must not conflict with the chain already stored on disk.
+func (s *State) AddCheckpoint(cp Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if expected, ok := s.checkpoints[cp.Number]; ok && expected != cp.Hash {
+		return fmt.Errorf("checkpoint %d conflicts with the genesis checkpoint '%s'", cp.Number, expected.Hex())
+	}
+
+	if s.hasGenesisBlock && cp.Number <= s.latestBlock.Header.Number {
+		found := false
+		err := ForEachBlock(s.dataDir, func(blockFs BlockFS) error {
+			if blockFs.Value.Header.Number != cp.Number {
+				return nil
+			}
+
+			found = true
+			if blockFs.Key != cp.Hash {
+				return &CheckpointMismatchError{Number: cp.Number, Expected: cp.Hash, Actual: blockFs.Key}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return fmt.Errorf("checkpoint block %d isn't stored on disk", cp.Number)
+		}
+	}
+
+	s.checkpoints[cp.Number] = cp.Hash
+
+	return nil
+}
+
+// Checkpoints returns the checkpoints, sorted by block number.
+func (s *State) Checkpoints() []Checkpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	checkpoints := make([]Checkpoint, 0, len(s.checkpoints))
+	for number, hash := range s.checkpoints {
+		checkpoints = append(checkpoints, Checkpoint{Number: number, Hash: hash})
+	}
+
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].Number < checkpoints[j].Number
+	})
+
+	return checkpoints
+}
+
+// LatestFinalized returns the latest checkpoint the chain already reached.
+func (s *State) LatestFinalized() (Checkpoint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.latestFinalized()
+}
+
+func (s *State) latestFinalized() (Checkpoint, bool) {
+	finalized, ok := Checkpoint{}, false
+	if !s.hasGenesisBlock {
+		return finalized, ok
+	}
+
+	for number, hash := range s.checkpoints {
+		if number <= s.latestBlock.Header.Number && (!ok || number > finalized.Number) {
+			finalized, ok = Checkpoint{Number: number, Hash: hash}, true
+		}
+	}
+
+	return finalized, ok
+}
+
+// verifyBlockCheckpoint verifies the block is the checkpoint declared at its number, if any.
+func verifyBlockCheckpoint(b Block, s *State) error {
+	if _, ok := s.checkpoints[b.Header.Number]; !ok {
+		return nil
+	}
+
+	hash, err := b.Hash()
+	if err != nil {
+		return err
+	}
+
+	return s.VerifyCheckpoint(b.Header.Number, hash)
+}
+
+// VerifyCheckpoint verifies the block with the given number and hash doesn't conflict with a checkpoint.
+func (s *State) VerifyCheckpoint(number uint64, hash Hash) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expected, ok := s.checkpoints[number]
+	if ok && expected != hash {
+		return &CheckpointMismatchError{Number: number, Expected: expected, Actual: hash}
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newCheckpointTestState(t *testing.T, checkpoints map[uint64]Hash) *State {
+	t.Helper()
+
+	gen := genesis{Balances: map[Account]Amount{"jrhodes": NewAmount(1000000)}, Checkpoints: checkpoints}
+
+	genesisJson, err := json.Marshal(gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestState(t, string(genesisJson))
+}
+
+func TestParseCheckpoint(t *testing.T) {
+	hash := Hash{0xab, 0xcd}
+
+	tests := []struct {
+		raw      string
+		expected Checkpoint
+		err      string
+	}{
+		{"100:" + hash.Hex(), Checkpoint{Number: 100, Hash: hash}, ""},
+		{"0:" + Hash{}.Hex(), Checkpoint{}, ""},
+		{"100", Checkpoint{}, "must be written as 'number:hash'"},
+		{"-1:" + hash.Hex(), Checkpoint{}, "invalid checkpoint number '-1'"},
+		{"ten:" + hash.Hex(), Checkpoint{}, "invalid checkpoint number 'ten'"},
+		{"100:abcd", Checkpoint{}, "invalid checkpoint hash 'abcd'"},
+		{"100:" + hash.Hex() + ":1", Checkpoint{}, "invalid checkpoint hash"},
+	}
+
+	for _, test := range tests {
+		cp, err := ParseCheckpoint(test.raw)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("ParseCheckpoint(%q) returned '%v', expected an error containing '%s'", test.raw, err, test.err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("ParseCheckpoint(%q) failed: %s", test.raw, err)
+			continue
+		}
+
+		if cp != test.expected {
+			t.Errorf("ParseCheckpoint(%q) = %+v, expected %+v", test.raw, cp, test.expected)
+		}
+	}
+}
+
+func TestGenesisCheckpointRejectsConflictingBlocks(t *testing.T) {
+	// Another node builds the chain the checkpoint declares final
+	builder := newTestState(t, testGenesis)
+	first := addTestBlock(t, builder, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+	final := addTestBlock(t, builder, SealKey{}, NewTx("jrhodes", "meads", NewAmount(2), ""))
+
+	state := newCheckpointTestState(t, map[uint64]Hash{1: hashOf(t, final)})
+
+	_, err := state.AddBlock(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := state.LatestFinalized(); ok {
+		t.Errorf("no block is finalized before the chain reaches the checkpoint")
+	}
+
+	conflicting := nextTestBlock(state, NewTx("jrhodes", "lhendricks", NewAmount(2), ""))
+	_, err = state.AddBlock(conflicting)
+	mismatch, ok := err.(*CheckpointMismatchError)
+	if !ok {
+		t.Fatalf("expected a checkpoint mismatch error, got '%v'", err)
+	}
+
+	if mismatch.Number != 1 || mismatch.Expected != hashOf(t, final) || mismatch.Actual != hashOf(t, conflicting) {
+		t.Errorf("checkpoint mismatch is %+v, expected block 1 to be '%s' not '%s'", mismatch, hashOf(t, final).Hex(), hashOf(t, conflicting).Hex())
+	}
+
+	_, err = state.AddBlock(final)
+	if err != nil {
+		t.Fatalf("adding the checkpoint block failed: %s", err)
+	}
+
+	finalized, ok := state.LatestFinalized()
+	if !ok || finalized != (Checkpoint{Number: 1, Hash: hashOf(t, final)}) {
+		t.Errorf("latest finalized block is %+v, expected the checkpoint block 1", finalized)
+	}
+}
+
+func TestAddCheckpoint(t *testing.T) {
+	genesisCheckpoint := Hash{0x01}
+
+	tests := []struct {
+		name       string
+		checkpoint func(blocks []Block) Checkpoint
+		err        string
+	}{
+		{"stored block", func(blocks []Block) Checkpoint { return Checkpoint{Number: 1, Hash: hashOf(t, blocks[1])} }, ""},
+		{"block ahead of the chain", func(blocks []Block) Checkpoint { return Checkpoint{Number: 10, Hash: Hash{0x02}} }, ""},
+		{"same as the genesis checkpoint", func(blocks []Block) Checkpoint { return Checkpoint{Number: 50, Hash: genesisCheckpoint} }, ""},
+		{"conflicting with a stored block", func(blocks []Block) Checkpoint { return Checkpoint{Number: 1, Hash: hashOf(t, blocks[0])} }, "must be the checkpoint"},
+		{"conflicting with the genesis checkpoint", func(blocks []Block) Checkpoint { return Checkpoint{Number: 50, Hash: Hash{0x02}} }, "conflicts with the genesis checkpoint"},
+	}
+
+	for _, test := range tests {
+		state := newCheckpointTestState(t, map[uint64]Hash{50: genesisCheckpoint})
+
+		blocks := make([]Block, 0)
+		for i := 0; i < 3; i++ {
+			blocks = append(blocks, addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), "")))
+		}
+
+		cp := test.checkpoint(blocks)
+		err := state.AddCheckpoint(cp)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+			}
+
+			if checkpoints := state.Checkpoints(); len(checkpoints) != 1 {
+				t.Errorf("%s: a rejected checkpoint must not be added, the checkpoints are %+v", test.name, checkpoints)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: adding the checkpoint failed: %s", test.name, err)
+			continue
+		}
+
+		if err = state.VerifyCheckpoint(cp.Number, cp.Hash); err != nil {
+			t.Errorf("%s: the added checkpoint doesn't verify: %s", test.name, err)
+		}
+	}
+}
+
+func TestNoReorgBelowFinalizedBlock(t *testing.T) {
+	state := newTestState(t, testGenesis)
+	peer := newTestState(t, testGenesis)
+
+	shared := make([]Block, 0)
+	for i := 0; i < 2; i++ {
+		b := addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+		_, err := peer.AddBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shared = append(shared, b)
+	}
+	addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "lhendricks", NewAmount(1), ""))
+
+	err := state.AddCheckpoint(Checkpoint{Number: 1, Hash: hashOf(t, shared[1])})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A longer branch forking below the finalized block is rejected
+	below := newTestState(t, testGenesis)
+	_, err = below.AddBlock(shared[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := make([]Block, 0)
+	for i := 0; i < 4; i++ {
+		branch = append(branch, addTestBlock(t, below, SealKey{}, NewTx("jrhodes", "babayaga", NewAmount(1), "")))
+	}
+
+	err = state.AddBlocks(branch)
+	if err == nil || !strings.Contains(err.Error(), "forks below the finalized block 1") {
+		t.Errorf("expected a branch forking below the finalized block to be rejected, got '%v'", err)
+	}
+
+	if len(state.Forks()) != 0 || state.ForkStats().Reorgs != 0 || state.LatestBlock().Header.Number != 2 {
+		t.Errorf("a branch forking below the finalized block must neither be retained nor reorged to")
+	}
+
+	// A longer branch forking from the finalized block is still followed
+	branch = []Block{
+		addTestBlock(t, peer, SealKey{}, NewTx("jrhodes", "babayaga", NewAmount(1), "")),
+		addTestBlock(t, peer, SealKey{}, NewTx("jrhodes", "babayaga", NewAmount(1), "")),
+	}
+
+	err = state.AddBlocks(branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.LatestBlockHash() != peer.LatestBlockHash() || state.ForkStats().Reorgs != 1 {
+		t.Errorf("expected a reorg to the branch forking from the finalized block")
+	}
+}
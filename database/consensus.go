@@ -0,0 +1,182 @@
+package database
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+)
+
+// ConsensusInstantSeal is the dev-mode consensus, any node seals a block as soon as it produces it.
+// It's the consensus of a genesis not naming any.
+const ConsensusInstantSeal = "instant"
+
+// Consensus decides which blocks may follow the State tip, how a node produces them and which chain wins a fork.
+//
+// Engines are stateless, what they need to remember (signers, stakes...) lives in the State so it's
+// validated and copied like the rest of it.
+type Consensus interface {
+	Name() string
+	// VerifyHeader verifies the consensus fields of a block following the State tip, including its seal
+	VerifyHeader(b Block, s *State) error
+	// Prepare fills in the consensus fields of a header the node produces
+	Prepare(header *BlockHeader, s *State) error
+	// Seal seals a prepared block with the node key
+	Seal(b Block, s *State, key SealKey) (Block, error)
+	// Finalize applies the consensus effects of a block, such as rewards, once its TXs are applied
+	Finalize(b Block, s *State) error
+	// ForkChoice tells if the peer chain should be preferred over the local one
+	ForkChoice(local ChainHead, peer ChainHead) bool
+}
+
+// SealKey is the account, and its private key, a node seals the blocks it produces as.
+type SealKey struct {
+	Account    Account
+	PrivateKey ed25519.PrivateKey
+}
+
+// ChainHead describes the tip of a chain for the fork choice.
+type ChainHead struct {
+	Hash      Hash   `json:"hash"`
+	Number    uint64 `json:"number"`
+	TotalWork uint64 `json:"total_work"`
+}
+
+func (s *State) Consensus() Consensus {
+	return s.consensus
+}
+
+func newConsensus(gen genesis) (Consensus, error) {
+	var consensus Consensus
+
+	switch gen.Consensus {
+	case "", ConsensusInstantSeal:
+		consensus = instantSealConsensus{}
+	case ConsensusPoW:
+		pow, err := newPowConsensus(gen.Pow)
+		if err != nil {
+			return nil, err
+		}
+		consensus = pow
+	case ConsensusPoA:
+		consensus = poaConsensus{}
+	case ConsensusPoS:
+		consensus = posConsensus{}
+	default:
+		return nil, fmt.Errorf("unknown consensus '%s'", gen.Consensus)
+	}
+
+	if (consensus.Name() == ConsensusPoA) != (len(gen.Signers) > 0) {
+		return nil, fmt.Errorf("genesis must list signers if, and only if, it uses the '%s' consensus", ConsensusPoA)
+	}
+
+	if (consensus.Name() == ConsensusPoS) != (len(gen.Validators) > 0) {
+		return nil, fmt.Errorf("genesis must list validators if, and only if, it uses the '%s' consensus", ConsensusPoS)
+	}
+
+	return consensus, nil
+}
+
+type instantSealConsensus struct{}
+
+func (c instantSealConsensus) Name() string {
+	return ConsensusInstantSeal
+}
+
+func (c instantSealConsensus) VerifyHeader(b Block, s *State) error {
+	err := verifyUnsigned(b, c)
+	if err != nil {
+		return err
+	}
+
+	return verifyUnmined(b, c)
+}
+
+func (c instantSealConsensus) Prepare(header *BlockHeader, s *State) error {
+	return nil
+}
+
+func (c instantSealConsensus) Seal(b Block, s *State, key SealKey) (Block, error) {
+	return b, nil
+}
+
+func (c instantSealConsensus) Finalize(b Block, s *State) error {
+	return nil
+}
+
+func (c instantSealConsensus) ForkChoice(local ChainHead, peer ChainHead) bool {
+	return longestChain(local, peer)
+}
+
+func longestChain(local ChainHead, peer ChainHead) bool {
+	return peer.Number > local.Number
+}
+
+// SigningHash is the hash the signer seals, the block without its signature.
+func (b Block) SigningHash() (Hash, error) {
+	unsigned := b
+	unsigned.Header.Signature = nil
+
+	blockJson, err := json.Marshal(unsigned)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return sha256.Sum256(blockJson), nil
+}
+
+// Sign seals the block with the signature of the key.
+func (b Block) Sign(key SealKey) (Block, error) {
+	b.Header.Signer = key.Account
+	b.Header.Signature = nil
+
+	signingHash, err := b.SigningHash()
+	if err != nil {
+		return Block{}, err
+	}
+
+	var sig Signature
+	copy(sig[:], ed25519.Sign(key.PrivateKey, signingHash[:]))
+	b.Header.Signature = &sig
+
+	return b, nil
+}
+
+func (k SealKey) matches(publicKey PublicKey) bool {
+	return k.PrivateKey != nil && bytes.Equal(publicKey[:], k.PrivateKey.Public().(ed25519.PublicKey))
+}
+
+// verifySignature verifies the block seal is a signature of its signer public key.
+func verifySignature(b Block, publicKey PublicKey) error {
+	if b.Header.Signature == nil {
+		return fmt.Errorf("block isn't sealed by its signer '%s'", b.Header.Signer)
+	}
+
+	signingHash, err := b.SigningHash()
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey[:], signingHash[:], b.Header.Signature[:]) {
+		return fmt.Errorf("block seal isn't a valid signature of its signer '%s'", b.Header.Signer)
+	}
+
+	return nil
+}
+
+func verifyUnsigned(b Block, c Consensus) error {
+	if b.Header.Signer != "" || b.Header.Signature != nil {
+		return fmt.Errorf("block is signed by '%s' but the '%s' consensus doesn't sign blocks", b.Header.Signer, c.Name())
+	}
+
+	return nil
+}
+
+func verifyUnmined(b Block, c Consensus) error {
+	if b.Header.Miner != "" || b.Header.Nonce != 0 || b.Header.Difficulty != 0 {
+		return fmt.Errorf("block is mined by '%s' but the '%s' consensus doesn't mine blocks", b.Header.Miner, c.Name())
+	}
+
+	return nil
+}
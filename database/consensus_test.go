@@ -0,0 +1,91 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInstantSealConsensus(t *testing.T) {
+	for _, genesis := range []string{testGenesis, `{"balances": {"jrhodes": 1000000}, "consensus": "instant"}`} {
+		state := newTestState(t, genesis)
+
+		if name := state.Consensus().Name(); name != ConsensusInstantSeal {
+			t.Fatalf("consensus is '%s', expected '%s'", name, ConsensusInstantSeal)
+		}
+
+		// Any node seals a block right away, without any key
+		b := addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+		if b.Header.Signer != "" || b.Header.Signature != nil || b.Header.Miner != "" {
+			t.Errorf("instant seal must leave the block header untouched, got %+v", b.Header)
+		}
+
+		keys := newTestKeys(t, "alice")
+		signed, err := nextTestBlock(state).Sign(keys["alice"])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = state.AddBlock(signed)
+		if err == nil || !strings.Contains(err.Error(), "the 'instant' consensus doesn't sign blocks") {
+			t.Errorf("expected a signed block to be rejected, got '%v'", err)
+		}
+	}
+}
+
+func TestLongestChainForkChoice(t *testing.T) {
+	consensus := instantSealConsensus{}
+
+	tests := []struct {
+		local    uint64
+		peer     uint64
+		expected bool
+	}{
+		{5, 6, true},
+		{5, 5, false},
+		{5, 4, false},
+	}
+
+	for _, test := range tests {
+		if consensus.ForkChoice(ChainHead{Number: test.local}, ChainHead{Number: test.peer}) != test.expected {
+			t.Errorf("preferring a peer at block %d over the local block %d must be %t", test.peer, test.local, test.expected)
+		}
+	}
+}
+
+func TestGenesisConsensusValidation(t *testing.T) {
+	keys := newTestKeys(t, "alice")
+	signers := map[Account]PublicKey{"alice": publicKeyOf(keys["alice"])}
+	validators := map[Account]GenesisValidator{"alice": {PublicKey: publicKeyOf(keys["alice"]), Stake: NewAmount(10)}}
+
+	tests := []struct {
+		name string
+		gen  genesis
+		err  string
+	}{
+		{"instant seal", genesis{}, ""},
+		{"PoW", genesis{Consensus: ConsensusPoW}, ""},
+		{"PoA", genesis{Consensus: ConsensusPoA, Signers: signers}, ""},
+		{"PoS", genesis{Consensus: ConsensusPoS, Validators: validators}, ""},
+		{"unknown consensus", genesis{Consensus: "pob"}, "unknown consensus 'pob'"},
+		{"PoA without signers", genesis{Consensus: ConsensusPoA}, "must list signers"},
+		{"signers without PoA", genesis{Signers: signers}, "must list signers"},
+		{"PoS without validators", genesis{Consensus: ConsensusPoS}, "must list validators"},
+		{"validators without PoS", genesis{Consensus: ConsensusPoW, Validators: validators}, "must list validators"},
+	}
+
+	for _, test := range tests {
+		consensus, err := newConsensus(test.gen)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: expected a valid consensus, got '%s'", test.name, err)
+			} else if expected := test.gen.Consensus; expected != "" && consensus.Name() != expected {
+				t.Errorf("%s: consensus is '%s', expected '%s'", test.name, consensus.Name(), expected)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+	}
+}
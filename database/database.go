@@ -2,7 +2,10 @@ package database
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"reflect"
 )
@@ -44,3 +47,71 @@ func GetBlocksAfter(blockHash Hash, dataDir string) ([]Block, error) {
 
 	return blocks, nil
 }
+
+// GetBlock returns the persisted block with the given hash.
+func GetBlock(blockHash Hash, dataDir string) (Block, error) {
+	var block Block
+	found := false
+
+	err := ForEachBlock(dataDir, func(blockFs BlockFS) error {
+		if blockFs.Key == blockHash {
+			block = blockFs.Value
+			found = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Block{}, err
+	}
+
+	if !found {
+		return Block{}, fmt.Errorf("block '%s' not found", blockHash.Hex())
+	}
+
+	return block, nil
+}
+
+// ForEachBlock calls fn for every block persisted in the data dir, in chain order.
+//
+// Only the blocks fully written when the call started are visited, which makes it safe
+// to read a consistent copy of the chain while a node keeps appending new blocks.
+func ForEachBlock(dataDir string, fn func(blockFs BlockFS) error) error {
+	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_RDONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(io.LimitReader(f, info.Size()))
+	for {
+		blockFsJson, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A trailing line without a new line is a block still being written
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(bytes.TrimSpace(blockFsJson)) == 0 {
+			continue
+		}
+
+		var blockFs BlockFS
+		err = json.Unmarshal(blockFsJson, &blockFs)
+		if err != nil {
+			return err
+		}
+
+		err = fn(blockFs)
+		if err != nil {
+			return err
+		}
+	}
+}
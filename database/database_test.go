@@ -0,0 +1,185 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestForEachBlockSkipsBlocksStillBeingWritten(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	for i := uint64(0); i < 2; i++ {
+		_, err = state.AddBlock(NewBlock(state.LatestBlockHash(), i, 1600000000+15*i, []Tx{NewTx("jrhodes", "meads", 1, "")}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A block written halfway, without its trailing new line
+	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.WriteString(`{"hash":"00`)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	numbers := make([]uint64, 0)
+	err = ForEachBlock(dataDir, func(blockFs BlockFS) error {
+		numbers = append(numbers, blockFs.Value.Header.Number)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(numbers) != 2 || numbers[0] != 0 || numbers[1] != 1 {
+		t.Errorf("visited blocks %v, expected the two complete blocks", numbers)
+	}
+}
+
+func TestInitDataDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		genesis string
+		err     string
+	}{
+		{"genesis", `{"balances": {"meads": 50}}`, ""},
+		{"invalid genesis", `{"balances": `, "invalid genesis"},
+		{"invalid balance", `{"balances": {"meads": "fifty"}}`, "invalid genesis"},
+	}
+
+	for _, test := range tests {
+		dataDir := newTestDataDir(t)
+
+		err := InitDataDir(dataDir, []byte(test.genesis))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: initializing the data dir failed: %s", test.name, err)
+			continue
+		}
+
+		state, err := NewStateFromDisk(dataDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if state.Balances["meads"] != NewAmount(50) || len(state.Balances) != 1 {
+			t.Errorf("%s: balances are %v, expected the genesis ones", test.name, state.Balances)
+		}
+		state.Close()
+
+		err = InitDataDir(dataDir, []byte(test.genesis))
+		if err == nil || !strings.Contains(err.Error(), "already initialized") {
+			t.Errorf("%s: expected initializing the data dir twice to fail, got '%v'", test.name, err)
+		}
+	}
+}
+
+func TestGetBlocksAfter(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	hashes := make([]Hash, 0)
+	for i := uint64(0); i < 3; i++ {
+		hash, err := state.AddBlock(NewBlock(state.LatestBlockHash(), i, 1600000000+15*i, []Tx{NewTx("jrhodes", "meads", 1, "")}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	blocks, err := GetBlocksAfter(hashes[0], dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocks) != 2 || blocks[0].Header.Number != 1 || blocks[1].Header.Number != 2 {
+		t.Errorf("blocks after block 0 are %+v, expected blocks 1 and 2", blocks)
+	}
+
+	content, err := ioutil.ReadFile(getBlocksDbFilePath(dataDir))
+	if err != nil || strings.Count(string(content), "\n") != 3 {
+		t.Errorf("block.db must hold the three blocks")
+	}
+}
+
+func TestRebuildDataDir(t *testing.T) {
+	state := newTestState(t, testGenesis)
+	dataDir := state.dataDir
+	addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+
+	err := RebuildDataDir(dataDir, nil, func(state *State) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "in use by PID") {
+		t.Errorf("expected rebuilding a data dir in use to be refused, got '%v'", err)
+	}
+
+	err = state.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocksBefore, err := ioutil.ReadFile(getBlocksDbFilePath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A build failing after adding blocks leaves the database as it was
+	err = RebuildDataDir(dataDir, nil, func(state *State) error {
+		_, err := state.AddBlock(nextTestBlock(state, NewTx("jrhodes", "meads", NewAmount(1), "")))
+		if err != nil {
+			return err
+		}
+
+		_, err = state.AddBlock(nextTestBlock(state, NewTx("lhendricks", "meads", NewAmount(1), "")))
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "balance is 0 TBB") {
+		t.Errorf("expected the failing build error, got '%v'", err)
+	}
+
+	blocksAfter, err := ioutil.ReadFile(getBlocksDbFilePath(dataDir))
+	if err != nil || string(blocksAfter) != string(blocksBefore) {
+		t.Errorf("a failed rebuild must leave block.db untouched")
+	}
+
+	err = RebuildDataDir(dataDir, nil, func(state *State) error {
+		_, err := state.AddBlock(nextTestBlock(state, NewTx("jrhodes", "meads", NewAmount(1), "")))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rebuilt, err := NewStateFromDiskReadOnly(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rebuilt.Close()
+
+	if balance := rebuilt.Balances["meads"]; balance != NewAmount(2) {
+		t.Errorf("meads balance is %s after the rebuild, expected 2 TBB", balance)
+	}
+}
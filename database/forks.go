@@ -0,0 +1,375 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// MaxSideBlocks is how many side chain blocks the State retains.
+const MaxSideBlocks = 1024
+
+// SideBlock is a valid block of a branch the chain didn't follow, with the total work of the branch up to it.
+type SideBlock struct {
+	Hash      Hash   `json:"hash"`
+	Block     Block  `json:"block"`
+	TotalWork uint64 `json:"total_work"`
+}
+
+// Fork is a side chain branching off the chain after its fork point block.
+type Fork struct {
+	ForkPoint  Hash      `json:"fork_point"`
+	ForkNumber uint64    `json:"fork_number"`
+	Length     uint64    `json:"length"`
+	Tip        ChainHead `json:"tip"`
+}
+
+// ForkStats counts the chain blocks, side chain blocks, forks and reorgs seen since the State was loaded.
+type ForkStats struct {
+	Blocks            uint64  `json:"blocks"`
+	SideBlocks        uint64  `json:"side_blocks"`
+	Forks             uint64  `json:"forks"`
+	ForksPer100Blocks float64 `json:"forks_per_100_blocks"`
+	LastForkNumber    uint64  `json:"last_fork_number"`
+	LastForkTime      uint64  `json:"last_fork_time"`
+	Reorgs            uint64  `json:"reorgs"`
+}
+
+// Forks returns a branch for every side chain tip, sorted by fork number.
+func (s *State) Forks() []Fork {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	parents := make(map[Hash]bool)
+	for _, side := range s.sideBlocks {
+		parents[side.Block.Header.Parent] = true
+	}
+
+	forks := make([]Fork, 0)
+	for hash, side := range s.sideBlocks {
+		if parents[hash] {
+			continue
+		}
+
+		fork := Fork{Tip: ChainHead{Hash: hash, Number: side.Block.Header.Number, TotalWork: side.TotalWork}}
+
+		first := side.Block
+		for {
+			fork.Length++
+
+			parent, ok := s.sideBlocks[first.Header.Parent]
+			if !ok {
+				break
+			}
+			first = parent.Block
+		}
+
+		fork.ForkPoint = first.Header.Parent
+		fork.ForkNumber = first.Header.Number
+		forks = append(forks, fork)
+	}
+
+	sort.Slice(forks, func(i, j int) bool {
+		if forks[i].ForkNumber != forks[j].ForkNumber {
+			return forks[i].ForkNumber < forks[j].ForkNumber
+		}
+
+		return forks[i].Tip.Hash.Hex() < forks[j].Tip.Hash.Hex()
+	})
+
+	return forks
+}
+
+func (s *State) ForkStats() ForkStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := s.forkStats
+	if received := stats.Blocks + stats.SideBlocks; received > 0 {
+		stats.ForksPer100Blocks = float64(stats.Forks) * 100 / float64(received)
+	}
+
+	return stats
+}
+
+// IsKnownBlock tells if the block is part of the chain or of a side chain.
+func (s *State) IsKnownBlock(hash Hash) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.isKnownBlock(hash)
+}
+
+func (s *State) isKnownBlock(hash Hash) bool {
+	if _, ok := s.sideBlocks[hash]; ok {
+		return true
+	}
+
+	return s.isChainBlock(hash)
+}
+
+func (s *State) isChainBlock(hash Hash) bool {
+	_, ok := s.chainBlocks[hash]
+
+	return ok
+}
+
+// addSideBlock validates a block forking from the chain, or extending a side chain, against the State
+// of its branch and retains it.
+func (s *State) addSideBlock(b Block) error {
+	hash, err := b.Hash()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := s.sideBlocks[hash]; ok {
+		return nil
+	}
+
+	if s.isChainBlock(hash) {
+		return nil
+	}
+
+	if finalized, ok := s.latestFinalized(); ok && b.Header.Number <= finalized.Number {
+		return fmt.Errorf("block %d '%s' forks below the finalized block %d", b.Header.Number, hash.Hex(), finalized.Number)
+	}
+
+	if len(s.sideBlocks) >= MaxSideBlocks {
+		return fmt.Errorf("unable to retain block %d '%s', side chains already hold %d blocks", b.Header.Number, hash.Hex(), MaxSideBlocks)
+	}
+
+	branchState, err := s.branchStateAt(b.Header.Parent)
+	if err != nil {
+		return err
+	}
+
+	_, err = branchState.AddBlock(b)
+	if err != nil {
+		return err
+	}
+
+	_, extendsSideChain := s.sideBlocks[b.Header.Parent]
+
+	s.sideBlocks[hash] = SideBlock{Hash: hash, Block: b, TotalWork: branchState.TotalWork()}
+	s.branchState = branchState
+	s.forkStats.SideBlocks++
+
+	if !extendsSideChain {
+		s.forkStats.Forks++
+		s.forkStats.LastForkNumber = b.Header.Number
+		s.forkStats.LastForkTime = uint64(time.Now().Unix())
+	}
+
+	fmt.Printf("Retaining side chain block %d '%s', its branch total work is %d\n", b.Header.Number, hash.Hex(), branchState.TotalWork())
+
+	// The fork choice compares the work of both branches as computed from their validated blocks
+	local := ChainHead{Hash: s.latestBlockHash, Number: s.latestBlock.Header.Number, TotalWork: s.totalWork}
+	side := ChainHead{Hash: hash, Number: b.Header.Number, TotalWork: branchState.TotalWork()}
+	if !s.consensus.ForkChoice(local, side) {
+		return nil
+	}
+
+	return s.reorg(hash)
+}
+
+// reorg switches the chain to the side chain ending with the given block, whose branch State is cached.
+//
+// The side chain blocks replace the chain blocks after the fork point in a rewritten block.db,
+// and the blocks they replace are retained as side chain blocks in turn.
+func (s *State) reorg(tip Hash) error {
+	if s.dbFile == nil {
+		return fmt.Errorf("unable to reorg to block '%s', the State has no db file", tip.Hex())
+	}
+
+	branchState := s.branchState
+	if branchState == nil || branchState.latestBlockHash != tip {
+		return fmt.Errorf("unable to reorg to block '%s', its branch State isn't known", tip.Hex())
+	}
+
+	branch := make([]SideBlock, 0)
+	forkPoint := tip
+	for {
+		side, ok := s.sideBlocks[forkPoint]
+		if !ok {
+			break
+		}
+
+		branch = append([]SideBlock{side}, branch...)
+		forkPoint = side.Block.Header.Parent
+	}
+
+	if finalized, ok := s.latestFinalized(); ok && branch[0].Block.Header.Number <= finalized.Number {
+		return fmt.Errorf("unable to reorg to block '%s', it forks below the finalized block %d", tip.Hex(), finalized.Number)
+	}
+
+	fmt.Printf("Reorganizing the chain from block %d '%s' to the side chain block %d '%s'\n", s.latestBlock.Header.Number, s.latestBlockHash.Hex(), branch[len(branch)-1].Block.Header.Number, tip.Hex())
+
+	abandoned, err := s.rewriteBlocksDb(forkPoint, branch)
+	if err != nil {
+		return err
+	}
+
+	// The abandoned blocks keep the total work they had on the chain
+	totalWork := s.totalWork
+	for _, blockFs := range abandoned {
+		totalWork -= blockFs.Value.Header.Work()
+	}
+
+	for _, blockFs := range abandoned {
+		totalWork += blockFs.Value.Header.Work()
+		s.sideBlocks[blockFs.Key] = SideBlock{Hash: blockFs.Key, Block: blockFs.Value, TotalWork: totalWork}
+	}
+
+	for _, side := range branch {
+		delete(s.sideBlocks, side.Hash)
+	}
+
+	s.adopt(branchState)
+	s.latestBlock = branchState.latestBlock
+	s.latestBlockHash = branchState.latestBlockHash
+	s.hasGenesisBlock = branchState.hasGenesisBlock
+	s.recentBlockTimes = branchState.recentBlockTimes
+	s.chainBlocks = branchState.chainBlocks
+	s.branchState = nil
+	s.forkStats.Reorgs++
+
+	return nil
+}
+
+// rewriteBlocksDb replaces the blocks after the fork point with the branch and returns the replaced blocks.
+//
+// The new block.db is written aside and renamed over the current one, so it's never left half written.
+func (s *State) rewriteBlocksDb(forkPoint Hash, branch []SideBlock) ([]BlockFS, error) {
+	dbFilePath := getBlocksDbFilePath(s.dataDir)
+
+	tmpFilePath := dbFilePath + ".reorg"
+	tmp, err := os.OpenFile(tmpFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpFilePath)
+
+	abandoned := make([]BlockFS, 0)
+	reachedForkPoint := forkPoint.IsEmpty()
+	err = ForEachBlock(s.dataDir, func(blockFs BlockFS) error {
+		if reachedForkPoint {
+			abandoned = append(abandoned, blockFs)
+			return nil
+		}
+		reachedForkPoint = blockFs.Key == forkPoint
+
+		return writeBlockFs(tmp, blockFs)
+	})
+	if err == nil && !reachedForkPoint {
+		err = fmt.Errorf("fork point '%s' isn't part of the chain", forkPoint.Hex())
+	}
+
+	for _, side := range branch {
+		if err != nil {
+			break
+		}
+		err = writeBlockFs(tmp, BlockFS{side.Hash, side.Block})
+	}
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+	if closeErr != nil {
+		return nil, closeErr
+	}
+
+	err = s.dbFile.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.Rename(tmpFilePath, dbFilePath)
+
+	// The db file is reopened even if the rename failed, the State keeps appending to the current block.db then
+	f, openErr := os.OpenFile(dbFilePath, os.O_APPEND|os.O_RDWR, 0600)
+	if openErr != nil {
+		return nil, openErr
+	}
+	s.dbFile = f
+
+	if err != nil {
+		return nil, err
+	}
+
+	return abandoned, nil
+}
+
+func writeBlockFs(f *os.File, blockFs BlockFS) error {
+	blockFsJson, err := json.Marshal(blockFs)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(blockFsJson, '\n'))
+
+	return err
+}
+
+// branchStateAt rebuilds the State at the given block of the chain or of a side chain,
+// replaying the chain from disk up to the fork point and then the side chain blocks.
+//
+// The State of the latest side chain block is kept, so a branch growing block by block isn't replayed every time.
+func (s *State) branchStateAt(parent Hash) (*State, error) {
+	if s.branchState != nil && s.branchState.latestBlockHash == parent {
+		return s.branchState, nil
+	}
+
+	branch := make([]Block, 0)
+	forkPoint := parent
+	for {
+		side, ok := s.sideBlocks[forkPoint]
+		if !ok {
+			break
+		}
+
+		branch = append([]Block{side.Block}, branch...)
+		forkPoint = side.Block.Header.Parent
+	}
+
+	// The State is neither read-only nor backed by a db file, its blocks only live in memory
+	state, err := loadGenesisState(s.dataDir, false)
+	if err != nil {
+		return nil, err
+	}
+	state.checkpoints = s.checkpoints
+
+	if !forkPoint.IsEmpty() {
+		found := false
+		err = ForEachBlock(s.dataDir, func(blockFs BlockFS) error {
+			if found {
+				return nil
+			}
+			found = blockFs.Key == forkPoint
+
+			return state.replayBlock(blockFs)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			return nil, fmt.Errorf("fork point '%s' isn't part of the chain", forkPoint.Hex())
+		}
+	}
+
+	for _, b := range branch {
+		_, err = state.AddBlock(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
@@ -0,0 +1,299 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+// chainHashes returns the hashes of the blocks in block.db, in order.
+func chainHashes(t *testing.T, s *State) []Hash {
+	t.Helper()
+
+	hashes := make([]Hash, 0)
+	err := ForEachBlock(s.dataDir, func(blockFs BlockFS) error {
+		hashes = append(hashes, blockFs.Key)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hashes
+}
+
+func TestReorgToLongerSideChain(t *testing.T) {
+	state := newTestState(t, testGenesis)
+	peer := newTestState(t, testGenesis)
+
+	// Both nodes share the first two blocks, then each extends its own branch
+	for i := 0; i < 2; i++ {
+		b := addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+		_, err := peer.AddBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	forkPoint := state.LatestBlockHash()
+
+	abandoned := addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "lhendricks", NewAmount(100), ""))
+
+	branch := []Block{
+		addTestBlock(t, peer, SealKey{}, NewTx("jrhodes", "babayaga", NewAmount(10), "")),
+		addTestBlock(t, peer, SealKey{}, NewTx("babayaga", "meads", NewAmount(3), "")),
+	}
+
+	// A branch as long as the chain is only retained
+	err := state.AddBlocks(branch[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.LatestBlockHash() != hashOf(t, abandoned) || state.ForkStats().Reorgs != 0 {
+		t.Fatalf("a side chain as long as the chain must not trigger a reorg")
+	}
+
+	err = state.AddBlocks(branch[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.LatestBlockHash() != peer.LatestBlockHash() {
+		t.Errorf("tip is '%s', expected the side chain tip '%s'", state.LatestBlockHash().Hex(), peer.LatestBlockHash().Hex())
+	}
+
+	if stats := state.ForkStats(); stats.Reorgs != 1 || stats.Forks != 1 {
+		t.Errorf("fork stats are %+v, expected 1 fork and 1 reorg", stats)
+	}
+
+	// block.db holds the same chain as the peer
+	hashes, peerHashes := chainHashes(t, state), chainHashes(t, peer)
+	if len(hashes) != len(peerHashes) {
+		t.Fatalf("block.db holds %d blocks, expected %d", len(hashes), len(peerHashes))
+	}
+	for i := range hashes {
+		if hashes[i] != peerHashes[i] {
+			t.Errorf("block %d is '%s' in block.db, expected '%s'", i, hashes[i].Hex(), peerHashes[i].Hex())
+		}
+	}
+
+	for _, account := range []Account{"jrhodes", "meads", "lhendricks", "babayaga"} {
+		if state.Balances[account] != peer.Balances[account] {
+			t.Errorf("'%s' balance is %s after the reorg, expected %s", account, state.Balances[account], peer.Balances[account])
+		}
+	}
+
+	// The replaced block became a side chain
+	forks := state.Forks()
+	if len(forks) != 1 || forks[0].Tip.Hash != hashOf(t, abandoned) || forks[0].ForkPoint != forkPoint || forks[0].Length != 1 {
+		t.Errorf("forks are %+v, expected the replaced block forking from '%s'", forks, forkPoint.Hex())
+	}
+
+	if !state.IsKnownBlock(hashOf(t, abandoned)) {
+		t.Errorf("the replaced block must still be known")
+	}
+
+	// The chain keeps growing from the new tip
+	addTestBlock(t, state, SealKey{}, NewTx("meads", "jrhodes", NewAmount(1), ""))
+
+	// And reloads from the rewritten block.db
+	err = state.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewStateFromDisk(state.dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	if reloaded.LatestBlockHash() != state.LatestBlockHash() || reloaded.Balances["babayaga"] != NewAmount(7) {
+		t.Errorf("the reloaded State doesn't match the chain after the reorg")
+	}
+}
+
+func TestReorgToMostWork(t *testing.T) {
+	config := PowConfig{Difficulty: 4, RetargetInterval: 2, TargetBlockTime: 15}
+	state := newPowTestState(t, config)
+	peer := newPowTestState(t, config)
+
+	first := mineTestBlock(t, state, testBlockTime)
+	for _, s := range []*State{state, peer} {
+		_, err := s.AddBlock(first)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The chain is mined on target, its difficulty never changes
+	for i := uint64(1); i <= 4; i++ {
+		_, err := state.AddBlock(mineTestBlock(t, state, testBlockTime+15*i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The peer mines faster, so its difficulty goes up and its shorter branch holds more work
+	branch := make([]Block, 0)
+	for i := uint64(1); i <= 3; i++ {
+		b := mineTestBlock(t, peer, testBlockTime+i)
+		_, err := peer.AddBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		branch = append(branch, b)
+	}
+
+	if state.TotalWork() != 5*4 || peer.TotalWork() != 3*4+17 {
+		t.Fatalf("total work is %d and %d on the peer, expected %d and %d", state.TotalWork(), peer.TotalWork(), 5*4, 3*4+17)
+	}
+
+	err := state.AddBlocks(branch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.LatestBlockHash() != peer.LatestBlockHash() || state.TotalWork() != peer.TotalWork() {
+		t.Errorf("tip is block %d with a total work of %d, expected the shorter branch with the most work", state.LatestBlock().Header.Number, state.TotalWork())
+	}
+
+	if hashes := chainHashes(t, state); len(hashes) != 4 {
+		t.Errorf("block.db holds %d blocks, expected 4", len(hashes))
+	}
+
+	forks := state.Forks()
+	if len(forks) != 1 || forks[0].Length != 4 || forks[0].Tip.TotalWork != 5*4 {
+		t.Errorf("forks are %+v, expected the 4 replaced blocks with their total work of %d", forks, 5*4)
+	}
+}
+
+func TestSideBlocksAreRetained(t *testing.T) {
+	state := newTestState(t, testGenesis)
+	peer := newTestState(t, testGenesis)
+	other := newTestState(t, testGenesis)
+
+	chain := make([]Block, 0)
+	for i := 0; i < 4; i++ {
+		b := addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+		chain = append(chain, b)
+
+		if i < 2 {
+			_, err := peer.AddBlock(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if i < 1 {
+			_, err := other.AddBlock(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	branch := []Block{
+		addTestBlock(t, peer, SealKey{}, NewTx("jrhodes", "babayaga", NewAmount(1), "")),
+		addTestBlock(t, peer, SealKey{}, NewTx("jrhodes", "babayaga", NewAmount(1), "")),
+	}
+	shortBranch := addTestBlock(t, other, SealKey{}, NewTx("jrhodes", "lhendricks", NewAmount(1), ""))
+
+	// Adding the same side blocks twice doesn't count them twice
+	for i := 0; i < 2; i++ {
+		err := state.AddBlocks(append(branch, shortBranch))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if state.LatestBlockHash() != hashOf(t, chain[3]) {
+		t.Fatalf("side chains no longer than the chain must not trigger a reorg")
+	}
+
+	expected := []Fork{
+		{ForkPoint: hashOf(t, chain[0]), ForkNumber: 1, Length: 1, Tip: ChainHead{Hash: hashOf(t, shortBranch), Number: 1, TotalWork: 2}},
+		{ForkPoint: hashOf(t, chain[1]), ForkNumber: 2, Length: 2, Tip: ChainHead{Hash: hashOf(t, branch[1]), Number: 3, TotalWork: 4}},
+	}
+
+	forks := state.Forks()
+	if len(forks) != len(expected) {
+		t.Fatalf("forks are %+v, expected %+v", forks, expected)
+	}
+	for i := range forks {
+		if forks[i] != expected[i] {
+			t.Errorf("fork %d is %+v, expected %+v", i, forks[i], expected[i])
+		}
+	}
+
+	stats := state.ForkStats()
+	if stats.Blocks != 4 || stats.SideBlocks != 3 || stats.Forks != 2 || stats.LastForkNumber != 1 || stats.Reorgs != 0 {
+		t.Errorf("fork stats are %+v, expected 4 blocks, 3 side blocks, 2 forks, the last one at block 1 and no reorg", stats)
+	}
+	if stats.ForksPer100Blocks != float64(2)*100/7 {
+		t.Errorf("%f forks per 100 blocks, expected %f", stats.ForksPer100Blocks, float64(2)*100/7)
+	}
+
+	tests := []struct {
+		name  string
+		hash  Hash
+		known bool
+	}{
+		{"chain block", hashOf(t, chain[2]), true},
+		{"side chain block", hashOf(t, branch[0]), true},
+		{"side chain tip", hashOf(t, shortBranch), true},
+		{"unknown block", Hash{0x01}, false},
+		{"empty hash", Hash{}, false},
+	}
+
+	for _, test := range tests {
+		if known := state.IsKnownBlock(test.hash); known != test.known {
+			t.Errorf("%s: IsKnownBlock('%s') = %t, expected %t", test.name, test.hash.Hex(), known, test.known)
+		}
+	}
+}
+
+func TestInvalidSideBlockIsRejected(t *testing.T) {
+	state := newTestState(t, testGenesis)
+	first := addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+	addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+
+	// meads only holds 1 TBB on the branch forking after the first block
+	invalid := NewBlock(hashOf(t, first), 1, testBlockTime+15, []Tx{NewTx("meads", "jrhodes", NewAmount(2), "")})
+
+	err := state.AddBlocks([]Block{invalid})
+	if err == nil || !strings.Contains(err.Error(), "Tx cost is 2 TBB") {
+		t.Errorf("expected a side block overspending on its branch to be rejected, got '%v'", err)
+	}
+
+	if state.IsKnownBlock(hashOf(t, invalid)) || len(state.Forks()) != 0 || state.ForkStats().SideBlocks != 0 {
+		t.Errorf("an invalid side block must not be retained")
+	}
+}
+
+func TestChainBlocksAreKnownOnceReloaded(t *testing.T) {
+	state := newTestState(t, testGenesis)
+	dataDir := state.dataDir
+
+	chain := make([]Block, 0)
+	for i := 0; i < 3; i++ {
+		chain = append(chain, addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), "")))
+	}
+
+	err := state.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewStateFromDiskReadOnly(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+
+	for i, b := range chain {
+		if !reloaded.IsKnownBlock(hashOf(t, b)) {
+			t.Errorf("block %d must be known once the chain is reloaded from disk", i)
+		}
+	}
+}
@@ -1,9 +1,13 @@
 package database
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 func initDataDirIfNotExists(dataDir string) error {
@@ -11,12 +15,27 @@ func initDataDirIfNotExists(dataDir string) error {
 		return nil
 	}
 
-	err := os.MkdirAll(getDatabaseDirPath(dataDir), os.ModePerm)
+	return InitDataDir(dataDir, []byte(genesisJson))
+}
+
+// InitDataDir creates a new, empty data dir using the given genesis.
+func InitDataDir(dataDir string, genesisContent []byte) error {
+	if fileExist(getGenesisJsonFilePath(dataDir)) {
+		return fmt.Errorf("data directory '%s' is already initialized", dataDir)
+	}
+
+	var gen genesis
+	err := json.Unmarshal(genesisContent, &gen)
+	if err != nil {
+		return fmt.Errorf("invalid genesis. %s", err.Error())
+	}
+
+	err = os.MkdirAll(getDatabaseDirPath(dataDir), os.ModePerm)
 	if err != nil {
 		return err
 	}
 
-	err = writeGenesisToDisk(getGenesisJsonFilePath(dataDir))
+	err = ioutil.WriteFile(getGenesisJsonFilePath(dataDir), genesisContent, 0644)
 	if err != nil {
 		return err
 	}
@@ -26,9 +45,147 @@ func initDataDirIfNotExists(dataDir string) error {
 		return err
 	}
 
+	err = writeDbVersionToDisk(getVersionJsonFilePath(dataDir), DbVersion)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RebuildDataDir adds blocks to the database of the data dir, or to a new database initialized with
+// genesisContent (the built-in genesis when nil) when it has none, with the build function.
+//
+// The build first runs against an in-memory State to validate everything it adds, then again against
+// a staging copy of the database, which only replaces the data dir database once complete.
+func RebuildDataDir(dataDir string, genesisContent []byte, build func(state *State) error) error {
+	exists := fileExist(getGenesisJsonFilePath(dataDir))
+	if exists && genesisContent != nil {
+		return fmt.Errorf("data directory '%s' is already initialized", dataDir)
+	}
+
+	if exists {
+		// Nobody may be writing into the database we are about to replace
+		lock, err := lockDataDir(dataDir)
+		if err != nil {
+			return err
+		}
+		defer lock.release()
+	}
+
+	err := os.MkdirAll(dataDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	stagingDataDir, err := ioutil.TempDir(dataDir, ".rebuild-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDataDir)
+
+	if exists {
+		err = copyDatabase(dataDir, stagingDataDir)
+	} else {
+		if genesisContent == nil {
+			genesisContent = []byte(genesisJson)
+		}
+		err = InitDataDir(stagingDataDir, genesisContent)
+	}
+	if err != nil {
+		return err
+	}
+
+	state, err := NewStateFromDisk(stagingDataDir)
+	if err != nil {
+		return err
+	}
+
+	err = build(state.DryRun())
+	if err != nil {
+		state.Close()
+		return err
+	}
+
+	err = build(state)
+	if err != nil {
+		state.Close()
+		return err
+	}
+
+	err = state.Close()
+	if err != nil {
+		return err
+	}
+
+	dbDir := getDatabaseDirPath(dataDir)
+	if !exists {
+		return os.Rename(getDatabaseDirPath(stagingDataDir), dbDir)
+	}
+
+	replacedDbDir := fmt.Sprintf("%s.replaced-%d", dbDir, time.Now().Unix())
+	err = os.Rename(dbDir, replacedDbDir)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(getDatabaseDirPath(stagingDataDir), dbDir)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(replacedDbDir)
+}
+
+// databaseFilePaths are the files making up a database: its genesis, blocks, version and upgrade heights.
+var databaseFilePaths = []func(dataDir string) string{getGenesisJsonFilePath, getBlocksDbFilePath, getVersionJsonFilePath, getUpgradesJsonFilePath}
+
+// copyDatabase copies the files of a database into another data dir.
+func copyDatabase(dataDir string, toDataDir string) error {
+	return copyDatabaseFiles(dataDir, toDataDir, databaseFilePaths)
+}
+
+func copyDatabaseFiles(dataDir string, toDataDir string, paths []func(dataDir string) string) error {
+	err := os.MkdirAll(getDatabaseDirPath(toDataDir), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if !fileExist(path(dataDir)) {
+			continue
+		}
+
+		err = copyFile(path(dataDir), path(toDataDir))
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
 func getDatabaseDirPath(dataDir string) string {
 	return filepath.Join(dataDir, "database")
 }
@@ -41,6 +198,14 @@ func getBlocksDbFilePath(dataDir string) string {
 	return filepath.Join(getDatabaseDirPath(dataDir), "block.db")
 }
 
+func getVersionJsonFilePath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "version.json")
+}
+
+func getUpgradesJsonFilePath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "upgrades.json")
+}
+
 func fileExist(filePath string) bool {
 	_, err := os.Stat(filePath)
 	if err != nil && os.IsNotExist(err) {
@@ -15,7 +15,19 @@ var genesisJson = `
 }`
 
 type genesis struct {
-	Balances map[Account]uint `json:"balances"`
+	Balances  map[Account]Amount          `json:"balances"`
+	Vesting   map[Account]VestingSchedule `json:"vesting"`
+	MaxSupply Amount                      `json:"max_supply"`
+	Limits    Limits                      `json:"limits"`
+	Consensus string                      `json:"consensus"`
+	Signers   map[Account]PublicKey       `json:"signers"`
+	Pow       PowConfig                   `json:"pow"`
+
+	Checkpoints map[uint64]Hash   `json:"checkpoints"`
+	Upgrades    map[string]uint64 `json:"upgrades"`
+
+	Validators      map[Account]GenesisValidator `json:"validators"`
+	UnbondingPeriod uint64                       `json:"unbonding_period"`
 }
 
 func loadGenesis(path string) (genesis, error) {
@@ -32,7 +44,3 @@ func loadGenesis(path string) (genesis, error) {
 
 	return loadedGenesis, nil
 }
-
-func writeGenesisToDisk(path string) error {
-	return ioutil.WriteFile(path, []byte(genesisJson), 0644)
-}
\ No newline at end of file
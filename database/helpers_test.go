@@ -0,0 +1,107 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// newTestDataDir returns an empty data dir removed once the test ends.
+func newTestDataDir(t *testing.T) string {
+	t.Helper()
+
+	dataDir, err := ioutil.TempDir("", "tbb-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dataDir) })
+
+	return dataDir
+}
+
+// copyTestFile copies a file of the package directory, such as the legacy block.db, into the data dir.
+func copyTestFile(t *testing.T, name string, dst string) {
+	t.Helper()
+
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(dst, content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+const testGenesis = `{"balances": {"jrhodes": 1000000}}`
+
+// testBlockTime is the time of the first test block, every following block is 15 seconds younger.
+const testBlockTime = uint64(1600000000)
+
+// newTestState loads the State of a new data dir initialized with the genesis.
+func newTestState(t *testing.T, genesisContent string) *State {
+	t.Helper()
+
+	dataDir := newTestDataDir(t)
+
+	err := InitDataDir(dataDir, []byte(genesisContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { state.Close() })
+
+	return state
+}
+
+// nextTestBlock returns an unsealed block with the TXs following the State tip.
+func nextTestBlock(s *State, txs ...Tx) Block {
+	number := s.NextBlockNumber()
+
+	return NewBlock(s.LatestBlockHash(), number, testBlockTime+15*number, txs)
+}
+
+// sealTestBlock lets the consensus prepare and seal the block, as a node producing it would.
+func sealTestBlock(s *State, key SealKey, b Block) (Block, error) {
+	consensus := s.ConsensusAt(b.Header.Number)
+
+	err := consensus.Prepare(&b.Header, s)
+	if err != nil {
+		return Block{}, err
+	}
+
+	return consensus.Seal(b, s, key)
+}
+
+// addTestBlock seals a block with the TXs following the State tip and adds it.
+func addTestBlock(t *testing.T, s *State, key SealKey, txs ...Tx) Block {
+	t.Helper()
+
+	b, err := sealTestBlock(s, key, nextTestBlock(s, txs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.AddBlock(b)
+	if err != nil {
+		t.Fatalf("adding block %d failed: %s", b.Header.Number, err)
+	}
+
+	return b
+}
+
+func hashOf(t *testing.T, b Block) Hash {
+	t.Helper()
+
+	hash, err := b.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+const TxTypeHtlcLock TxType = "htlc_lock"
+const TxTypeHtlcClaim TxType = "htlc_claim"
+const TxTypeHtlcRefund TxType = "htlc_refund"
+
+// Htlc is value locked by a hash-time-locked contract. Its recipient can claim it by revealing
+// the preimage of its hash lock before the timeout height, its sender can take it back from then on.
+type Htlc struct {
+	HashLock      Hash    `json:"hash_lock"`
+	From          Account `json:"from"`
+	To            Account `json:"to"`
+	Value         Amount  `json:"value"`
+	Asset         AssetID `json:"asset"`
+	TimeoutHeight uint64  `json:"timeout_height"`
+	BlockNumber   uint64  `json:"block_number"`
+}
+
+// NewHtlcSecret generates a random preimage and the hash lock it opens.
+func NewHtlcSecret() ([]byte, Hash, error) {
+	preimage := make([]byte, 32)
+	_, err := rand.Read(preimage)
+	if err != nil {
+		return nil, Hash{}, err
+	}
+
+	return preimage, sha256.Sum256(preimage), nil
+}
+
+// NewHtlcLockTx locks value of an asset for a recipient under a hash lock until the timeout height.
+func NewHtlcLockTx(from Account, to Account, value Amount, asset AssetID, hashLock Hash, timeoutHeight uint64) Tx {
+	return Tx{From: from, To: to, Value: value, Asset: asset, Type: TxTypeHtlcLock, HashLock: &hashLock, TimeoutHeight: timeoutHeight}
+}
+
+// NewHtlcClaimTx claims the HTLC the hex encoded preimage opens.
+func NewHtlcClaimTx(recipient Account, preimage string) Tx {
+	return Tx{From: recipient, Type: TxTypeHtlcClaim, Preimage: preimage}
+}
+
+// NewHtlcRefundTx takes back the value of a timed out HTLC.
+func NewHtlcRefundTx(sender Account, hashLock Hash) Tx {
+	return Tx{From: sender, Type: TxTypeHtlcRefund, HashLock: &hashLock}
+}
+
+// Htlcs returns the open HTLCs, ordered by timeout height.
+func (s *State) Htlcs() []Htlc {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	htlcs := make([]Htlc, 0, len(s.htlcs))
+	for _, htlc := range s.htlcs {
+		htlcs = append(htlcs, htlc)
+	}
+
+	sort.Slice(htlcs, func(i, j int) bool {
+		if htlcs[i].TimeoutHeight != htlcs[j].TimeoutHeight {
+			return htlcs[i].TimeoutHeight < htlcs[j].TimeoutHeight
+		}
+
+		return htlcs[i].HashLock.Hex() < htlcs[j].HashLock.Hex()
+	})
+
+	return htlcs
+}
+
+func applyHtlcTx(tx Tx, s *State) error {
+	if tx.IsTimeLocked() {
+		return fmt.Errorf("bad TX. HTLC TXs can't be time-locked")
+	}
+
+	switch tx.Type {
+	case TxTypeHtlcLock:
+		return applyHtlcLock(tx, s)
+	case TxTypeHtlcClaim:
+		return applyHtlcClaim(tx, s)
+	default:
+		return applyHtlcRefund(tx, s)
+	}
+}
+
+func applyHtlcLock(tx Tx, s *State) error {
+	if tx.HashLock == nil {
+		return fmt.Errorf("bad TX. HTLC lock requires a hash lock")
+	}
+
+	if tx.To == "" {
+		return fmt.Errorf("bad TX. HTLC lock requires a recipient")
+	}
+
+	if tx.TimeoutHeight <= s.NextBlockNumber() {
+		return fmt.Errorf("bad TX. HTLC timeout height %d must be after block %d", tx.TimeoutHeight, s.NextBlockNumber())
+	}
+
+	if _, exists := s.htlcs[*tx.HashLock]; exists {
+		return fmt.Errorf("bad TX. An HTLC with hash lock '%s' is already open", tx.HashLock.Hex())
+	}
+
+	err := s.debit(tx.From, tx.AssetID(), tx.Value)
+	if err != nil {
+		return err
+	}
+
+	s.htlcs[*tx.HashLock] = Htlc{
+		HashLock:      *tx.HashLock,
+		From:          tx.From,
+		To:            tx.To,
+		Value:         tx.Value,
+		Asset:         tx.AssetID(),
+		TimeoutHeight: tx.TimeoutHeight,
+		BlockNumber:   s.NextBlockNumber(),
+	}
+
+	return nil
+}
+
+func applyHtlcClaim(tx Tx, s *State) error {
+	if tx.Value != 0 {
+		return fmt.Errorf("bad TX. Claiming an HTLC doesn't transfer any value")
+	}
+
+	preimage, err := hex.DecodeString(tx.Preimage)
+	if err != nil || len(preimage) == 0 {
+		return fmt.Errorf("bad TX. HTLC claim requires a hex encoded preimage")
+	}
+
+	hashLock := Hash(sha256.Sum256(preimage))
+	htlc, ok := s.htlcs[hashLock]
+	if !ok {
+		return fmt.Errorf("bad TX. The preimage doesn't open any HTLC")
+	}
+
+	if tx.From != htlc.To {
+		return fmt.Errorf("bad TX. HTLC '%s' can only be claimed by '%s'", hashLock.Hex(), htlc.To)
+	}
+
+	if s.NextBlockNumber() >= htlc.TimeoutHeight {
+		return fmt.Errorf("bad TX. HTLC '%s' timed out at block %d", hashLock.Hex(), htlc.TimeoutHeight)
+	}
+
+	delete(s.htlcs, hashLock)
+
+	return s.creditAsset(htlc.To, htlc.Asset, htlc.Value)
+}
+
+func applyHtlcRefund(tx Tx, s *State) error {
+	if tx.Value != 0 {
+		return fmt.Errorf("bad TX. Refunding an HTLC doesn't transfer any value")
+	}
+
+	if tx.HashLock == nil {
+		return fmt.Errorf("bad TX. HTLC refund requires a hash lock")
+	}
+
+	htlc, ok := s.htlcs[*tx.HashLock]
+	if !ok {
+		return fmt.Errorf("bad TX. No HTLC is open with hash lock '%s'", tx.HashLock.Hex())
+	}
+
+	if tx.From != htlc.From {
+		return fmt.Errorf("bad TX. HTLC '%s' can only be refunded to '%s'", htlc.HashLock.Hex(), htlc.From)
+	}
+
+	if s.NextBlockNumber() < htlc.TimeoutHeight {
+		return fmt.Errorf("bad TX. HTLC '%s' can't be refunded before block %d", htlc.HashLock.Hex(), htlc.TimeoutHeight)
+	}
+
+	delete(s.htlcs, htlc.HashLock)
+
+	return s.creditAsset(htlc.From, htlc.Asset, htlc.Value)
+}
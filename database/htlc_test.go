@@ -0,0 +1,92 @@
+package database
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestHtlcClaimAndRefund(t *testing.T) {
+	preimage, hashLock, err := NewHtlcSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := hex.EncodeToString(preimage)
+	lock := NewHtlcLockTx("jrhodes", "meads", NewAmount(100), NativeAsset, hashLock, 3)
+
+	tests := []struct {
+		name   string
+		blocks [][]Tx
+		err    string
+		// balances expected once every block is added
+		sender    Amount
+		recipient Amount
+	}{
+		{"claim", [][]Tx{{lock}, {NewHtlcClaimTx("meads", secret)}}, "", NewAmount(999900), NewAmount(100)},
+		{"claim in the lock block", [][]Tx{{lock, NewHtlcClaimTx("meads", secret)}}, "", NewAmount(999900), NewAmount(100)},
+		{"claim on the last block before the timeout", [][]Tx{{lock}, {}, {NewHtlcClaimTx("meads", secret)}}, "", NewAmount(999900), NewAmount(100)},
+		{"claim at the timeout", [][]Tx{{lock}, {}, {}, {NewHtlcClaimTx("meads", secret)}}, "timed out at block 3", NewAmount(999900), 0},
+		{"claim by another account", [][]Tx{{lock}, {NewHtlcClaimTx("lhendricks", secret)}}, "can only be claimed by 'meads'", NewAmount(999900), 0},
+		{"claim with a wrong preimage", [][]Tx{{lock}, {NewHtlcClaimTx("meads", "00"+secret)}}, "doesn't open any HTLC", NewAmount(999900), 0},
+		{"claim without a preimage", [][]Tx{{lock}, {NewHtlcClaimTx("meads", "")}}, "requires a hex encoded preimage", NewAmount(999900), 0},
+		{"refund at the timeout", [][]Tx{{lock}, {}, {}, {NewHtlcRefundTx("jrhodes", hashLock)}}, "", NewAmount(1000000), 0},
+		{"refund before the timeout", [][]Tx{{lock}, {}, {NewHtlcRefundTx("jrhodes", hashLock)}}, "can't be refunded before block 3", NewAmount(999900), 0},
+		{"refund to another account", [][]Tx{{lock}, {}, {}, {NewHtlcRefundTx("meads", hashLock)}}, "can only be refunded to 'jrhodes'", NewAmount(999900), 0},
+		{"refund after a claim", [][]Tx{{lock}, {NewHtlcClaimTx("meads", secret)}, {}, {NewHtlcRefundTx("jrhodes", hashLock)}}, "No HTLC is open", NewAmount(999900), NewAmount(100)},
+		{"claim after a refund", [][]Tx{{lock}, {}, {}, {NewHtlcRefundTx("jrhodes", hashLock)}, {NewHtlcClaimTx("meads", secret)}}, "doesn't open any HTLC", NewAmount(1000000), 0},
+		{"lock the same hash twice", [][]Tx{{lock}, {NewHtlcLockTx("jrhodes", "meads", NewAmount(1), NativeAsset, hashLock, 5)}}, "is already open", NewAmount(999900), 0},
+		{"timeout already reached", [][]Tx{{}, {}, {}, {lock}}, "HTLC timeout height 3 must be after block 3", NewAmount(1000000), 0},
+		{"lock over the balance", [][]Tx{{NewHtlcLockTx("jrhodes", "meads", NewAmount(1000001), NativeAsset, hashLock, 3)}}, "Tx cost is 1000001 TBB", NewAmount(1000000), 0},
+	}
+
+	for _, test := range tests {
+		s := newTestState(t, testGenesis)
+
+		for _, txs := range test.blocks {
+			_, err = s.AddBlock(nextTestBlock(s, txs...))
+			if err != nil {
+				break
+			}
+		}
+
+		if test.err == "" && err != nil {
+			t.Errorf("%s: expected every block to be accepted, got '%s'", test.name, err)
+		}
+
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+
+		if s.Balances["jrhodes"] != test.sender || s.Balances["meads"] != test.recipient {
+			t.Errorf("%s: jrhodes holds %s and meads %s, expected %s and %s", test.name, s.Balances["jrhodes"], s.Balances["meads"], test.sender, test.recipient)
+		}
+	}
+}
+
+func TestHtlcOfAnAsset(t *testing.T) {
+	preimage, hashLock, err := NewHtlcSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestState(t, testGenesis)
+	addTestBlock(t, s, SealKey{}, NewAssetIssueTx("jrhodes", "jrhodes", NewAmount(50), "TAB"), NewHtlcLockTx("jrhodes", "meads", NewAmount(20), "TAB", hashLock, 5))
+
+	htlcs := s.Htlcs()
+	if len(htlcs) != 1 || htlcs[0].Asset != "TAB" || htlcs[0].BlockNumber != 0 || htlcs[0].TimeoutHeight != 5 {
+		t.Fatalf("open HTLCs are %+v", htlcs)
+	}
+
+	addTestBlock(t, s, SealKey{}, NewHtlcClaimTx("meads", hex.EncodeToString(preimage)))
+
+	if s.BalancesOf("TAB")["meads"] != NewAmount(20) || s.BalancesOf("TAB")["jrhodes"] != NewAmount(30) || len(s.Htlcs()) != 0 {
+		t.Errorf("TAB balances are %v after the claim", s.BalancesOf("TAB"))
+	}
+
+	timeLocked := NewHtlcLockTx("jrhodes", "meads", NewAmount(1), NativeAsset, hashLock, 10)
+	timeLocked.UnlockHeight = 10
+	_, err = s.AddBlock(nextTestBlock(s, timeLocked))
+	if err == nil || !strings.Contains(err.Error(), "HTLC TXs can't be time-locked") {
+		t.Errorf("expected a time-locked HTLC TX to be rejected, got '%v'", err)
+	}
+}
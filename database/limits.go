@@ -0,0 +1,91 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Limits are the consensus bounds every block must respect, configured in genesis.
+//
+// A limit left out of genesis (zero) falls back to its DefaultLimits value.
+type Limits struct {
+	MaxBlockSize    uint64 `json:"max_block_size"`
+	MaxBlockTxs     uint64 `json:"max_block_txs"`
+	MaxTxDataLength uint64 `json:"max_tx_data_length"`
+	MaxScriptLength uint64 `json:"max_script_length"`
+	MaxTxGas        uint64 `json:"max_tx_gas"`
+}
+
+var DefaultLimits = Limits{
+	MaxBlockSize:    1024 * 1024,
+	MaxBlockTxs:     1000,
+	MaxTxDataLength: 1024,
+	MaxScriptLength: 4096,
+	MaxTxGas:        100000,
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxBlockSize == 0 {
+		l.MaxBlockSize = DefaultLimits.MaxBlockSize
+	}
+	if l.MaxBlockTxs == 0 {
+		l.MaxBlockTxs = DefaultLimits.MaxBlockTxs
+	}
+	if l.MaxTxDataLength == 0 {
+		l.MaxTxDataLength = DefaultLimits.MaxTxDataLength
+	}
+	if l.MaxScriptLength == 0 {
+		l.MaxScriptLength = DefaultLimits.MaxScriptLength
+	}
+	if l.MaxTxGas == 0 {
+		l.MaxTxGas = DefaultLimits.MaxTxGas
+	}
+
+	return l
+}
+
+func (s *State) Limits() Limits {
+	return s.limits
+}
+
+// CheckTxLimits verifies a TX fits into a block, so producers can reject it before building one.
+func (s *State) CheckTxLimits(tx Tx) error {
+	if uint64(len(tx.Data)) > s.limits.MaxTxDataLength {
+		return fmt.Errorf("TX data is %d bytes long, the limit is %d bytes", len(tx.Data), s.limits.MaxTxDataLength)
+	}
+
+	if uint64(len(tx.Script)) > s.limits.MaxScriptLength {
+		return fmt.Errorf("TX script is %d bytes long, the limit is %d bytes", len(tx.Script), s.limits.MaxScriptLength)
+	}
+
+	if tx.GasLimit > s.limits.MaxTxGas {
+		return fmt.Errorf("TX gas limit is %d, the limit is %d", tx.GasLimit, s.limits.MaxTxGas)
+	}
+
+	return nil
+}
+
+// CheckBlockLimits verifies a block respects the consensus limits.
+func (s *State) CheckBlockLimits(b Block) error {
+	if uint64(len(b.TXs)) > s.limits.MaxBlockTxs {
+		return fmt.Errorf("block contains %d TXs, the limit is %d TXs", len(b.TXs), s.limits.MaxBlockTxs)
+	}
+
+	for _, tx := range b.TXs {
+		err := s.CheckTxLimits(tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	blockJson, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	if uint64(len(blockJson)) > s.limits.MaxBlockSize {
+		return fmt.Errorf("block is %d bytes big, the limit is %d bytes", len(blockJson), s.limits.MaxBlockSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlockLimits(t *testing.T) {
+	genesis := `{"balances": {"jrhodes": 1000000}, "limits": {"max_block_size": 600, "max_block_txs": 3, "max_tx_data_length": 8}}`
+
+	tests := []struct {
+		name string
+		txs  []Tx
+		err  string
+	}{
+		{"within the limits", []Tx{NewTx("jrhodes", "meads", 1, "12345678"), NewTx("jrhodes", "meads", 1, "")}, ""},
+		{"too many TXs", []Tx{NewTx("jrhodes", "meads", 1, ""), NewTx("jrhodes", "meads", 1, ""), NewTx("jrhodes", "meads", 1, ""), NewTx("jrhodes", "meads", 1, "")}, "block contains 4 TXs, the limit is 3 TXs"},
+		{"TX data too long", []Tx{NewTx("jrhodes", "meads", 1, "123456789")}, "TX data is 9 bytes long, the limit is 8 bytes"},
+		{"block too big", []Tx{NewTx("jrhodes", Account(strings.Repeat("m", 200)), 1, ""), NewTx("jrhodes", Account(strings.Repeat("l", 200)), 1, "")}, "the limit is 600 bytes"},
+	}
+
+	for _, test := range tests {
+		s := newTestState(t, genesis)
+
+		_, err := s.AddBlock(nextTestBlock(s, test.txs...))
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: expected the block to be accepted, got '%s'", test.name, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+
+		if s.NextBlockNumber() != 0 {
+			t.Errorf("%s: a block over the limits must not be added", test.name)
+		}
+	}
+}
+
+func TestLimitsDefaultWhenLeftOutOfGenesis(t *testing.T) {
+	s := newTestState(t, `{"balances": {"jrhodes": 1000000}, "limits": {"max_block_txs": 5}}`)
+
+	expected := DefaultLimits
+	expected.MaxBlockTxs = 5
+	if s.Limits() != expected {
+		t.Errorf("limits are %+v, expected %+v", s.Limits(), expected)
+	}
+
+	err := s.CheckTxLimits(NewTx("jrhodes", "meads", 1, strings.Repeat("d", int(DefaultLimits.MaxTxDataLength)+1)))
+	if err == nil {
+		t.Errorf("expected a TX over the default data length to be refused")
+	}
+}
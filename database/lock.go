@@ -0,0 +1,102 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// dataDirLock is an exclusive lock held by the only process allowed to write into a data dir.
+//
+// The lock itself is an OS advisory lock on the LOCK file, released by the OS when the process
+// exits, so a crashed process never leaves a stale lock behind. The file only records the PID
+// of the holder to tell who uses the data dir.
+type dataDirLock struct {
+	path string
+	f    *os.File
+}
+
+// lockDataDir takes the data dir write lock, recording the current PID in the lock file.
+func lockDataDir(dataDir string) (*dataDirLock, error) {
+	path := getLockFilePath(dataDir)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFile(f)
+	if err != nil {
+		f.Close()
+
+		pid, pidErr := readLockPid(path)
+		if pidErr != nil {
+			return nil, fmt.Errorf("data directory '%s' in use by another process", dataDir)
+		}
+
+		return nil, fmt.Errorf("data directory '%s' in use by PID %d", dataDir, pid)
+	}
+
+	err = writeLockPid(f)
+	if err != nil {
+		unlockFile(f)
+		f.Close()
+		return nil, err
+	}
+
+	return &dataDirLock{path, f}, nil
+}
+
+// release clears the PID and unlocks the lock file.
+//
+// The file is kept: removing it would let a process still holding it open lock the removed
+// file while another one creates and locks a new one.
+func (l *dataDirLock) release() error {
+	if l == nil {
+		return nil
+	}
+
+	err := l.f.Truncate(0)
+	if err != nil {
+		l.f.Close()
+		return err
+	}
+
+	err = unlockFile(l.f)
+	if err != nil {
+		l.f.Close()
+		return err
+	}
+
+	return l.f.Close()
+}
+
+func writeLockPid(f *os.File) error {
+	err := f.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	if err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+func readLockPid(path string) (int, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
+
+func getLockFilePath(dataDir string) string {
+	return filepath.Join(getDatabaseDirPath(dataDir), "LOCK")
+}
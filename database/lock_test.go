@@ -0,0 +1,82 @@
+package database
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDataDirLock(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewStateFromDisk(dataDir)
+	expected := fmt.Sprintf("in use by PID %d", os.Getpid())
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected a second writer to be refused with '%s', got '%v'", expected, err)
+	}
+
+	readOnly, err := NewStateFromDiskReadOnly(dataDir)
+	if err != nil {
+		t.Fatalf("expected a read-only State to load while the data dir is locked, got '%s'", err)
+	}
+
+	_, err = readOnly.AddBlock(NewBlock(Hash{}, 0, 1600000000, []Tx{NewTx("jrhodes", "meads", 1, "")}))
+	if err == nil || !strings.Contains(err.Error(), "opened read-only") {
+		t.Errorf("expected adding a block to a read-only State to fail, got '%v'", err)
+	}
+	readOnly.Close()
+
+	err = state.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("expected closing the State to release the lock, got '%s'", err)
+	}
+	state.Close()
+}
+
+func TestStaleDataDirLockIsTakenOver(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Close()
+
+	// A process crashing while holding the lock leaves its PID behind, but the OS releases its lock
+	err = ioutil.WriteFile(getLockFilePath(dataDir), []byte("4194304"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatalf("expected the stale lock to be taken over, got '%s'", err)
+	}
+
+	pid, err := readLockPid(getLockFilePath(dataDir))
+	if err != nil || pid != os.Getpid() {
+		t.Errorf("lock is held by PID %d, expected %d", pid, os.Getpid())
+	}
+
+	err = state.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(getLockFilePath(dataDir))
+	if err != nil || len(content) != 0 {
+		t.Errorf("expected closing the State to keep an empty lock file, got '%s' and '%v'", content, err)
+	}
+}
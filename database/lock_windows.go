@@ -0,0 +1,53 @@
+//go:build windows
+// +build windows
+
+package database
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const lockfileFailImmediately = 0x00000001
+const lockfileExclusiveLock = 0x00000002
+
+// lockRegionOffsetHigh places the locked byte at 4 GiB, past the PID. Windows locks are mandatory,
+// locking the start of the file would keep other processes from reading the PID of the holder.
+const lockRegionOffsetHigh = 1
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+// lockFile takes an exclusive lock on the file, failing right away if another process holds it.
+func lockFile(f *os.File) error {
+	overlapped := syscall.Overlapped{OffsetHigh: lockRegionOffsetHigh}
+
+	r, _, err := procLockFileEx.Call(
+		f.Fd(),
+		lockfileExclusiveLock|lockfileFailImmediately,
+		0,
+		1,
+		0,
+		uintptr(unsafe.Pointer(&overlapped)),
+	)
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	overlapped := syscall.Overlapped{OffsetHigh: lockRegionOffsetHigh}
+
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&overlapped)))
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
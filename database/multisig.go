@@ -0,0 +1,228 @@
+package database
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// multisigAccountPrefix marks accounts owned by a MultisigPolicy instead of a single person.
+const multisigAccountPrefix = "msig:"
+
+const maxMultisigKeys = 16
+
+type PublicKey [ed25519.PublicKeySize]byte
+
+func (k PublicKey) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(k[:])), nil
+}
+
+func (k *PublicKey) UnmarshalText(data []byte) error {
+	return unmarshalFixedHex(k[:], data, "public key")
+}
+
+type Signature [ed25519.SignatureSize]byte
+
+func (s Signature) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(s[:])), nil
+}
+
+func (s *Signature) UnmarshalText(data []byte) error {
+	return unmarshalFixedHex(s[:], data, "signature")
+}
+
+func unmarshalFixedHex(dst []byte, data []byte, name string) error {
+	if hex.DecodedLen(len(data)) != len(dst) {
+		return fmt.Errorf("%s must be %d hex encoded bytes", name, len(dst))
+	}
+
+	_, err := hex.Decode(dst, data)
+
+	return err
+}
+
+// GenerateKey creates a new ed25519 key pair to sign TXs with.
+func GenerateKey() (PublicKey, ed25519.PrivateKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return PublicKey{}, nil, err
+	}
+
+	var publicKey PublicKey
+	copy(publicKey[:], pub)
+
+	return publicKey, priv, nil
+}
+
+type TxSignature struct {
+	PublicKey PublicKey `json:"public_key"`
+	Signature Signature `json:"signature"`
+}
+
+// MultisigPolicy defines an account spendable only with signatures of Threshold of its PublicKeys.
+type MultisigPolicy struct {
+	Threshold  uint        `json:"threshold"`
+	PublicKeys []PublicKey `json:"public_keys"`
+}
+
+// NewMultisigPolicy returns an M-of-N policy. Keys are sorted so the same owners always
+// define the same account.
+func NewMultisigPolicy(threshold uint, publicKeys []PublicKey) (MultisigPolicy, error) {
+	keys := make([]PublicKey, len(publicKeys))
+	copy(keys, publicKeys)
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i][:], keys[j][:]) < 0 })
+
+	policy := MultisigPolicy{threshold, keys}
+
+	return policy, policy.validate()
+}
+
+func (p MultisigPolicy) validate() error {
+	if len(p.PublicKeys) == 0 || len(p.PublicKeys) > maxMultisigKeys {
+		return fmt.Errorf("multisig policy must have between 1 and %d public keys, not %d", maxMultisigKeys, len(p.PublicKeys))
+	}
+
+	if p.Threshold == 0 || p.Threshold > uint(len(p.PublicKeys)) {
+		return fmt.Errorf("multisig threshold must be between 1 and %d, not %d", len(p.PublicKeys), p.Threshold)
+	}
+
+	for i := 1; i < len(p.PublicKeys); i++ {
+		if bytes.Compare(p.PublicKeys[i-1][:], p.PublicKeys[i][:]) >= 0 {
+			return fmt.Errorf("multisig public keys must be unique and sorted")
+		}
+	}
+
+	return nil
+}
+
+// Account returns the address of the account owned by the policy.
+func (p MultisigPolicy) Account() (Account, error) {
+	policyJson, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+
+	policyHash := sha256.Sum256(policyJson)
+
+	return NewAccount(multisigAccountPrefix + hex.EncodeToString(policyHash[:20])), nil
+}
+
+func (p MultisigPolicy) hasKey(key PublicKey) bool {
+	for _, k := range p.PublicKeys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func IsMultisigAccount(account Account) bool {
+	return strings.HasPrefix(string(account), multisigAccountPrefix)
+}
+
+// SigningHash is the hash signers sign, the TX without any of its signatures.
+func (t Tx) SigningHash() (Hash, error) {
+	unsigned := t
+	unsigned.Signatures = nil
+
+	txJson, err := json.Marshal(unsigned)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return sha256.Sum256(txJson), nil
+}
+
+// Sign adds the signature of the private key to the TX, replacing an older one of the same key.
+func (t Tx) Sign(privateKey ed25519.PrivateKey) (Tx, error) {
+	signingHash, err := t.SigningHash()
+	if err != nil {
+		return Tx{}, err
+	}
+
+	var sig TxSignature
+	copy(sig.PublicKey[:], privateKey.Public().(ed25519.PublicKey))
+	copy(sig.Signature[:], ed25519.Sign(privateKey, signingHash[:]))
+
+	return t.WithSignatures([]TxSignature{sig}), nil
+}
+
+// WithSignatures returns the TX carrying the given signatures on top of its own, one per public key.
+func (t Tx) WithSignatures(sigs []TxSignature) Tx {
+	merged := make([]TxSignature, 0, len(t.Signatures)+len(sigs))
+	seen := make(map[PublicKey]int)
+
+	for _, sig := range append(append([]TxSignature{}, t.Signatures...), sigs...) {
+		if i, ok := seen[sig.PublicKey]; ok {
+			merged[i] = sig
+			continue
+		}
+
+		seen[sig.PublicKey] = len(merged)
+		merged = append(merged, sig)
+	}
+
+	t.Signatures = merged
+
+	return t
+}
+
+// NextNonce returns the nonce the next TX spending from a multisig account must carry.
+func (s *State) NextNonce(account Account) uint64 {
+	return s.nonces[account] + 1
+}
+
+func verifyMultisig(tx Tx, s *State) error {
+	if tx.Multisig == nil {
+		return fmt.Errorf("bad TX. Spending from multisig account '%s' requires its policy", tx.From)
+	}
+
+	err := tx.Multisig.validate()
+	if err != nil {
+		return fmt.Errorf("bad TX. %s", err.Error())
+	}
+
+	account, err := tx.Multisig.Account()
+	if err != nil {
+		return err
+	}
+
+	if account != tx.From {
+		return fmt.Errorf("bad TX. Multisig policy belongs to '%s' not '%s'", account, tx.From)
+	}
+
+	if tx.Nonce != s.NextNonce(tx.From) {
+		return fmt.Errorf("bad TX. Next nonce of '%s' must be '%d' not '%d'", tx.From, s.NextNonce(tx.From), tx.Nonce)
+	}
+
+	signingHash, err := tx.SigningHash()
+	if err != nil {
+		return err
+	}
+
+	signers := make(map[PublicKey]bool)
+	for _, sig := range tx.Signatures {
+		if !tx.Multisig.hasKey(sig.PublicKey) || signers[sig.PublicKey] {
+			continue
+		}
+
+		if ed25519.Verify(sig.PublicKey[:], signingHash[:], sig.Signature[:]) {
+			signers[sig.PublicKey] = true
+		}
+	}
+
+	if uint(len(signers)) < tx.Multisig.Threshold {
+		return fmt.Errorf("bad TX. '%s' requires %d valid signatures, the TX has %d", tx.From, tx.Multisig.Threshold, len(signers))
+	}
+
+	s.nonces[tx.From] = tx.Nonce
+
+	return nil
+}
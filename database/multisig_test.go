@@ -0,0 +1,168 @@
+package database
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func newTestMultisig(t *testing.T, threshold uint, owners int) (MultisigPolicy, Account, []ed25519.PrivateKey) {
+	t.Helper()
+
+	publicKeys := make([]PublicKey, owners)
+	privateKeys := make([]ed25519.PrivateKey, owners)
+	for i := range publicKeys {
+		publicKey, privateKey, err := GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		publicKeys[i] = publicKey
+		privateKeys[i] = privateKey
+	}
+
+	policy, err := NewMultisigPolicy(threshold, publicKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := policy.Account()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return policy, account, privateKeys
+}
+
+func signTestTx(t *testing.T, tx Tx, keys ...ed25519.PrivateKey) Tx {
+	t.Helper()
+
+	for _, key := range keys {
+		var err error
+		tx, err = tx.Sign(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return tx
+}
+
+func TestMultisigThreshold(t *testing.T) {
+	policy, account, keys := newTestMultisig(t, 2, 3)
+	_, otherPolicyAccount, _ := newTestMultisig(t, 2, 3)
+	_, _, strangers := newTestMultisig(t, 1, 1)
+	genesis := fmt.Sprintf(`{"balances": {"jrhodes": 1000000, "%s": 100}}`, account)
+
+	spend := func(nonce uint64) Tx {
+		tx := NewTx(account, "meads", NewAmount(10), "")
+		tx.Nonce = nonce
+		tx.Multisig = &policy
+		return tx
+	}
+
+	tests := []struct {
+		name string
+		txs  func() []Tx
+		err  string
+	}{
+		{"2 of 3 signatures", func() []Tx { return []Tx{signTestTx(t, spend(1), keys[0], keys[2])} }, ""},
+		{"3 of 3 signatures", func() []Tx { return []Tx{signTestTx(t, spend(1), keys...)} }, ""},
+		{"consecutive nonces", func() []Tx {
+			return []Tx{signTestTx(t, spend(1), keys[0], keys[1]), signTestTx(t, spend(2), keys[1], keys[2])}
+		}, ""},
+		{"1 of 3 signatures", func() []Tx { return []Tx{signTestTx(t, spend(1), keys[1])} }, "requires 2 valid signatures, the TX has 1"},
+		{"same signer twice", func() []Tx {
+			tx := signTestTx(t, spend(1), keys[1])
+			tx.Signatures = append(tx.Signatures, tx.Signatures[0])
+			return []Tx{tx}
+		}, "requires 2 valid signatures, the TX has 1"},
+		{"signature of a stranger", func() []Tx { return []Tx{signTestTx(t, spend(1), keys[0], strangers[0])} }, "the TX has 1"},
+		{"TX changed after signing", func() []Tx {
+			tx := signTestTx(t, spend(1), keys[0], keys[1])
+			tx.Value = NewAmount(20)
+			return []Tx{tx}
+		}, "the TX has 0"},
+		{"no policy", func() []Tx {
+			tx := spend(1)
+			tx.Multisig = nil
+			return []Tx{signTestTx(t, tx, keys...)}
+		}, "requires its policy"},
+		{"policy of another account", func() []Tx {
+			tx := spend(1)
+			tx.From = otherPolicyAccount
+			return []Tx{signTestTx(t, tx, keys...)}
+		}, "Multisig policy belongs to"},
+		{"replayed TX", func() []Tx {
+			tx := signTestTx(t, spend(1), keys[0], keys[1])
+			return []Tx{tx, tx}
+		}, "Next nonce of"},
+		{"skipped nonce", func() []Tx { return []Tx{signTestTx(t, spend(2), keys...)} }, "must be '1' not '2'"},
+	}
+
+	for _, test := range tests {
+		s := newTestState(t, genesis)
+		txs := test.txs()
+
+		_, err := s.AddBlock(nextTestBlock(s, txs...))
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: expected the block to be accepted, got '%s'", test.name, err)
+				continue
+			}
+
+			if s.Balances["meads"] != NewAmount(10*uint64(len(txs))) || s.NextNonce(account) != uint64(len(txs))+1 {
+				t.Errorf("%s: meads holds %s and the next nonce is %d after the multisig spends", test.name, s.Balances["meads"], s.NextNonce(account))
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+
+		if s.NextNonce(account) != 1 {
+			t.Errorf("%s: a rejected block must not use the nonce", test.name)
+		}
+	}
+}
+
+func TestMultisigPolicy(t *testing.T) {
+	a, _, _ := GenerateKey()
+	b, _, _ := GenerateKey()
+
+	tests := []struct {
+		name      string
+		threshold uint
+		keys      []PublicKey
+		err       string
+	}{
+		{"1 of 1", 1, []PublicKey{a}, ""},
+		{"2 of 2", 2, []PublicKey{b, a}, ""},
+		{"no keys", 1, nil, "between 1 and 16 public keys, not 0"},
+		{"threshold above the keys", 3, []PublicKey{a, b}, "threshold must be between 1 and 2, not 3"},
+		{"zero threshold", 0, []PublicKey{a, b}, "threshold must be between 1 and 2, not 0"},
+		{"duplicate key", 1, []PublicKey{a, a}, "must be unique"},
+	}
+
+	for _, test := range tests {
+		_, err := NewMultisigPolicy(test.threshold, test.keys)
+		if test.err == "" && err != nil {
+			t.Errorf("%s: expected a valid policy, got '%s'", test.name, err)
+		}
+
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+	}
+
+	// The order owners are listed in doesn't change the account
+	ab, _ := NewMultisigPolicy(1, []PublicKey{a, b})
+	ba, _ := NewMultisigPolicy(1, []PublicKey{b, a})
+	abAccount, _ := ab.Account()
+	baAccount, _ := ba.Account()
+	if abAccount != baAccount || !IsMultisigAccount(abAccount) {
+		t.Errorf("policies of the same owners define '%s' and '%s', expected one multisig account", abAccount, baAccount)
+	}
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const TxTypeNameRegister TxType = "name_register"
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{2,31}$`)
+
+// NameRecord maps a human-readable name to an address. Only its owner can point it elsewhere.
+type NameRecord struct {
+	Name        string  `json:"name"`
+	Address     Account `json:"address"`
+	Owner       Account `json:"owner"`
+	BlockNumber uint64  `json:"block_number"`
+}
+
+// NewNameRegisterTx registers a name for an address, or points a name its owner registered to a new address.
+func NewNameRegisterTx(owner Account, name string, address Account) Tx {
+	return Tx{From: owner, To: address, Type: TxTypeNameRegister, Name: name}
+}
+
+func (s *State) LookupName(name string) (NameRecord, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.names[name]
+
+	return record, ok
+}
+
+// ResolveAccount returns the address a registered name points to, or the account itself.
+func (s *State) ResolveAccount(nameOrAccount string) Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if record, ok := s.names[nameOrAccount]; ok {
+		return record.Address
+	}
+
+	return NewAccount(nameOrAccount)
+}
+
+func applyNameRegister(tx Tx, s *State) error {
+	if tx.IsTimeLocked() {
+		return fmt.Errorf("bad TX. Name register TXs can't be time-locked")
+	}
+
+	if !namePattern.MatchString(tx.Name) {
+		return fmt.Errorf("bad TX. '%s' is not a valid name, it must be 3 to 32 lower-case letters, digits, '_' or '-'", tx.Name)
+	}
+
+	if tx.Value != 0 {
+		return fmt.Errorf("bad TX. Registering a name doesn't transfer any value")
+	}
+
+	if tx.To == "" {
+		return fmt.Errorf("bad TX. Name '%s' must point to an address", tx.Name)
+	}
+
+	record, exists := s.names[tx.Name]
+	if exists && record.Owner != tx.From {
+		return fmt.Errorf("bad TX. Name '%s' is already registered by '%s'", tx.Name, record.Owner)
+	}
+
+	// A name spelled like an existing account would redirect TXs meant for it, only that account may claim it
+	if !exists && tx.From != NewAccount(tx.Name) && s.accountExists(NewAccount(tx.Name)) {
+		return fmt.Errorf("bad TX. Name '%s' is an existing account, only that account can register it", tx.Name)
+	}
+
+	s.names[tx.Name] = NameRecord{
+		Name:        tx.Name,
+		Address:     tx.To,
+		Owner:       tx.From,
+		BlockNumber: s.NextBlockNumber(),
+	}
+
+	return nil
+}
+
+func (s *State) accountExists(account Account) bool {
+	if _, ok := s.Balances[account]; ok {
+		return true
+	}
+
+	_, ok := s.locked[account]
+
+	return ok
+}
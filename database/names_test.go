@@ -0,0 +1,103 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameRegistration(t *testing.T) {
+	tests := []struct {
+		name    string
+		txs     []Tx
+		err     string
+		address Account
+		owner   Account
+	}{
+		{"register", []Tx{NewNameRegisterTx("jrhodes", "bar-owner", "jrhodes")}, "", "jrhodes", "jrhodes"},
+		{
+			"owner points the name elsewhere",
+			[]Tx{NewNameRegisterTx("jrhodes", "bar-owner", "jrhodes"), NewNameRegisterTx("jrhodes", "bar-owner", "meads")},
+			"", "meads", "jrhodes",
+		},
+		{
+			"name registered by another account",
+			[]Tx{NewNameRegisterTx("jrhodes", "bar-owner", "jrhodes"), NewNameRegisterTx("meads", "bar-owner", "meads")},
+			"Name 'bar-owner' is already registered by 'jrhodes'", "", "",
+		},
+		{"account registers its own name", []Tx{NewNameRegisterTx("jrhodes", "jrhodes", "meads")}, "", "meads", "jrhodes"},
+		{"name of another account", []Tx{NewNameRegisterTx("meads", "jrhodes", "meads")}, "Name 'jrhodes' is an existing account", "", ""},
+		{"upper-case name", []Tx{NewNameRegisterTx("jrhodes", "BarOwner", "jrhodes")}, "'BarOwner' is not a valid name", "", ""},
+		{"too short name", []Tx{NewNameRegisterTx("jrhodes", "ab", "jrhodes")}, "'ab' is not a valid name", "", ""},
+		{"no address", []Tx{NewNameRegisterTx("jrhodes", "bar-owner", "")}, "must point to an address", "", ""},
+		{
+			"registration with value",
+			[]Tx{{From: "jrhodes", To: "jrhodes", Value: NewAmount(1), Type: TxTypeNameRegister, Name: "bar-owner"}},
+			"doesn't transfer any value", "", "",
+		},
+		{
+			"time-locked registration",
+			[]Tx{{From: "jrhodes", To: "jrhodes", Type: TxTypeNameRegister, Name: "bar-owner", UnlockHeight: 5}},
+			"can't be time-locked", "", "",
+		},
+	}
+
+	for _, test := range tests {
+		s := newTestState(t, testGenesis)
+
+		_, err := s.AddBlock(nextTestBlock(s, test.txs...))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: expected the block to be accepted, got '%s'", test.name, err)
+			continue
+		}
+
+		registered := test.txs[0].Name
+		record, ok := s.LookupName(registered)
+		if !ok || record.Address != test.address || record.Owner != test.owner || record.BlockNumber != 0 {
+			t.Errorf("%s: record is %+v, expected '%s' owned by '%s'", test.name, record, test.address, test.owner)
+		}
+
+		if s.ResolveAccount(registered) != test.address {
+			t.Errorf("%s: '%s' resolves to '%s', expected '%s'", test.name, registered, s.ResolveAccount(registered), test.address)
+		}
+	}
+}
+
+func TestResolveAccount(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addTestBlock(t, s, SealKey{}, NewNameRegisterTx("meads", "tab-dealer", "lhendricks"))
+	s.Close()
+
+	s, err = NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		nameOrAccount string
+		account       Account
+	}{
+		{"tab-dealer", "lhendricks"},
+		{"lhendricks", "lhendricks"},
+		{"unknown-name", "unknown-name"},
+	}
+
+	for _, test := range tests {
+		if account := s.ResolveAccount(test.nameOrAccount); account != test.account {
+			t.Errorf("'%s' resolves to '%s', expected '%s'", test.nameOrAccount, account, test.account)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaxOrphanBlocks is how many blocks with an unknown parent the State keeps while waiting for their ancestors.
+const MaxOrphanBlocks = 256
+
+// AddBlocks adds the blocks in order.
+//
+// A block forking from the chain is validated and retained as a side chain block, and a block whose
+// parent isn't known yet is kept in the orphan pool instead of being rejected, until its parent arrives.
+// Invalid orphans don't stop the other blocks from being added, their errors are returned once all are.
+func (s *State) AddBlocks(blocks []Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orphanErrs := make([]error, 0)
+	for _, b := range blocks {
+		hash, err := b.Hash()
+		if err != nil {
+			return err
+		}
+
+		known := b.Header.Parent == s.latestBlockHash || b.Header.Parent.IsEmpty() || s.isKnownBlock(b.Header.Parent)
+		if !known {
+			err = s.addOrphan(b)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		err = s.connectBlock(b)
+		if err != nil {
+			return err
+		}
+
+		orphanErrs = append(orphanErrs, s.connectOrphans(hash)...)
+	}
+
+	return joinErrors(orphanErrs)
+}
+
+// connectBlock adds a block whose parent is known, to the chain when it extends its tip or to a side chain.
+func (s *State) connectBlock(b Block) error {
+	if b.Header.Parent == s.latestBlockHash {
+		_, err := s.addBlock(b)
+
+		return err
+	}
+
+	return s.addSideBlock(b)
+}
+
+// Orphans returns the blocks waiting for their parent, sorted by number.
+func (s *State) Orphans() []Block {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sortedOrphans()
+}
+
+func (s *State) sortedOrphans() []Block {
+	orphans := make([]Block, 0, len(s.orphans))
+	for _, orphan := range s.orphans {
+		orphans = append(orphans, orphan)
+	}
+
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].Header.Number < orphans[j].Header.Number
+	})
+
+	return orphans
+}
+
+// MissingAncestors returns the hashes of the blocks the orphans wait for, the lowest first.
+func (s *State) MissingAncestors() []Hash {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	missing := make([]Hash, 0)
+	for _, orphan := range s.sortedOrphans() {
+		if _, ok := s.orphans[orphan.Header.Parent]; !ok {
+			missing = append(missing, orphan.Header.Parent)
+		}
+	}
+
+	return missing
+}
+
+func (s *State) addOrphan(b Block) error {
+	hash, err := b.Hash()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := s.orphans[hash]; ok {
+		return nil
+	}
+
+	// A full pool makes room by dropping the orphan the furthest away from the chain
+	if len(s.orphans) >= MaxOrphanBlocks {
+		orphans := s.sortedOrphans()
+		furthest := orphans[len(orphans)-1]
+		if b.Header.Number >= furthest.Header.Number {
+			return fmt.Errorf("orphan pool is full, block %d is too far ahead of the chain", b.Header.Number)
+		}
+
+		furthestHash, err := furthest.Hash()
+		if err != nil {
+			return err
+		}
+		delete(s.orphans, furthestHash)
+	}
+
+	fmt.Printf("Keeping block %d '%s' until its parent '%s' arrives\n", b.Header.Number, hash.Hex(), b.Header.Parent.Hex())
+	s.orphans[hash] = b
+
+	return nil
+}
+
+// connectOrphans connects the orphans waiting for the block, then the orphans waiting for them.
+//
+// An invalid orphan is dropped together with its descendants, which can't be valid either,
+// and the other orphans keep connecting. It returns the errors of the dropped orphans.
+func (s *State) connectOrphans(parent Hash) []error {
+	errs := make([]error, 0)
+	queue := []Hash{parent}
+
+	for len(queue) > 0 {
+		parent, queue = queue[0], queue[1:]
+
+		for _, hash := range s.orphanChildren(parent) {
+			orphan := s.orphans[hash]
+			delete(s.orphans, hash)
+
+			err := s.connectBlock(orphan)
+			if err != nil {
+				dropped := s.dropOrphanDescendants(hash)
+				fmt.Printf("Dropping invalid orphan block %d '%s' and its %d descendants\n", orphan.Header.Number, hash.Hex(), dropped)
+				errs = append(errs, fmt.Errorf("invalid orphan block %d '%s'. %s", orphan.Header.Number, hash.Hex(), err.Error()))
+
+				continue
+			}
+			queue = append(queue, hash)
+		}
+	}
+
+	return errs
+}
+
+// orphanChildren returns the hashes of the orphans waiting for the block, the lowest first.
+func (s *State) orphanChildren(parent Hash) []Hash {
+	children := make([]Hash, 0)
+	for hash, orphan := range s.orphans {
+		if orphan.Header.Parent == parent {
+			children = append(children, hash)
+		}
+	}
+
+	sort.Slice(children, func(i, j int) bool {
+		return s.orphans[children[i]].Header.Number < s.orphans[children[j]].Header.Number
+	})
+
+	return children
+}
+
+// dropOrphanDescendants removes every orphan descending from the block from the pool, returning how many.
+func (s *State) dropOrphanDescendants(ancestor Hash) int {
+	dropped := 0
+	queue := []Hash{ancestor}
+
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+
+		for hash, orphan := range s.orphans {
+			if orphan.Header.Parent == parent {
+				delete(s.orphans, hash)
+				queue = append(queue, hash)
+				dropped++
+			}
+		}
+	}
+
+	return dropped
+}
+
+// joinErrors returns the errors as one, nil when there are none.
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	if len(errs) == 1 {
+		return errs[0]
+	}
+
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Errorf("%d errors: %s", len(errs), strings.Join(msgs, "; "))
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOrphansConnectOnceTheirParentArrives(t *testing.T) {
+	builder := newTestState(t, testGenesis)
+	blocks := make([]Block, 0)
+	for i := 0; i < 5; i++ {
+		blocks = append(blocks, addTestBlock(t, builder, SealKey{}, NewTx("jrhodes", "meads", NewAmount(uint64(i+1)), "")))
+	}
+
+	state := newTestState(t, testGenesis)
+	err := state.AddBlocks(blocks[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		blocks  []Block
+		orphans []Block
+		missing []Block
+	}{
+		{"blocks ahead of the chain wait", []Block{blocks[4], blocks[2]}, []Block{blocks[2], blocks[4]}, []Block{blocks[1], blocks[3]}},
+		{"an orphan already kept is ignored", []Block{blocks[2]}, []Block{blocks[2], blocks[4]}, []Block{blocks[1], blocks[3]}},
+		{"an orphan child of an orphan waits too", []Block{blocks[3]}, []Block{blocks[2], blocks[3], blocks[4]}, []Block{blocks[1]}},
+		{"the missing parent connects every orphan", []Block{blocks[1]}, []Block{}, []Block{}},
+	}
+
+	for _, test := range tests {
+		err = state.AddBlocks(test.blocks)
+		if err != nil {
+			t.Fatalf("%s: adding the blocks failed: %s", test.name, err)
+		}
+
+		orphans := state.Orphans()
+		if len(orphans) != len(test.orphans) {
+			t.Errorf("%s: the pool holds %d orphans, expected %d", test.name, len(orphans), len(test.orphans))
+			continue
+		}
+		for i := range orphans {
+			if hashOf(t, orphans[i]) != hashOf(t, test.orphans[i]) {
+				t.Errorf("%s: orphan %d is block %d, expected block %d", test.name, i, orphans[i].Header.Number, test.orphans[i].Header.Number)
+			}
+		}
+
+		missing := state.MissingAncestors()
+		if len(missing) != len(test.missing) {
+			t.Errorf("%s: %d ancestors are missing, expected %d", test.name, len(missing), len(test.missing))
+			continue
+		}
+		for i := range missing {
+			if missing[i] != hashOf(t, test.missing[i]) {
+				t.Errorf("%s: missing ancestor %d is '%s', expected block %d", test.name, i, missing[i].Hex(), test.missing[i].Header.Number)
+			}
+		}
+	}
+
+	if state.LatestBlockHash() != builder.LatestBlockHash() {
+		t.Errorf("tip is block %d, expected the connected orphans to extend the chain to block 4", state.LatestBlock().Header.Number)
+	}
+
+	if state.Balances["meads"] != builder.Balances["meads"] {
+		t.Errorf("meads balance is %s, expected %s", state.Balances["meads"], builder.Balances["meads"])
+	}
+}
+
+func TestInvalidOrphanIsDropped(t *testing.T) {
+	state := newTestState(t, testGenesis)
+	first := addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+
+	builder := newTestState(t, testGenesis)
+	_, err := builder.AddBlock(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := addTestBlock(t, builder, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+	invalid := NewBlock(hashOf(t, parent), 2, testBlockTime+30, []Tx{NewTx("meads", "jrhodes", NewAmount(1000), "")})
+
+	err = state.AddBlocks([]Block{invalid})
+	if err != nil || len(state.Orphans()) != 1 {
+		t.Fatalf("expected the block to be kept as an orphan, got '%v'", err)
+	}
+
+	err = state.AddBlocks([]Block{parent})
+	if err == nil || !strings.Contains(err.Error(), "Tx cost is 1000 TBB") {
+		t.Errorf("expected the invalid orphan to be rejected once its parent arrives, got '%v'", err)
+	}
+
+	if len(state.Orphans()) != 0 || state.LatestBlockHash() != hashOf(t, parent) {
+		t.Errorf("the parent must be added and the invalid orphan dropped")
+	}
+}
+
+func TestInvalidOrphanOnlyDropsItsDescendants(t *testing.T) {
+	state := newTestState(t, testGenesis)
+	first := addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+
+	builder := newTestState(t, testGenesis)
+	_, err := builder.AddBlock(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := addTestBlock(t, builder, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+	valid := addTestBlock(t, builder, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+	validChild := addTestBlock(t, builder, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+
+	// Two invalid siblings of the valid orphan, one of them with a child of its own
+	invalid := NewBlock(hashOf(t, parent), 2, testBlockTime+31, []Tx{NewTx("meads", "jrhodes", NewAmount(1000), "")})
+	invalidChild := NewBlock(hashOf(t, invalid), 3, testBlockTime+45, nil)
+	otherInvalid := NewBlock(hashOf(t, parent), 2, testBlockTime+32, []Tx{NewTx("meads", "jrhodes", NewAmount(2000), "")})
+
+	err = state.AddBlocks([]Block{invalidChild, invalid, validChild, otherInvalid, valid})
+	if err != nil || len(state.Orphans()) != 5 {
+		t.Fatalf("expected the blocks to be kept as orphans, got '%v'", err)
+	}
+
+	err = state.AddBlocks([]Block{parent})
+	for _, expected := range []string{"2 errors", hashOf(t, invalid).Hex(), hashOf(t, otherInvalid).Hex()} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected an error containing '%s', got '%v'", expected, err)
+		}
+	}
+
+	if state.LatestBlockHash() != hashOf(t, validChild) {
+		t.Errorf("tip is block %d, expected the valid orphans to extend the chain to block 3", state.LatestBlock().Header.Number)
+	}
+
+	if len(state.Orphans()) != 0 {
+		t.Errorf("the invalid orphans and their descendants must be dropped, %d orphans are left", len(state.Orphans()))
+	}
+}
+
+func TestOrphanPoolIsBounded(t *testing.T) {
+	state := newTestState(t, testGenesis)
+
+	orphanAt := func(number uint64) Block {
+		return NewBlock(Hash{0xff, byte(number), byte(number >> 8)}, number, testBlockTime+15*number, nil)
+	}
+
+	blocks := make([]Block, 0, MaxOrphanBlocks)
+	for i := uint64(0); i < MaxOrphanBlocks; i++ {
+		blocks = append(blocks, orphanAt(10+i))
+	}
+
+	err := state.AddBlocks(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	furthest := blocks[len(blocks)-1].Header.Number
+
+	err = state.AddBlocks([]Block{orphanAt(furthest + 1)})
+	if err == nil || !strings.Contains(err.Error(), "orphan pool is full") {
+		t.Errorf("expected a block further than every orphan to be refused, got '%v'", err)
+	}
+
+	// A block closer to the chain takes the place of the furthest orphan
+	err = state.AddBlocks([]Block{orphanAt(5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orphans := state.Orphans()
+	if len(orphans) != MaxOrphanBlocks {
+		t.Errorf("the pool holds %d orphans, expected %d", len(orphans), MaxOrphanBlocks)
+	}
+
+	if orphans[0].Header.Number != 5 || orphans[len(orphans)-1].Header.Number != furthest-1 {
+		t.Errorf("the pool holds blocks %d to %d, expected 5 to %d", orphans[0].Header.Number, orphans[len(orphans)-1].Header.Number, furthest-1)
+	}
+}
+
+func TestStateIsSafeForConcurrentUse(t *testing.T) {
+	builder := newTestState(t, testGenesis)
+	blocks := make([]Block, 0)
+	for i := 0; i < 20; i++ {
+		blocks = append(blocks, addTestBlock(t, builder, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), "")))
+	}
+
+	state := newTestState(t, testGenesis)
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					state.Orphans()
+					state.MissingAncestors()
+					state.LatestBlock()
+					state.BalancesOf(NativeAsset)
+				}
+			}
+		}()
+	}
+
+	// The blocks arrive latest first, so every one but the first waits in the orphan pool
+	for i := len(blocks) - 1; i >= 0; i-- {
+		err := state.AddBlocks(blocks[i : i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	readers.Wait()
+
+	if state.LatestBlockHash() != builder.LatestBlockHash() || len(state.Orphans()) != 0 {
+		t.Errorf("expected every orphan to connect, tip is block %d", state.LatestBlock().Header.Number)
+	}
+}
@@ -0,0 +1,224 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ConsensusPoA is the Proof-of-Authority consensus, blocks are sealed by the signers listed in genesis.
+const ConsensusPoA = "poa"
+
+const TxTypePoaVote TxType = "poa_vote"
+
+// PoaVote is a signer vote to authorize a new signer, with its public key, or to remove one.
+// A vote passes once more than half of the signers cast the same vote for the same candidate.
+type PoaVote struct {
+	Authorize bool      `json:"authorize"`
+	PublicKey PublicKey `json:"public_key"`
+}
+
+type poaConsensus struct{}
+
+func (c poaConsensus) Name() string {
+	return ConsensusPoA
+}
+
+func (c poaConsensus) VerifyHeader(b Block, s *State) error {
+	err := verifyUnmined(b, c)
+	if err != nil {
+		return err
+	}
+
+	err = verifySignerSeal(b, s)
+	if err != nil {
+		return err
+	}
+
+	return validateVoters(b)
+}
+
+func (c poaConsensus) Prepare(header *BlockHeader, s *State) error {
+	return nil
+}
+
+func (c poaConsensus) Seal(b Block, s *State, key SealKey) (Block, error) {
+	publicKey, ok := s.SignerKey(key.Account)
+	if !ok || !key.matches(publicKey) {
+		return Block{}, fmt.Errorf("'%s' isn't an authorized signer with the node key, it can't seal blocks", key.Account)
+	}
+
+	if !s.CanSeal(key.Account) {
+		return Block{}, fmt.Errorf("signer '%s' sealed a recent block, it's another signer's turn", key.Account)
+	}
+
+	return b.Sign(key)
+}
+
+func (c poaConsensus) Finalize(b Block, s *State) error {
+	trackSigner(b.Header, s)
+
+	return nil
+}
+
+func (c poaConsensus) ForkChoice(local ChainHead, peer ChainHead) bool {
+	return longestChain(local, peer)
+}
+
+// NewPoaVoteTx casts the vote of a signer about a candidate. Votes must be sealed by the voter itself.
+func NewPoaVoteTx(signer Account, candidate Account, vote PoaVote) Tx {
+	return Tx{From: signer, To: candidate, Type: TxTypePoaVote, Vote: &vote}
+}
+
+// Signers returns the accounts authorized to seal blocks, sorted.
+func (s *State) Signers() []Account {
+	signers := make([]Account, 0, len(s.signers))
+	for signer := range s.signers {
+		signers = append(signers, signer)
+	}
+
+	sort.Slice(signers, func(i, j int) bool {
+		return signers[i] < signers[j]
+	})
+
+	return signers
+}
+
+func (s *State) IsSigner(account Account) bool {
+	_, ok := s.SignerKey(account)
+
+	return ok
+}
+
+func (s *State) SignerKey(signer Account) (PublicKey, bool) {
+	publicKey, ok := s.signers[signer]
+
+	return publicKey, ok
+}
+
+// signerLimit is how many of the latest blocks a signer must wait for before sealing again,
+// so signers take turns and a single signer can't seal a chain on its own.
+func (s *State) signerLimit() int {
+	return len(s.signers) / 2
+}
+
+// verifySignerSeal verifies the block is sealed by a signer whose turn it is.
+func verifySignerSeal(b Block, s *State) error {
+	publicKey, ok := s.signers[b.Header.Signer]
+	if !ok {
+		return fmt.Errorf("block signer '%s' isn't an authorized signer", b.Header.Signer)
+	}
+
+	err := verifySignature(b, publicKey)
+	if err != nil {
+		return err
+	}
+
+	if !s.CanSeal(b.Header.Signer) {
+		return fmt.Errorf("signer '%s' sealed one of the last %d blocks, it's another signer's turn", b.Header.Signer, s.signerLimit())
+	}
+
+	return nil
+}
+
+// CanSeal tells if it's the signer's turn to seal the next block.
+func (s *State) CanSeal(signer Account) bool {
+	if !s.IsSigner(signer) {
+		return false
+	}
+
+	recent := s.recentSigners
+	if limit := s.signerLimit(); len(recent) > limit {
+		recent = recent[len(recent)-limit:]
+	}
+
+	for _, recentSigner := range recent {
+		if recentSigner == signer {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateVoters verifies every vote of the block is cast by the signer sealing it.
+func validateVoters(b Block) error {
+	for _, tx := range b.TXs {
+		if tx.Type == TxTypePoaVote && tx.From != b.Header.Signer {
+			return fmt.Errorf("bad TX. Vote of '%s' must be sealed by itself, not by '%s'", tx.From, b.Header.Signer)
+		}
+	}
+
+	return nil
+}
+
+func trackSigner(header BlockHeader, s *State) {
+	s.recentSigners = append(s.recentSigners, header.Signer)
+	if len(s.recentSigners) > len(s.signers) {
+		s.recentSigners = s.recentSigners[len(s.recentSigners)-len(s.signers):]
+	}
+}
+
+func applyPoaVote(tx Tx, s *State) error {
+	if s.consensus.Name() != ConsensusPoA {
+		return fmt.Errorf("bad TX. Votes require the '%s' consensus", ConsensusPoA)
+	}
+
+	if tx.Vote == nil {
+		return fmt.Errorf("bad TX. A vote TX requires a vote")
+	}
+
+	if tx.Value != 0 || tx.IsTimeLocked() {
+		return fmt.Errorf("bad TX. Voting doesn't transfer any value")
+	}
+
+	if !s.IsSigner(tx.From) {
+		return fmt.Errorf("bad TX. '%s' isn't a signer, only signers can vote", tx.From)
+	}
+
+	if tx.Vote.Authorize == s.IsSigner(tx.To) {
+		return fmt.Errorf("bad TX. Vote about '%s' wouldn't change the signers", tx.To)
+	}
+
+	if !tx.Vote.Authorize && len(s.signers) == 1 {
+		return fmt.Errorf("bad TX. The last signer can't be removed")
+	}
+
+	vote := *tx.Vote
+	if !vote.Authorize {
+		vote.PublicKey = PublicKey{}
+	}
+
+	if _, ok := s.votes[tx.To]; !ok {
+		s.votes[tx.To] = make(map[Account]PoaVote)
+	}
+	s.votes[tx.To][tx.From] = vote
+
+	tally := 0
+	for _, cast := range s.votes[tx.To] {
+		if cast == vote {
+			tally++
+		}
+	}
+
+	if tally <= len(s.signers)/2 {
+		return nil
+	}
+
+	delete(s.votes, tx.To)
+
+	if vote.Authorize {
+		s.signers[tx.To] = vote.PublicKey
+
+		return nil
+	}
+
+	delete(s.signers, tx.To)
+	for candidate, votes := range s.votes {
+		delete(votes, tx.To)
+		if len(votes) == 0 {
+			delete(s.votes, candidate)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// newTestKeys generates a seal key for every account.
+func newTestKeys(t *testing.T, accounts ...Account) map[Account]SealKey {
+	t.Helper()
+
+	keys := make(map[Account]SealKey)
+	for _, account := range accounts {
+		_, privateKey, err := GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys[account] = SealKey{Account: account, PrivateKey: privateKey}
+	}
+
+	return keys
+}
+
+func publicKeyOf(key SealKey) PublicKey {
+	var publicKey PublicKey
+	copy(publicKey[:], key.PrivateKey[32:])
+
+	return publicKey
+}
+
+func newPoaTestState(t *testing.T, keys map[Account]SealKey, signers ...Account) *State {
+	t.Helper()
+
+	gen := genesis{Balances: map[Account]Amount{"jrhodes": NewAmount(1000000)}, Consensus: ConsensusPoA, Signers: make(map[Account]PublicKey)}
+	for _, signer := range signers {
+		gen.Signers[signer] = publicKeyOf(keys[signer])
+	}
+
+	genesisJson, err := json.Marshal(gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestState(t, string(genesisJson))
+}
+
+func TestPoaSignersTakeTurns(t *testing.T) {
+	keys := newTestKeys(t, "alice", "bob", "carol", "dave")
+
+	tests := []struct {
+		name    string
+		signers []Account
+		sealers []Account
+		err     string
+	}{
+		{"signers rotate", []Account{"alice", "bob", "carol"}, []Account{"alice", "bob", "alice", "carol", "bob"}, ""},
+		{"signer seals twice in a row", []Account{"alice", "bob", "carol"}, []Account{"alice", "bob", "bob"}, "it's another signer's turn"},
+		{"signer waits for half of the others", []Account{"alice", "bob", "carol", "dave"}, []Account{"alice", "bob", "alice"}, "it's another signer's turn"},
+		{"a single signer seals every block", []Account{"alice"}, []Account{"alice", "alice", "alice"}, ""},
+		{"unauthorized signer", []Account{"alice", "bob"}, []Account{"alice", "dave"}, "isn't an authorized signer"},
+	}
+
+	for _, test := range tests {
+		state := newPoaTestState(t, keys, test.signers...)
+
+		var err error
+		for _, sealer := range test.sealers {
+			// Signing directly skips the turn checks of Seal, so AddBlock has to enforce them
+			var b Block
+			b, err = nextTestBlock(state, NewTx("jrhodes", "meads", NewAmount(1), "")).Sign(keys[sealer])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = state.AddBlock(b)
+			if err != nil {
+				break
+			}
+		}
+
+		if test.err == "" && err != nil {
+			t.Errorf("%s: adding the blocks failed: %s", test.name, err)
+		}
+
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+	}
+}
+
+func TestPoaRejectsInvalidSeals(t *testing.T) {
+	keys := newTestKeys(t, "alice", "bob")
+	state := newPoaTestState(t, keys, "alice", "bob")
+
+	unsigned := nextTestBlock(state)
+
+	forged := keys["bob"]
+	forged.Account = "alice"
+	wrongKey, err := nextTestBlock(state).Sign(forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered, err := nextTestBlock(state).Sign(keys["alice"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered.TXs = []Tx{NewTx("jrhodes", "alice", NewAmount(1000), "")}
+
+	mined, err := nextTestBlock(state).Sign(keys["alice"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	mined.Header.Difficulty = 1000
+
+	tests := []struct {
+		name  string
+		block Block
+		err   string
+	}{
+		{"unsigned block", unsigned, "isn't an authorized signer"},
+		{"signature of another key", wrongKey, "isn't a valid signature"},
+		{"block changed after sealing", tampered, "isn't a valid signature"},
+		{"block with a PoW difficulty", mined, "doesn't mine blocks"},
+	}
+
+	for _, test := range tests {
+		_, err = state.AddBlock(test.block)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+	}
+
+	_, err = sealTestBlock(state, keys["alice"], nextTestBlock(state))
+	if err != nil {
+		t.Errorf("sealing with the signer key failed: %s", err)
+	}
+
+	_, err = sealTestBlock(state, SealKey{Account: "alice", PrivateKey: keys["bob"].PrivateKey}, nextTestBlock(state))
+	if err == nil {
+		t.Errorf("sealing with another key than the signer one must fail")
+	}
+}
+
+func TestPoaVotes(t *testing.T) {
+	keys := newTestKeys(t, "alice", "bob", "carol", "dave")
+	daveKey := publicKeyOf(keys["dave"])
+
+	state := newPoaTestState(t, keys, "alice", "bob", "carol")
+
+	// One vote out of three signers isn't a majority
+	addTestBlock(t, state, keys["alice"], NewPoaVoteTx("alice", "dave", PoaVote{Authorize: true, PublicKey: daveKey}))
+	if state.IsSigner("dave") {
+		t.Fatalf("dave must not be a signer after a single vote")
+	}
+
+	// Votes must be sealed by the voter itself
+	b, err := sealTestBlock(state, keys["carol"], nextTestBlock(state, NewPoaVoteTx("bob", "dave", PoaVote{Authorize: true, PublicKey: daveKey})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = state.AddBlock(b)
+	if err == nil || !strings.Contains(err.Error(), "must be sealed by itself") {
+		t.Fatalf("expected a vote sealed by another signer to be rejected, got '%v'", err)
+	}
+
+	addTestBlock(t, state, keys["bob"], NewPoaVoteTx("bob", "dave", PoaVote{Authorize: true, PublicKey: daveKey}))
+	if key, ok := state.SignerKey("dave"); !ok || key != daveKey {
+		t.Fatalf("dave must be a signer with its public key after two votes out of three")
+	}
+
+	// Four signers now, removing carol takes three votes
+	addTestBlock(t, state, keys["dave"], NewPoaVoteTx("dave", "carol", PoaVote{}))
+	addTestBlock(t, state, keys["alice"], NewPoaVoteTx("alice", "carol", PoaVote{}))
+	if !state.IsSigner("carol") {
+		t.Fatalf("carol must still be a signer after two votes out of four")
+	}
+
+	addTestBlock(t, state, keys["bob"], NewPoaVoteTx("bob", "carol", PoaVote{}))
+	if state.IsSigner("carol") {
+		t.Fatalf("carol must be removed after three votes out of four")
+	}
+
+	expected := []Account{"alice", "bob", "dave"}
+	if signers := state.Signers(); len(signers) != len(expected) || signers[0] != expected[0] || signers[1] != expected[1] || signers[2] != expected[2] {
+		t.Errorf("signers are %v, expected %v", signers, expected)
+	}
+
+	_, err = sealTestBlock(state, keys["carol"], nextTestBlock(state))
+	if err == nil {
+		t.Errorf("a removed signer must not seal blocks")
+	}
+}
+
+func TestPoaRejectsInvalidVotes(t *testing.T) {
+	keys := newTestKeys(t, "alice", "bob")
+	state := newPoaTestState(t, keys, "alice", "bob")
+
+	tests := []struct {
+		name string
+		vote Tx
+		err  string
+	}{
+		{"vote of a non-signer", NewPoaVoteTx("meads", "dave", PoaVote{Authorize: true}), "must be sealed by itself"},
+		{"authorizing a signer", NewPoaVoteTx("alice", "bob", PoaVote{Authorize: true}), "wouldn't change the signers"},
+		{"removing a non-signer", NewPoaVoteTx("alice", "dave", PoaVote{}), "wouldn't change the signers"},
+		{"vote transferring value", Tx{From: "alice", To: "dave", Value: NewAmount(1), Type: TxTypePoaVote, Vote: &PoaVote{Authorize: true}}, "doesn't transfer any value"},
+	}
+
+	for _, test := range tests {
+		b, err := sealTestBlock(state, keys["alice"], nextTestBlock(state, test.vote))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = state.AddBlock(b)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// ConsensusPoS is the Proof-of-Stake consensus, each block is sealed by a proposer picked among the
+// validators proportionally to their stake.
+const ConsensusPoS = "pos"
+
+const TxTypeStakeBond TxType = "stake_bond"
+const TxTypeStakeUnbond TxType = "stake_unbond"
+const TxTypeStakeSlash TxType = "stake_slash"
+
+// DefaultUnbondingPeriod is how many blocks unbonded TBB stay slashable before returning to their owner.
+const DefaultUnbondingPeriod = 100
+
+// Validator bonds TBB to propose blocks, sealed with its public key.
+type Validator struct {
+	Account   Account   `json:"account"`
+	PublicKey PublicKey `json:"public_key"`
+	Stake     Amount    `json:"stake"`
+	Slashed   bool      `json:"slashed"`
+}
+
+// GenesisValidator is a validator, and the TBB it bonds, minted by genesis.
+type GenesisValidator struct {
+	PublicKey PublicKey `json:"public_key"`
+	Stake     Amount    `json:"stake"`
+}
+
+// Unbonding is stake on its way back to the liquid balance of its validator.
+type Unbonding struct {
+	Account       Account `json:"account"`
+	Value         Amount  `json:"value"`
+	ReleaseHeight uint64  `json:"release_height"`
+}
+
+// DoubleSignEvidence proves a validator sealed two different blocks at the same height.
+type DoubleSignEvidence struct {
+	First  Block `json:"first"`
+	Second Block `json:"second"`
+}
+
+type posConsensus struct{}
+
+func (c posConsensus) Name() string {
+	return ConsensusPoS
+}
+
+func (c posConsensus) VerifyHeader(b Block, s *State) error {
+	err := verifyUnmined(b, c)
+	if err != nil {
+		return err
+	}
+
+	return verifyProposerSeal(b, s)
+}
+
+func (c posConsensus) Prepare(header *BlockHeader, s *State) error {
+	return nil
+}
+
+func (c posConsensus) Seal(b Block, s *State, key SealKey) (Block, error) {
+	proposer, err := s.Proposer(b.Header.Number, b.Header.Parent)
+	if err != nil {
+		return Block{}, err
+	}
+
+	if proposer != key.Account {
+		return Block{}, fmt.Errorf("block %d must be proposed by validator '%s'", b.Header.Number, proposer)
+	}
+
+	if !key.matches(s.ValidatorKey(proposer)) {
+		return Block{}, fmt.Errorf("validator '%s' public key doesn't match the node key", proposer)
+	}
+
+	return b.Sign(key)
+}
+
+func (c posConsensus) Finalize(b Block, s *State) error {
+	return releaseUnbonded(b.Header, s)
+}
+
+func (c posConsensus) ForkChoice(local ChainHead, peer ChainHead) bool {
+	return longestChain(local, peer)
+}
+
+// NewStakeBondTx bonds value TBB to the validator stake of the sender, its public key is required by the first bond.
+func NewStakeBondTx(validator Account, value Amount, publicKey *PublicKey) Tx {
+	return Tx{From: validator, Value: value, Type: TxTypeStakeBond, ValidatorKey: publicKey}
+}
+
+// NewStakeUnbondTx starts returning value TBB of the sender stake to its balance.
+func NewStakeUnbondTx(validator Account, value Amount) Tx {
+	return Tx{From: validator, Value: value, Type: TxTypeStakeUnbond}
+}
+
+// NewStakeSlashTx burns the whole stake of the validator which double signed.
+func NewStakeSlashTx(reporter Account, evidence DoubleSignEvidence) Tx {
+	return Tx{From: reporter, Type: TxTypeStakeSlash, Evidence: &evidence}
+}
+
+// Validators returns the validators, sorted by account.
+func (s *State) Validators() []Validator {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.sortedValidators()
+}
+
+func (s *State) sortedValidators() []Validator {
+	validators := make([]Validator, 0, len(s.validators))
+	for _, validator := range s.validators {
+		validators = append(validators, validator)
+	}
+
+	sort.Slice(validators, func(i, j int) bool {
+		return validators[i].Account < validators[j].Account
+	})
+
+	return validators
+}
+
+func (s *State) ValidatorKey(validator Account) PublicKey {
+	return s.validators[validator].PublicKey
+}
+
+// Unbondings returns the stake waiting for its unbonding period to end.
+func (s *State) Unbondings() []Unbonding {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.unbonding
+}
+
+func (s *State) StakedSupply() Amount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.stakedSupply()
+}
+
+func (s *State) stakedSupply() Amount {
+	staked := Amount(0)
+	for _, validator := range s.validators {
+		staked += validator.Stake
+	}
+
+	for _, unbonding := range s.unbonding {
+		staked += unbonding.Value
+	}
+
+	return staked
+}
+
+func (s *State) totalStake() Amount {
+	total := Amount(0)
+	for _, validator := range s.validators {
+		total += validator.Stake
+	}
+
+	return total
+}
+
+// Proposer returns the validator which must seal the block with the given header number and parent.
+//
+// The proposer is drawn from the stake of all the validators with a seed derived from the parent hash,
+// so every node agrees on it and each validator proposes in proportion to its stake.
+func (s *State) Proposer(number uint64, parent Hash) (Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	total := s.totalStake()
+	if total == 0 {
+		return "", fmt.Errorf("no validator has any stake")
+	}
+
+	seedInput := make([]byte, len(parent)+8)
+	copy(seedInput, parent[:])
+	binary.BigEndian.PutUint64(seedInput[len(parent):], number)
+	seed := sha256.Sum256(seedInput)
+
+	draw := Amount(binary.BigEndian.Uint64(seed[:8]) % uint64(total))
+	for _, validator := range s.sortedValidators() {
+		if draw < validator.Stake {
+			return validator.Account, nil
+		}
+		draw -= validator.Stake
+	}
+
+	return "", fmt.Errorf("no validator has any stake")
+}
+
+// verifyProposerSeal verifies the block is sealed by its proposer.
+func verifyProposerSeal(b Block, s *State) error {
+	proposer, err := s.Proposer(b.Header.Number, b.Header.Parent)
+	if err != nil {
+		return err
+	}
+
+	if b.Header.Signer != proposer {
+		return fmt.Errorf("block %d must be proposed by '%s' not '%s'", b.Header.Number, proposer, b.Header.Signer)
+	}
+
+	return verifySignature(b, s.ValidatorKey(proposer))
+}
+
+func (s *State) mintStake(account Account, validator GenesisValidator) error {
+	if validator.Stake > maxAmount-s.totalSupply {
+		return fmt.Errorf("minting %s overflows the total supply of %s", validator.Stake, s.totalSupply)
+	}
+
+	s.validators[account] = Validator{Account: account, PublicKey: validator.PublicKey, Stake: validator.Stake}
+	s.totalSupply += validator.Stake
+
+	return nil
+}
+
+func applyStakeTx(tx Tx, s *State) error {
+	if s.consensus.Name() != ConsensusPoS {
+		return fmt.Errorf("bad TX. Staking requires the '%s' consensus", ConsensusPoS)
+	}
+
+	if tx.IsTimeLocked() || tx.AssetID() != NativeAsset {
+		return fmt.Errorf("bad TX. Staking TXs can only move liquid %s", NativeAsset)
+	}
+
+	switch tx.Type {
+	case TxTypeStakeBond:
+		return applyStakeBond(tx, s)
+	case TxTypeStakeUnbond:
+		return applyStakeUnbond(tx, s)
+	default:
+		return applyStakeSlash(tx, s)
+	}
+}
+
+func applyStakeBond(tx Tx, s *State) error {
+	validator, exists := s.validators[tx.From]
+	if !exists {
+		if tx.ValidatorKey == nil {
+			return fmt.Errorf("bad TX. The first bond of '%s' requires its validator public key", tx.From)
+		}
+
+		validator = Validator{Account: tx.From, PublicKey: *tx.ValidatorKey}
+	}
+
+	if validator.Slashed {
+		return fmt.Errorf("bad TX. Validator '%s' was slashed and can't bond anymore", tx.From)
+	}
+
+	if tx.ValidatorKey != nil && *tx.ValidatorKey != validator.PublicKey {
+		return fmt.Errorf("bad TX. Validator '%s' already bonded with another public key", tx.From)
+	}
+
+	if tx.Value == 0 {
+		return fmt.Errorf("bad TX. Bonding requires a value")
+	}
+
+	err := s.debit(tx.From, NativeAsset, tx.Value)
+	if err != nil {
+		return err
+	}
+
+	validator.Stake += tx.Value
+	s.validators[tx.From] = validator
+
+	return nil
+}
+
+func applyStakeUnbond(tx Tx, s *State) error {
+	validator, exists := s.validators[tx.From]
+	if !exists || tx.Value == 0 || tx.Value > validator.Stake {
+		return fmt.Errorf("bad TX. '%s' can't unbond %s of its %s stake", tx.From, tx.Value, validator.Stake)
+	}
+
+	if tx.Value == s.totalStake() {
+		return fmt.Errorf("bad TX. The last stake can't be unbonded, no validator would be left to propose blocks")
+	}
+
+	validator.Stake -= tx.Value
+	s.validators[tx.From] = validator
+
+	s.unbonding = append(s.unbonding, Unbonding{
+		Account:       tx.From,
+		Value:         tx.Value,
+		ReleaseHeight: s.NextBlockNumber() + s.unbondingPeriod,
+	})
+
+	return nil
+}
+
+func applyStakeSlash(tx Tx, s *State) error {
+	if tx.Value != 0 {
+		return fmt.Errorf("bad TX. Slashing doesn't transfer any value")
+	}
+
+	if tx.Evidence == nil {
+		return fmt.Errorf("bad TX. Slashing requires double sign evidence")
+	}
+
+	first, second := tx.Evidence.First, tx.Evidence.Second
+	offender := first.Header.Signer
+
+	if first.Header.Number != second.Header.Number || offender != second.Header.Signer {
+		return fmt.Errorf("bad TX. Evidence blocks must be sealed by the same validator at the same height")
+	}
+
+	firstHash, err := first.SigningHash()
+	if err != nil {
+		return err
+	}
+
+	secondHash, err := second.SigningHash()
+	if err != nil {
+		return err
+	}
+
+	if firstHash == secondHash {
+		return fmt.Errorf("bad TX. Evidence blocks are the same block")
+	}
+
+	validator, exists := s.validators[offender]
+	if !exists || validator.Slashed {
+		return fmt.Errorf("bad TX. '%s' isn't a validator which can be slashed", offender)
+	}
+
+	for _, b := range []Block{first, second} {
+		err = verifySignature(b, validator.PublicKey)
+		if err != nil {
+			return fmt.Errorf("bad TX. Invalid evidence: %s", err.Error())
+		}
+	}
+
+	slashed := validator.Stake
+	pending := make([]Unbonding, 0, len(s.unbonding))
+	for _, unbonding := range s.unbonding {
+		if unbonding.Account == offender {
+			slashed += unbonding.Value
+			continue
+		}
+		pending = append(pending, unbonding)
+	}
+
+	if validator.Stake == s.totalStake() {
+		return fmt.Errorf("bad TX. The last validator with stake can't be slashed, no validator would be left to propose blocks")
+	}
+
+	// Slashed stake is burnt
+	s.unbonding = pending
+	s.totalSupply -= slashed
+	validator.Stake = 0
+	validator.Slashed = true
+	s.validators[offender] = validator
+
+	return nil
+}
+
+// releaseUnbonded credits the unbonded stake whose unbonding period ends with the block.
+func releaseUnbonded(header BlockHeader, s *State) error {
+	pending := make([]Unbonding, 0, len(s.unbonding))
+
+	for _, unbonding := range s.unbonding {
+		if header.Number < unbonding.ReleaseHeight {
+			pending = append(pending, unbonding)
+			continue
+		}
+
+		err := s.credit(unbonding.Account, unbonding.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.unbonding = pending
+
+	return nil
+}
@@ -0,0 +1,296 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newPosTestState(t *testing.T, keys map[Account]SealKey, stakes map[Account]Amount) *State {
+	t.Helper()
+
+	gen := genesis{Balances: map[Account]Amount{"jrhodes": NewAmount(1000000)}, Consensus: ConsensusPoS, Validators: make(map[Account]GenesisValidator)}
+	for validator, stake := range stakes {
+		gen.Validators[validator] = GenesisValidator{PublicKey: publicKeyOf(keys[validator]), Stake: stake}
+	}
+
+	genesisJson, err := json.Marshal(gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestState(t, string(genesisJson))
+}
+
+// testParent returns a made up parent hash, a different one for every i.
+func testParent(i uint64) Hash {
+	var input [8]byte
+	binary.BigEndian.PutUint64(input[:], i)
+
+	return sha256.Sum256(input[:])
+}
+
+func TestPosProposerIsDeterministic(t *testing.T) {
+	keys := newTestKeys(t, "alice", "bob", "carol")
+	stakes := map[Account]Amount{"alice": NewAmount(1000), "bob": NewAmount(1000), "carol": NewAmount(1000)}
+
+	// Two nodes loading the same genesis must agree on every proposer
+	state := newPosTestState(t, keys, stakes)
+	other := newPosTestState(t, keys, stakes)
+
+	proposers := make(map[Account]bool)
+	for i := uint64(0); i < 50; i++ {
+		number := i%5 + 1
+		parent := testParent(i)
+
+		proposer, err := state.Proposer(number, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proposers[proposer] = true
+
+		again, err := state.Proposer(number, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		otherProposer, err := other.Proposer(number, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if again != proposer || otherProposer != proposer {
+			t.Errorf("block %d with parent '%s' is proposed by '%s', then '%s' and '%s' on another node", number, parent.Hex(), proposer, again, otherProposer)
+		}
+	}
+
+	if len(proposers) != len(stakes) {
+		t.Errorf("50 different parents drew the proposers %v, expected every validator to propose", proposers)
+	}
+}
+
+func TestPosProposerFollowsStake(t *testing.T) {
+	keys := newTestKeys(t, "alice", "bob", "carol")
+
+	tests := []struct {
+		name   string
+		stakes map[Account]Amount
+	}{
+		{"single validator", map[Account]Amount{"alice": NewAmount(10)}},
+		{"equal stakes", map[Account]Amount{"alice": NewAmount(1000), "bob": NewAmount(1000)}},
+		{"three to one", map[Account]Amount{"alice": NewAmount(1000), "bob": NewAmount(3000)}},
+		{"micro stakes", map[Account]Amount{"alice": MicroTBB, "bob": 2 * MicroTBB, "carol": 7 * MicroTBB}},
+	}
+
+	const draws = 4000
+
+	for _, test := range tests {
+		state := newPosTestState(t, keys, test.stakes)
+
+		proposed := make(map[Account]int)
+		for i := uint64(0); i < draws; i++ {
+			proposer, err := state.Proposer(1, testParent(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			proposed[proposer]++
+		}
+
+		total := Amount(0)
+		for _, stake := range test.stakes {
+			total += stake
+		}
+
+		for validator, stake := range test.stakes {
+			expected := float64(stake) / float64(total)
+			share := float64(proposed[validator]) / draws
+			if share < expected-0.03 || share > expected+0.03 {
+				t.Errorf("%s: '%s' proposed %.3f of the blocks, expected %.3f", test.name, validator, share, expected)
+			}
+		}
+	}
+}
+
+func TestPosRejectsBlocksOfOtherValidators(t *testing.T) {
+	keys := newTestKeys(t, "alice", "bob")
+	state := newPosTestState(t, keys, map[Account]Amount{"alice": NewAmount(1000), "bob": NewAmount(1000)})
+
+	for i := 0; i < 10; i++ {
+		b := nextTestBlock(state, NewTx("jrhodes", "meads", NewAmount(1), ""))
+
+		proposer, err := state.Proposer(b.Header.Number, b.Header.Parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		other := Account("alice")
+		if proposer == other {
+			other = "bob"
+		}
+
+		_, err = sealTestBlock(state, keys[other], b)
+		if err == nil || !strings.Contains(err.Error(), "must be proposed by validator") {
+			t.Errorf("block %d: sealing by '%s' instead of '%s' returned '%v'", b.Header.Number, other, proposer, err)
+		}
+
+		// Signing directly skips the proposer check of Seal, so AddBlock has to enforce it
+		signed, err := b.Sign(keys[other])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = state.AddBlock(signed)
+		if err == nil || !strings.Contains(err.Error(), "must be proposed by") {
+			t.Errorf("block %d: adding a block signed by '%s' instead of '%s' returned '%v'", b.Header.Number, other, proposer, err)
+		}
+
+		addTestBlock(t, state, keys[proposer], NewTx("jrhodes", "meads", NewAmount(1), ""))
+	}
+}
+
+func TestPosProposerFollowsBonds(t *testing.T) {
+	keys := newTestKeys(t, "alice", "bob")
+	state := newPosTestState(t, keys, map[Account]Amount{"alice": NewAmount(1000)})
+
+	bobKey := publicKeyOf(keys["bob"])
+	addTestBlock(t, state, keys["alice"], NewTx("jrhodes", "bob", NewAmount(1000), ""), NewStakeBondTx("bob", NewAmount(1000), &bobKey))
+
+	proposed := make(map[Account]bool)
+	for i := uint64(0); i < 50; i++ {
+		proposer, err := state.Proposer(state.NextBlockNumber(), testParent(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		proposed[proposer] = true
+	}
+
+	if !proposed["alice"] || !proposed["bob"] {
+		t.Errorf("proposers after bob bonded are %v, expected both validators", proposed)
+	}
+}
+
+// proposeTestBlock returns a block with the TXs following the State tip, sealed by its proposer.
+func proposeTestBlock(t *testing.T, s *State, keys map[Account]SealKey, txs ...Tx) Block {
+	t.Helper()
+
+	b := nextTestBlock(s, txs...)
+
+	proposer, err := s.Proposer(b.Header.Number, b.Header.Parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = sealTestBlock(s, keys[proposer], b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func addProposedTestBlock(t *testing.T, s *State, keys map[Account]SealKey, txs ...Tx) Block {
+	t.Helper()
+
+	b := proposeTestBlock(t, s, keys, txs...)
+
+	_, err := s.AddBlock(b)
+	if err != nil {
+		t.Fatalf("adding block %d failed: %s", b.Header.Number, err)
+	}
+
+	return b
+}
+
+func TestPosUnbonding(t *testing.T) {
+	keys := newTestKeys(t, "alice", "bob")
+	state := newPosTestState(t, keys, map[Account]Amount{"alice": NewAmount(1000), "bob": NewAmount(1000)})
+
+	_, err := state.AddBlock(proposeTestBlock(t, state, keys, NewStakeUnbondTx("bob", NewAmount(1001))))
+	if err == nil || !strings.Contains(err.Error(), "'bob' can't unbond 1001 TBB of its 1000 TBB stake") {
+		t.Errorf("expected unbonding more than the stake to fail, got '%v'", err)
+	}
+
+	addProposedTestBlock(t, state, keys, NewStakeUnbondTx("bob", NewAmount(400)))
+
+	unbondings := state.Unbondings()
+	if len(unbondings) != 1 || unbondings[0].ReleaseHeight != DefaultUnbondingPeriod {
+		t.Fatalf("unbondings are %+v, expected 400 TBB released at block %d", unbondings, DefaultUnbondingPeriod)
+	}
+
+	for state.NextBlockNumber() < DefaultUnbondingPeriod {
+		addProposedTestBlock(t, state, keys)
+	}
+
+	if state.Balances["bob"] != 0 || state.ValidatorKey("bob") != publicKeyOf(keys["bob"]) {
+		t.Fatalf("bob holds %s before the end of the unbonding period", state.Balances["bob"])
+	}
+
+	addProposedTestBlock(t, state, keys)
+	if state.Balances["bob"] != NewAmount(400) || len(state.Unbondings()) != 0 {
+		t.Errorf("bob holds %s after the unbonding period, expected 400 TBB", state.Balances["bob"])
+	}
+}
+
+func TestPosSlashing(t *testing.T) {
+	keys := newTestKeys(t, "alice", "bob", "carol")
+	state := newPosTestState(t, keys, map[Account]Amount{"alice": NewAmount(1000), "bob": NewAmount(1000), "carol": NewAmount(1000)})
+	supply := state.TotalSupply()
+
+	addProposedTestBlock(t, state, keys, NewStakeUnbondTx("bob", NewAmount(300)))
+
+	doubleSign := func(signer Account, key SealKey) DoubleSignEvidence {
+		first, err := nextTestBlock(state, NewTx("jrhodes", "meads", NewAmount(1), "")).Sign(SealKey{signer, key.PrivateKey})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := nextTestBlock(state, NewTx("jrhodes", "meads", NewAmount(2), "")).Sign(SealKey{signer, key.PrivateKey})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return DoubleSignEvidence{first, second}
+	}
+
+	sameBlock := doubleSign("bob", keys["bob"])
+	sameBlock.Second = sameBlock.First
+
+	tests := []struct {
+		name     string
+		evidence DoubleSignEvidence
+		err      string
+	}{
+		{"same block twice", sameBlock, "Evidence blocks are the same block"},
+		{"blocks signed by another key", doubleSign("bob", keys["carol"]), "Invalid evidence"},
+		{"blocks of a non-validator", doubleSign("meads", keys["bob"]), "'meads' isn't a validator which can be slashed"},
+	}
+
+	for _, test := range tests {
+		_, err := state.AddBlock(proposeTestBlock(t, state, keys, NewStakeSlashTx("jrhodes", test.evidence)))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+	}
+
+	addProposedTestBlock(t, state, keys, NewStakeSlashTx("jrhodes", doubleSign("bob", keys["bob"])))
+
+	// The stake and the unbonding TBB are both burnt
+	if state.TotalSupply() != supply-NewAmount(1000) || len(state.Unbondings()) != 0 {
+		t.Errorf("total supply is %s after slashing bob, expected %s", state.TotalSupply(), supply-NewAmount(1000))
+	}
+
+	for _, validator := range state.Validators() {
+		if validator.Account == "bob" && (!validator.Slashed || validator.Stake != 0) {
+			t.Errorf("bob is %+v after slashing, expected no stake left", validator)
+		}
+	}
+
+	bond := NewStakeBondTx("bob", NewAmount(1), nil)
+	addProposedTestBlock(t, state, keys, NewTx("jrhodes", "bob", NewAmount(1), ""))
+	_, err := state.AddBlock(proposeTestBlock(t, state, keys, bond))
+	if err == nil || !strings.Contains(err.Error(), "was slashed and can't bond anymore") {
+		t.Errorf("expected a slashed validator bond to fail, got '%v'", err)
+	}
+}
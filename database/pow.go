@@ -0,0 +1,183 @@
+package database
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+)
+
+// ConsensusPoW is the Proof-of-Work consensus, a block is valid once its hash meets the difficulty in its header.
+const ConsensusPoW = "pow"
+
+const DefaultPowDifficulty = 1 << 16
+const DefaultPowRetargetInterval = 10
+const DefaultPowTargetBlockTime = 15
+
+// maxRetargetFactor bounds how much a single retarget can change the difficulty, either way.
+const maxRetargetFactor = 4
+
+// PowConfig configures the PoW consensus in genesis.
+//
+// Difficulty is the initial average number of hashes mining a block takes. Every RetargetInterval blocks
+// it's adjusted so blocks are mined every TargetBlockTime seconds. Reward is the TBB minted to the miner of each block.
+type PowConfig struct {
+	Difficulty       uint64 `json:"difficulty"`
+	RetargetInterval uint64 `json:"retarget_interval"`
+	TargetBlockTime  uint64 `json:"target_block_time"`
+	Reward           Amount `json:"reward"`
+}
+
+type powConsensus struct {
+	config PowConfig
+}
+
+func newPowConsensus(config PowConfig) (powConsensus, error) {
+	if config.Difficulty == 0 {
+		config.Difficulty = DefaultPowDifficulty
+	}
+	if config.RetargetInterval == 0 {
+		config.RetargetInterval = DefaultPowRetargetInterval
+	}
+	if config.TargetBlockTime == 0 {
+		config.TargetBlockTime = DefaultPowTargetBlockTime
+	}
+
+	return powConsensus{config}, nil
+}
+
+func (c powConsensus) Name() string {
+	return ConsensusPoW
+}
+
+func (c powConsensus) VerifyHeader(b Block, s *State) error {
+	err := verifyUnsigned(b, c)
+	if err != nil {
+		return err
+	}
+
+	if c.config.Reward > 0 && b.Header.Miner == "" {
+		return fmt.Errorf("block has no miner to reward")
+	}
+
+	difficulty := c.difficulty(s)
+	if b.Header.Difficulty != difficulty {
+		return fmt.Errorf("block difficulty must be %d not %d", difficulty, b.Header.Difficulty)
+	}
+
+	hash, err := b.Hash()
+	if err != nil {
+		return err
+	}
+
+	if !meetsDifficulty(hash, difficulty) {
+		return fmt.Errorf("block hash '%s' doesn't meet its difficulty of %d", hash.Hex(), difficulty)
+	}
+
+	return nil
+}
+
+func (c powConsensus) Prepare(header *BlockHeader, s *State) error {
+	header.Difficulty = c.difficulty(s)
+
+	return nil
+}
+
+// Seal mines the block, searching a nonce for which its hash meets the difficulty.
+func (c powConsensus) Seal(b Block, s *State, key SealKey) (Block, error) {
+	if c.config.Reward > 0 && key.Account == "" {
+		return Block{}, fmt.Errorf("mining requires a miner account to reward")
+	}
+
+	b.Header.Miner = key.Account
+
+	for nonce := uint64(0); ; nonce++ {
+		b.Header.Nonce = nonce
+
+		hash, err := b.Hash()
+		if err != nil {
+			return Block{}, err
+		}
+
+		if meetsDifficulty(hash, b.Header.Difficulty) {
+			return b, nil
+		}
+	}
+}
+
+// Finalize rewards the miner and retargets the difficulty at the end of every retarget interval.
+func (c powConsensus) Finalize(b Block, s *State) error {
+	if s.powRetargetTime == 0 {
+		s.powRetargetTime = b.Header.Time
+	} else {
+		s.powRetargetBlocks++
+	}
+
+	if s.powRetargetBlocks == c.config.RetargetInterval {
+		// Block times only have to exceed the median time past, the window may well end before it started
+		timespan := int64(b.Header.Time) - int64(s.powRetargetTime)
+		s.powDifficulty = retarget(c.difficulty(s), timespan, c.config.RetargetInterval*c.config.TargetBlockTime)
+		s.powRetargetTime = b.Header.Time
+		s.powRetargetBlocks = 0
+	}
+
+	if c.config.Reward == 0 {
+		return nil
+	}
+
+	return s.mint(b.Header.Miner, c.config.Reward)
+}
+
+// ForkChoice prefers the chain with the most cumulative work, not the longest one.
+func (c powConsensus) ForkChoice(local ChainHead, peer ChainHead) bool {
+	return peer.TotalWork > local.TotalWork
+}
+
+func (c powConsensus) difficulty(s *State) uint64 {
+	if s.powDifficulty == 0 {
+		return c.config.Difficulty
+	}
+
+	return s.powDifficulty
+}
+
+// retarget scales the difficulty by how much faster, or slower, than expected the last blocks were mined.
+//
+// The timespan is signed: a window ending before it started counts as the shortest one, never as a huge one.
+func retarget(difficulty uint64, timespan int64, expected uint64) uint64 {
+	minTimespan := int64(expected / maxRetargetFactor)
+	maxTimespan := int64(expected * maxRetargetFactor)
+
+	if timespan < minTimespan {
+		timespan = minTimespan
+	}
+	if timespan > maxTimespan {
+		timespan = maxTimespan
+	}
+	if timespan < 1 {
+		timespan = 1
+	}
+
+	hi, lo := bits.Mul64(difficulty, expected)
+	if hi >= uint64(timespan) {
+		return ^uint64(0)
+	}
+
+	retargeted, _ := bits.Div64(hi, lo, uint64(timespan))
+	if retargeted == 0 {
+		return 1
+	}
+
+	return retargeted
+}
+
+// meetsDifficulty tells if the hash, read as a number, is below 2^256 / difficulty.
+func meetsDifficulty(hash Hash, difficulty uint64) bool {
+	if difficulty == 0 {
+		return false
+	}
+
+	target := new(big.Int).Lsh(big.NewInt(1), 8*uint(len(hash)))
+	target.Div(target, new(big.Int).SetUint64(difficulty))
+
+	return new(big.Int).SetBytes(hash[:]).Cmp(target) < 0
+}
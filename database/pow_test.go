@@ -0,0 +1,221 @@
+package database
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newPowTestState(t *testing.T, config PowConfig) *State {
+	t.Helper()
+
+	gen := genesis{Balances: map[Account]Amount{"jrhodes": NewAmount(1000000)}, Consensus: ConsensusPoW, Pow: config}
+
+	genesisJson, err := json.Marshal(gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestState(t, string(genesisJson))
+}
+
+// mineTestBlock mines a block with the TXs following the State tip at the given time.
+func mineTestBlock(t *testing.T, s *State, time uint64, txs ...Tx) Block {
+	t.Helper()
+
+	b, err := sealTestBlock(s, SealKey{Account: "miner"}, NewBlock(s.LatestBlockHash(), s.NextBlockNumber(), time, txs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestPowMiningAndReward(t *testing.T) {
+	state := newPowTestState(t, PowConfig{Difficulty: 8, Reward: NewAmount(50)})
+
+	b := mineTestBlock(t, state, testBlockTime, NewTx("jrhodes", "meads", NewAmount(1), ""))
+	if !meetsDifficulty(hashOf(t, b), 8) || b.Header.Miner != "miner" {
+		t.Fatalf("mined block '%s' by '%s' doesn't meet the difficulty", hashOf(t, b).Hex(), b.Header.Miner)
+	}
+
+	unmined := b
+	for meetsDifficulty(hashOf(t, unmined), 8) {
+		unmined.Header.Nonce++
+	}
+
+	signed, err := b.Sign(SealKey{Account: "miner", PrivateKey: newTestKeys(t, "miner")["miner"].PrivateKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	noMiner := NewBlock(state.LatestBlockHash(), 0, testBlockTime, nil)
+	noMiner.Header.Difficulty = 8
+
+	tests := []struct {
+		name  string
+		block Block
+		err   string
+	}{
+		{"hash above the difficulty", unmined, "doesn't meet its difficulty of 8"},
+		{"signed block", signed, "the 'pow' consensus doesn't sign blocks"},
+		{"no miner to reward", noMiner, "block has no miner to reward"},
+	}
+
+	for _, test := range tests {
+		_, err = state.AddBlock(test.block)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+	}
+
+	_, err = state.AddBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.Balances["miner"] != NewAmount(50) || state.TotalSupply() != NewAmount(1000050) {
+		t.Errorf("miner holds %s after mining a block, expected the 50 TBB reward", state.Balances["miner"])
+	}
+
+	_, err = sealTestBlock(state, SealKey{}, nextTestBlock(state))
+	if err == nil || !strings.Contains(err.Error(), "requires a miner account") {
+		t.Errorf("expected mining without a miner account to fail, got '%v'", err)
+	}
+}
+
+func TestRetarget(t *testing.T) {
+	tests := []struct {
+		name       string
+		difficulty uint64
+		timespan   int64
+		expected   uint64
+		retargeted uint64
+	}{
+		{"on target", 1000, 150, 150, 1000},
+		{"twice as fast", 1000, 75, 150, 2000},
+		{"twice as slow", 1000, 300, 150, 500},
+		{"faster than the bound", 1000, 10, 150, 1000 * 150 / 37},
+		{"no time elapsed", 1000, 0, 150, 1000 * 150 / 37},
+		{"window ending before it started", 1000, -500, 150, 1000 * 150 / 37},
+		{"expected timespan shorter than the factor", 10, -1, 3, 30},
+		{"slower than the bound", 1000, 10000, 150, 250},
+		{"never below 1", 1, 10000, 150, 1},
+		{"overflow saturates", ^uint64(0), 1, 150, ^uint64(0)},
+	}
+
+	for _, test := range tests {
+		retargeted := retarget(test.difficulty, test.timespan, test.expected)
+		if retargeted != test.retargeted {
+			t.Errorf("%s: retarget(%d, %d, %d) = %d, expected %d", test.name, test.difficulty, test.timespan, test.expected, retargeted, test.retargeted)
+		}
+	}
+}
+
+func TestMeetsDifficulty(t *testing.T) {
+	var highest Hash
+	for i := range highest {
+		highest[i] = 0xff
+	}
+
+	var half Hash
+	half[0] = 0x80
+
+	tests := []struct {
+		name       string
+		hash       Hash
+		difficulty uint64
+		meets      bool
+	}{
+		{"no difficulty", Hash{}, 0, false},
+		{"any hash meets a difficulty of 1", highest, 1, true},
+		{"lowest hash", Hash{}, ^uint64(0), true},
+		{"half of the hashes meet a difficulty of 2", half, 2, false},
+		{"hash just below the target", Hash{0x7f, 0xff}, 2, true},
+	}
+
+	for _, test := range tests {
+		if meets := meetsDifficulty(test.hash, test.difficulty); meets != test.meets {
+			t.Errorf("%s: meetsDifficulty('%s', %d) = %t, expected %t", test.name, test.hash.Hex(), test.difficulty, meets, test.meets)
+		}
+	}
+}
+
+func TestPowRetargetsDifficulty(t *testing.T) {
+	state := newPowTestState(t, PowConfig{Difficulty: 4, RetargetInterval: 2, TargetBlockTime: 15})
+
+	// Blocks on target keep the difficulty
+	for i := uint64(0); i < 3; i++ {
+		b := mineTestBlock(t, state, testBlockTime+15*i)
+		if b.Header.Difficulty != 4 {
+			t.Fatalf("block %d difficulty is %d, expected 4", b.Header.Number, b.Header.Difficulty)
+		}
+
+		_, err := state.AddBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Blocks mined a second apart hit the bound, the window is at least 30/4 seconds long
+	for i := uint64(1); i <= 2; i++ {
+		_, err := state.AddBlock(mineTestBlock(t, state, testBlockTime+30+i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stale := NewBlock(state.LatestBlockHash(), state.NextBlockNumber(), testBlockTime+40, nil)
+	stale.Header.Difficulty = 4
+	stale, err := state.Consensus().Seal(stale, state, SealKey{Account: "miner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = state.AddBlock(stale)
+	if err == nil || !strings.Contains(err.Error(), "block difficulty must be 17 not 4") {
+		t.Errorf("expected a block with the previous difficulty to be rejected, got '%v'", err)
+	}
+
+	b := mineTestBlock(t, state, testBlockTime+40)
+	if b.Header.Difficulty != 4*30/7 {
+		t.Errorf("retargeted difficulty is %d, expected %d", b.Header.Difficulty, 4*30/7)
+	}
+
+	_, err = state.AddBlock(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if work := state.TotalWork(); work != 5*4+17 {
+		t.Errorf("total work is %d, expected %d", work, 5*4+17)
+	}
+}
+
+func TestForkChoice(t *testing.T) {
+	pow, err := newPowConsensus(PowConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		consensus Consensus
+		local     ChainHead
+		peer      ChainHead
+		preferred bool
+	}{
+		{"pow prefers more work", pow, ChainHead{Number: 10, TotalWork: 100}, ChainHead{Number: 5, TotalWork: 101}, true},
+		{"pow ignores a longer chain with less work", pow, ChainHead{Number: 5, TotalWork: 100}, ChainHead{Number: 10, TotalWork: 99}, false},
+		{"pow keeps its chain on equal work", pow, ChainHead{Number: 5, TotalWork: 100}, ChainHead{Number: 6, TotalWork: 100}, false},
+		{"instant prefers the longest chain", instantSealConsensus{}, ChainHead{Number: 5, TotalWork: 100}, ChainHead{Number: 6, TotalWork: 6}, true},
+		{"instant keeps its chain on equal length", instantSealConsensus{}, ChainHead{Number: 5}, ChainHead{Number: 5}, false},
+		{"pos prefers the longest chain", posConsensus{}, ChainHead{Number: 5}, ChainHead{Number: 6}, true},
+	}
+
+	for _, test := range tests {
+		if preferred := test.consensus.ForkChoice(test.local, test.peer); preferred != test.preferred {
+			t.Errorf("%s: ForkChoice(%+v, %+v) = %t, expected %t", test.name, test.local, test.peer, preferred, test.preferred)
+		}
+	}
+}
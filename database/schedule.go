@@ -0,0 +1,77 @@
+package database
+
+import (
+	"fmt"
+)
+
+// ScheduledTransfer holds the value of a time-locked TX until the chain reaches its unlock
+// height and time. The value is taken from the sender when the TX is included in a block.
+type ScheduledTransfer struct {
+	TxHash       Hash    `json:"tx_hash"`
+	From         Account `json:"from"`
+	To           Account `json:"to"`
+	Value        Amount  `json:"value"`
+	Asset        AssetID `json:"asset"`
+	UnlockHeight uint64  `json:"unlock_height"`
+	UnlockTime   uint64  `json:"unlock_time"`
+	BlockNumber  uint64  `json:"block_number"`
+}
+
+// IsTimeLocked tells if the TX only credits its recipient from a given block number or time on.
+func (t Tx) IsTimeLocked() bool {
+	return t.UnlockHeight > 0 || t.UnlockTime > 0
+}
+
+// ScheduledTransfers returns the time-locked transfers still waiting for their unlock height and time.
+func (s *State) ScheduledTransfers() []ScheduledTransfer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.scheduled
+}
+
+func scheduleTransfer(tx Tx, s *State) error {
+	if tx.Type != "" {
+		return fmt.Errorf("bad TX. Only transfers can be time-locked, not '%s' TXs", tx.Type)
+	}
+
+	txHash, err := tx.Hash()
+	if err != nil {
+		return err
+	}
+
+	s.scheduled = append(s.scheduled, ScheduledTransfer{
+		TxHash:       txHash,
+		From:         tx.From,
+		To:           tx.To,
+		Value:        tx.Value,
+		Asset:        tx.AssetID(),
+		UnlockHeight: tx.UnlockHeight,
+		UnlockTime:   tx.UnlockTime,
+		BlockNumber:  s.NextBlockNumber(),
+	})
+
+	return nil
+}
+
+// releaseScheduledTransfers credits the recipients of the transfers the block makes eligible,
+// including the ones scheduled by the block itself.
+func releaseScheduledTransfers(header BlockHeader, s *State) error {
+	pending := make([]ScheduledTransfer, 0, len(s.scheduled))
+
+	for _, st := range s.scheduled {
+		if header.Number < st.UnlockHeight || header.Time < st.UnlockTime {
+			pending = append(pending, st)
+			continue
+		}
+
+		err := s.creditAsset(st.To, st.Asset, st.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.scheduled = pending
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTimeLockedTransferRelease(t *testing.T) {
+	tests := []struct {
+		name         string
+		unlockHeight uint64
+		unlockTime   uint64
+		releasedAt   uint64
+	}{
+		{"unlock height", 3, 0, 3},
+		{"unlock time", 0, testBlockTime + 15*2, 2},
+		{"unlock height and time, the time last", 1, testBlockTime + 15*4, 4},
+		{"unlock height and time, the height last", 4, testBlockTime + 15*1, 4},
+		{"unlock height reached by its own block", 0 + 1, 0, 1},
+	}
+
+	for _, test := range tests {
+		s := newTestState(t, testGenesis)
+		addTestBlock(t, s, SealKey{}, NewTx("jrhodes", "jrhodes", NewAmount(1), "reward"))
+
+		tx := NewTx("jrhodes", "meads", NewAmount(100), "")
+		tx.UnlockHeight = test.unlockHeight
+		tx.UnlockTime = test.unlockTime
+		addTestBlock(t, s, SealKey{}, tx)
+
+		if s.Balances["jrhodes"] != NewAmount(1000001-100) {
+			t.Errorf("%s: the sender must be debited when the TX is included, its balance is %s", test.name, s.Balances["jrhodes"])
+		}
+
+		for s.NextBlockNumber() < 6 {
+			released := s.Balances["meads"] == NewAmount(100)
+			if released != (s.LatestBlock().Header.Number >= test.releasedAt) {
+				t.Errorf("%s: meads holds %s at block %d, expected the transfer to be released at block %d", test.name, s.Balances["meads"], s.LatestBlock().Header.Number, test.releasedAt)
+			}
+
+			if released != (len(s.ScheduledTransfers()) == 0) {
+				t.Errorf("%s: %d transfers are still scheduled at block %d", test.name, len(s.ScheduledTransfers()), s.LatestBlock().Header.Number)
+			}
+
+			addTestBlock(t, s, SealKey{})
+		}
+	}
+}
+
+func TestTimeLockedTransfers(t *testing.T) {
+	timeLocked := func(tx Tx) Tx {
+		tx.UnlockHeight = 2
+		return tx
+	}
+
+	tests := []struct {
+		name string
+		tx   Tx
+		err  string
+	}{
+		{"asset transfer", timeLocked(NewAssetTx("jrhodes", "meads", NewAmount(10), "TAB", "")), ""},
+		{"over the balance", timeLocked(NewTx("jrhodes", "meads", NewAmount(1000001), "")), "Tx cost is 1000001 TBB"},
+		{"asset issue", timeLocked(NewAssetIssueTx("jrhodes", "meads", NewAmount(10), "PTS")), "Asset issue TXs can't be time-locked"},
+	}
+
+	for _, test := range tests {
+		s := newTestState(t, testGenesis)
+		addTestBlock(t, s, SealKey{}, NewAssetIssueTx("jrhodes", "jrhodes", NewAmount(100), "TAB"))
+
+		_, err := s.AddBlock(nextTestBlock(s, test.tx))
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: expected the block to be accepted, got '%s'", test.name, err)
+			continue
+		}
+
+		scheduled := s.ScheduledTransfers()
+		if len(scheduled) != 1 || scheduled[0].Asset != test.tx.AssetID() || scheduled[0].BlockNumber != 1 {
+			t.Errorf("%s: scheduled transfers are %+v", test.name, scheduled)
+		}
+
+		addTestBlock(t, s, SealKey{})
+		if s.BalancesOf(test.tx.AssetID())["meads"] != test.tx.Value {
+			t.Errorf("%s: expected the transfer to be released at block 2", test.name)
+		}
+	}
+}
+
+func TestScheduledTransfersReloadFromDisk(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	s, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := NewTx("jrhodes", "meads", NewAmount(100), "")
+	tx.UnlockHeight = 5
+	addTestBlock(t, s, SealKey{}, tx)
+	s.Close()
+
+	s, err = NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if len(s.ScheduledTransfers()) != 1 || s.Balances["meads"] != 0 {
+		t.Errorf("scheduled transfers are %+v after reloading the State", s.ScheduledTransfers())
+	}
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"fmt"
+	"github.com/jsrhodes15/the-blockchain-bar/vm"
+)
+
+const TxTypeScriptDeploy TxType = "script_deploy"
+const TxTypeScriptCall TxType = "script_call"
+
+// MaxScriptStorageKeys bounds how many keys a script account can store.
+const MaxScriptStorageKeys = 1024
+
+// NewScriptDeployTx deploys a script to a new account, funded with value TBB.
+func NewScriptDeployTx(from Account, to Account, value Amount, script string) Tx {
+	return Tx{From: from, To: to, Value: value, Type: TxTypeScriptDeploy, Script: script}
+}
+
+// NewScriptCallTx sends value TBB to a script account and runs its script with the given arguments.
+func NewScriptCallTx(from Account, to Account, value Amount, args []string, gasLimit uint64) Tx {
+	return Tx{From: from, To: to, Value: value, Type: TxTypeScriptCall, Args: args, GasLimit: gasLimit}
+}
+
+func (s *State) Script(account Account) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	script, ok := s.scripts[account]
+
+	return script, ok
+}
+
+// Storage returns a copy of the key/value storage of a script account.
+func (s *State) Storage(account Account) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	storage := make(map[string]string)
+	for key, value := range s.storage[account] {
+		storage[key] = value
+	}
+
+	return storage
+}
+
+// scriptHost runs a script on behalf of its account, against the State the TX is applied to.
+type scriptHost struct {
+	account Account
+	state   *State
+}
+
+func (h *scriptHost) Load(key string) string {
+	return h.state.storage[h.account][key]
+}
+
+func (h *scriptHost) Store(key string, value string) error {
+	storage, ok := h.state.storage[h.account]
+	if !ok {
+		storage = make(map[string]string)
+		h.state.storage[h.account] = storage
+	}
+
+	if _, exists := storage[key]; !exists && len(storage) >= MaxScriptStorageKeys {
+		return fmt.Errorf("script account '%s' storage exceeds its %d keys limit", h.account, MaxScriptStorageKeys)
+	}
+
+	if value == "" {
+		delete(storage, key)
+		return nil
+	}
+
+	storage[key] = value
+
+	return nil
+}
+
+func (h *scriptHost) Balance(account string) uint64 {
+	return uint64(h.state.Balances[h.state.ResolveAccount(account)])
+}
+
+func (h *scriptHost) Transfer(to string, amount uint64) error {
+	err := h.state.debit(h.account, NativeAsset, Amount(amount))
+	if err != nil {
+		return err
+	}
+
+	return h.state.credit(h.state.ResolveAccount(to), Amount(amount))
+}
+
+func validateScriptTx(tx Tx) error {
+	if tx.AssetID() != NativeAsset {
+		return fmt.Errorf("bad TX. Scripts can only be sent %s", NativeAsset)
+	}
+
+	if tx.IsTimeLocked() {
+		return fmt.Errorf("bad TX. Script TXs can't be time-locked")
+	}
+
+	return nil
+}
+
+func applyScriptDeploy(tx Tx, s *State) error {
+	err := validateScriptTx(tx)
+	if err != nil {
+		return err
+	}
+
+	_, err = vm.Parse(tx.Script)
+	if err != nil {
+		return fmt.Errorf("bad TX. Invalid script: %s", err.Error())
+	}
+
+	to := s.ResolveAccount(string(tx.To))
+
+	// Multisig accounts are derived from public keys anyone knows, a script deployed to one before
+	// it is funded would control what its owners deposit
+	if IsMultisigAccount(to) {
+		return fmt.Errorf("bad TX. Scripts can't be deployed to the multisig account '%s'", to)
+	}
+
+	if _, exists := s.scripts[to]; exists || s.accountExists(to) {
+		return fmt.Errorf("bad TX. Scripts can only be deployed to a new account, '%s' already exists", to)
+	}
+
+	err = s.debit(tx.From, NativeAsset, tx.Value)
+	if err != nil {
+		return err
+	}
+
+	err = s.credit(to, tx.Value)
+	if err != nil {
+		return err
+	}
+
+	s.scripts[to] = tx.Script
+
+	return nil
+}
+
+func applyScriptCall(tx Tx, s *State) error {
+	err := validateScriptTx(tx)
+	if err != nil {
+		return err
+	}
+
+	to := s.ResolveAccount(string(tx.To))
+
+	script, ok := s.scripts[to]
+	if !ok {
+		return fmt.Errorf("bad TX. Account '%s' has no script to call", tx.To)
+	}
+
+	if tx.GasLimit == 0 || tx.GasLimit > s.limits.MaxTxGas {
+		return fmt.Errorf("bad TX. Gas limit must be between 1 and %d", s.limits.MaxTxGas)
+	}
+
+	// Parsing the deployed script again keeps the State free of VM types
+	program, err := vm.Parse(script)
+	if err != nil {
+		return err
+	}
+
+	err = s.debit(tx.From, NativeAsset, tx.Value)
+	if err != nil {
+		return err
+	}
+
+	err = s.credit(to, tx.Value)
+	if err != nil {
+		return err
+	}
+
+	ctx := vm.Context{
+		Caller: string(tx.From),
+		Self:   string(to),
+		Value:  uint64(tx.Value),
+		Height: s.NextBlockNumber(),
+		Args:   tx.Args,
+	}
+
+	_, err = vm.Execute(program, ctx, &scriptHost{to, s}, tx.GasLimit)
+	if err != nil {
+		return fmt.Errorf("bad TX. Script '%s' failed: %s", to, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+const splitScript = `
+0
+:loop
+DUP ARGC LT JUMPI pay
+STOP
+:pay
+DUP ARG VALUE ARGC DIV TRANSFER
+1 ADD
+JUMP loop`
+
+func TestScriptDeployAndCall(t *testing.T) {
+	state := newTestState(t, testGenesis)
+
+	addTestBlock(t, state, SealKey{}, NewScriptDeployTx("jrhodes", "split", 0, splitScript))
+	addTestBlock(t, state, SealKey{}, NewScriptCallTx("jrhodes", "split", NewAmount(90), []string{"meads", "lhendricks", "babayaga"}, 10000))
+
+	for _, account := range []Account{"meads", "lhendricks", "babayaga"} {
+		if balance := state.BalancesOf(NativeAsset)[account]; balance != NewAmount(30) {
+			t.Errorf("'%s' received %s, expected 30 TBB", account, balance)
+		}
+	}
+
+	if balance := state.BalancesOf(NativeAsset)["split"]; balance != 0 {
+		t.Errorf("the script kept %s, expected nothing", balance)
+	}
+}
+
+func TestScriptCallRunningOutOfGasIsRejected(t *testing.T) {
+	state := newTestState(t, testGenesis)
+
+	addTestBlock(t, state, SealKey{}, NewScriptDeployTx("jrhodes", "split", 0, splitScript))
+
+	b := nextTestBlock(state, NewScriptCallTx("jrhodes", "split", NewAmount(90), []string{"meads", "lhendricks"}, 10))
+	_, err := state.AddBlock(b)
+	if err == nil || !strings.Contains(err.Error(), "out of gas") {
+		t.Fatalf("expected the call to run out of gas, got '%v'", err)
+	}
+
+	if balance := state.BalancesOf(NativeAsset)["jrhodes"]; balance != NewAmount(1000000) {
+		t.Errorf("a rejected call must not cost anything, jrhodes has %s", balance)
+	}
+}
+
+func TestScriptDeployToMultisigAccountIsRejected(t *testing.T) {
+	publicKey, _, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := NewMultisigPolicy(1, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msig, err := policy.Account()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := newTestState(t, testGenesis)
+	addTestBlock(t, state, SealKey{}, NewTx("jrhodes", msig, NewAmount(10), ""), NewNameRegisterTx("jrhodes", "shared", msig))
+
+	tests := []struct {
+		name string
+		to   Account
+	}{
+		{"multisig account", msig},
+		{"name of a multisig account", "shared"},
+	}
+
+	for _, test := range tests {
+		b := nextTestBlock(state, NewScriptDeployTx("jrhodes", test.to, 0, splitScript))
+		_, err = state.AddBlock(b)
+		if err == nil || !strings.Contains(err.Error(), "Scripts can't be deployed to the multisig account") {
+			t.Errorf("%s: expected the deploy to be rejected, got '%v'", test.name, err)
+		}
+	}
+}
+
+func TestScriptDeployedThroughAName(t *testing.T) {
+	state := newTestState(t, testGenesis)
+
+	addTestBlock(t, state, SealKey{}, NewNameRegisterTx("jrhodes", "split", "splitter"))
+	addTestBlock(t, state, SealKey{}, NewScriptDeployTx("jrhodes", "split", NewAmount(3), splitScript))
+
+	if balance := state.BalancesOf(NativeAsset)["splitter"]; balance != NewAmount(3) {
+		t.Errorf("the address the name points to holds %s, expected the 3 TBB deployed with the script", balance)
+	}
+
+	if _, ok := state.BalancesOf(NativeAsset)["split"]; ok {
+		t.Errorf("the name itself must not hold a balance")
+	}
+
+	addTestBlock(t, state, SealKey{}, NewScriptCallTx("jrhodes", "split", NewAmount(90), []string{"meads", "lhendricks", "babayaga"}, 10000))
+	if balance := state.BalancesOf(NativeAsset)["meads"]; balance != NewAmount(30) {
+		t.Errorf("calling the script through its name paid meads %s, expected 30 TBB", balance)
+	}
+
+	b := nextTestBlock(state, NewScriptDeployTx("jrhodes", "splitter", 0, splitScript))
+	_, err := state.AddBlock(b)
+	if err == nil || !strings.Contains(err.Error(), "'splitter' already exists") {
+		t.Errorf("expected a second deploy to the address to be rejected, got '%v'", err)
+	}
+}
@@ -1,92 +1,266 @@
 package database
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"os"
 	"reflect"
+	"sync"
 )
 
 type State struct {
-	Balances  map[Account]uint
-	txMempool []Tx
+	// mu guards the State against the HTTP handlers reading it while the node adds blocks
+	mu sync.RWMutex
 
-	dbFile *os.File
+	Balances  map[Account]Amount
+	txMempool []Tx
 
-	latestBlock     Block
-	latestBlockHash Hash
-	hasGenesisBlock bool
+	dataDir  string
+	dbFile   *os.File
+	lock     *dataDirLock
+	readOnly bool
+
+	limits      Limits
+	upgrades    map[string]uint64
+	totalSupply Amount
+	maxSupply   Amount
+
+	assets        map[AssetID]Asset
+	assetBalances map[AssetID]map[Account]Amount
+	nonces        map[Account]uint64
+	scheduled     []ScheduledTransfer
+	locked        map[Account]Amount
+	vesting       map[Account]VestingSchedule
+	names         map[string]NameRecord
+	scripts       map[Account]string
+	storage       map[Account]map[string]string
+	htlcs         map[Hash]Htlc
+	channels      map[Hash]Channel
+
+	consensus     Consensus
+	signers       map[Account]PublicKey
+	votes         map[Account]map[Account]PoaVote
+	recentSigners []Account
+
+	validators      map[Account]Validator
+	unbonding       []Unbonding
+	unbondingPeriod uint64
+
+	powDifficulty     uint64
+	powRetargetTime   uint64
+	powRetargetBlocks uint64
+
+	latestBlock      Block
+	latestBlockHash  Hash
+	hasGenesisBlock  bool
+	chainBlocks      map[Hash]uint64
+	checkpoints      map[uint64]Hash
+	orphans          map[Hash]Block
+	sideBlocks       map[Hash]SideBlock
+	branchState      *State
+	forkStats        ForkStats
+	recentBlockTimes []uint64
+	totalWork        uint64
 }
 
+// NewStateFromDisk loads the State and locks the data dir so no other process can write into it
+// until the State is closed.
 func NewStateFromDisk(dataDir string) (*State, error) {
+	return newStateFromDisk(dataDir, false)
+}
+
+// NewStateFromDiskReadOnly loads the State without locking the data dir, so it can be used while
+// a node is running. Blocks can't be added to a read-only State.
+func NewStateFromDiskReadOnly(dataDir string) (*State, error) {
+	return newStateFromDisk(dataDir, true)
+}
+
+func newStateFromDisk(dataDir string, readOnly bool) (*State, error) {
 	err := initDataDirIfNotExists(dataDir)
 	if err != nil {
 		return nil, err
 	}
+
+	var lock *dataDirLock
+	if !readOnly {
+		lock, err = lockDataDir(dataDir)
+		if err != nil {
+			return nil, err
+		}
+
+		err = initDbVersionIfNotExists(dataDir)
+		if err != nil {
+			lock.release()
+			return nil, err
+		}
+
+		err = recordUpgradeHeights(dataDir)
+		if err != nil {
+			lock.release()
+			return nil, err
+		}
+	}
+
+	state, err := loadStateFromDisk(dataDir, readOnly)
+	if err != nil {
+		lock.release()
+		return nil, err
+	}
+	state.lock = lock
+
+	return state, nil
+}
+
+func loadStateFromDisk(dataDir string, readOnly bool) (*State, error) {
+	state, err := loadGenesisState(dataDir, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	// Iterate over each line in block.db file (block)
+	err = ForEachBlock(dataDir, state.replayBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	if readOnly {
+		return state, nil
+	}
+
+	f, err := os.OpenFile(getBlocksDbFilePath(dataDir), os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	state.dbFile = f
+
+	return state, nil
+}
+
+// loadGenesisState returns the State the genesis file starts the chain with, before any block.
+func loadGenesisState(dataDir string, readOnly bool) (*State, error) {
+	err := checkDbVersion(dataDir)
+	if err != nil {
+		return nil, err
+	}
 	// start with a 'genesis' file
 	gen, err := loadGenesis(getGenesisJsonFilePath(dataDir))
 	if err != nil {
 		return nil, err
 	}
-	// build a map of balances for easy lookup
-	balances := make(map[Account]uint)
-	for account, balance := range gen.Balances {
-		balances[account] = balance
+	state := &State{
+		Balances:      make(map[Account]Amount),
+		txMempool:     make([]Tx, 0),
+		dataDir:       dataDir,
+		readOnly:      readOnly,
+		limits:        gen.Limits.withDefaults(),
+		maxSupply:     gen.MaxSupply,
+		assets:        make(map[AssetID]Asset),
+		assetBalances: make(map[AssetID]map[Account]Amount),
+		nonces:        make(map[Account]uint64),
+		scheduled:     make([]ScheduledTransfer, 0),
+		locked:        make(map[Account]Amount),
+		vesting:       make(map[Account]VestingSchedule),
+		names:         make(map[string]NameRecord),
+		scripts:       make(map[Account]string),
+		storage:       make(map[Account]map[string]string),
+		htlcs:         make(map[Hash]Htlc),
+		channels:      make(map[Hash]Channel),
+		signers:       make(map[Account]PublicKey),
+		votes:         make(map[Account]map[Account]PoaVote),
+		recentSigners: make([]Account, 0),
+
+		validators:      make(map[Account]Validator),
+		unbonding:       make([]Unbonding, 0),
+		unbondingPeriod: gen.UnbondingPeriod,
+		chainBlocks:     make(map[Hash]uint64),
+		checkpoints:     make(map[uint64]Hash),
+		orphans:         make(map[Hash]Block),
+		sideBlocks:      make(map[Hash]SideBlock),
+	}
+
+	for number, hash := range gen.Checkpoints {
+		state.checkpoints[number] = hash
 	}
 
-	dbFilePath := getBlocksDbFilePath(dataDir)
-	f, err := os.OpenFile(dbFilePath, os.O_APPEND|os.O_RDWR, 0600)
+	state.upgrades, _, err = loadUpgradeHeights(dataDir, gen)
 	if err != nil {
 		return nil, err
 	}
 
-	scanner := bufio.NewScanner(f)
+	state.consensus, err = newConsensus(gen)
+	if err != nil {
+		return nil, fmt.Errorf("invalid genesis. %s", err.Error())
+	}
 
-	state := &State{balances, make([]Tx, 0), f, Block{}, Hash{}, false}
-	// Iterate over each line in tx.db file (transaction)
-	for scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return nil, err
-		}
+	for signer, publicKey := range gen.Signers {
+		state.signers[signer] = publicKey
+	}
 
-		blockFsJson := scanner.Bytes()
+	if state.unbondingPeriod == 0 {
+		state.unbondingPeriod = DefaultUnbondingPeriod
+	}
 
-		if len(blockFsJson) == 0 {
-			break
+	for account, validator := range gen.Validators {
+		err = state.mintStake(account, validator)
+		if err != nil {
+			return nil, err
 		}
-
-		var blockFs BlockFS
-		err = json.Unmarshal(blockFsJson, &blockFs)
+	}
+	// build a map of balances for easy lookup
+	for account, balance := range gen.Balances {
+		err = state.mint(account, balance)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		err = applyTXs(blockFs.Value.TXs, state)
+	for account, schedule := range gen.Vesting {
+		err = state.mintLocked(account, schedule)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("invalid genesis. %s", err.Error())
 		}
+	}
 
-		state.latestBlock = blockFs.Value
-		state.latestBlockHash = blockFs.Key
-		state.hasGenesisBlock = true
+	err = validateSupply(state)
+	if err != nil {
+		return nil, fmt.Errorf("invalid genesis. %s", err.Error())
 	}
 
 	return state, nil
 }
 
-func (s *State) AddBlocks(blocks []Block) error {
-	for _, b := range blocks {
-		_, err := s.AddBlock(b)
-		if err != nil {
-			return err
-		}
+// replayBlock applies a block persisted to disk, which was fully validated when it was added.
+func (s *State) replayBlock(blockFs BlockFS) error {
+	err := s.VerifyCheckpoint(blockFs.Value.Header.Number, blockFs.Key)
+	if err != nil {
+		return err
 	}
 
+	err = applyBlockPayload(blockFs.Value, s)
+	if err != nil {
+		return err
+	}
+
+	s.latestBlock = blockFs.Value
+	s.latestBlockHash = blockFs.Key
+	s.hasGenesisBlock = true
+	s.chainBlocks[blockFs.Key] = blockFs.Value.Header.Number
+	s.trackBlockTime(blockFs.Value.Header.Time)
+
 	return nil
 }
 
 func (s *State) AddBlock(b Block) (Hash, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addBlock(b)
+}
+
+func (s *State) addBlock(b Block) (Hash, error) {
+	if s.readOnly {
+		return Hash{}, fmt.Errorf("unable to add block, the State was opened read-only")
+	}
+
 	pendingState := s.copy()
 	// Validate block meta + payload. Replays transactions to verify balances
 	err := applyBlock(b, pendingState)
@@ -106,64 +280,234 @@ func (s *State) AddBlock(b Block) (Hash, error) {
 		return Hash{}, err
 	}
 
-	fmt.Printf("Persisting new Block to disk:\n")
-	fmt.Printf("\t%s\n", blockFsJson)
-	// Write to disk
-	_, err = s.dbFile.Write(append(blockFsJson, '\n'))
-	if err != nil {
-		return Hash{}, err
+	// A dry-run State has no db file, its blocks only live in memory
+	if s.dbFile != nil {
+		fmt.Printf("Persisting new Block to disk:\n")
+		fmt.Printf("\t%s\n", blockFsJson)
+		// Write to disk
+		_, err = s.dbFile.Write(append(blockFsJson, '\n'))
+		if err != nil {
+			return Hash{}, err
+		}
 	}
 	// All TXs are valid and no error writing to disk -> update main state
-	s.Balances = pendingState.Balances
+	s.adopt(pendingState)
 	s.latestBlockHash = blockHash
 	s.latestBlock = b
 	s.hasGenesisBlock = true
+	s.chainBlocks[blockHash] = b.Header.Number
+	s.trackBlockTime(b.Header.Time)
+	s.forkStats.Blocks++
 
 	return blockHash, nil
 }
 
+// adopt takes over the ledger of the State blocks were validated and applied to.
+func (s *State) adopt(pendingState *State) {
+	s.Balances = pendingState.Balances
+	s.totalSupply = pendingState.totalSupply
+	s.assets = pendingState.assets
+	s.assetBalances = pendingState.assetBalances
+	s.nonces = pendingState.nonces
+	s.scheduled = pendingState.scheduled
+	s.locked = pendingState.locked
+	s.names = pendingState.names
+	s.scripts = pendingState.scripts
+	s.storage = pendingState.storage
+	s.htlcs = pendingState.htlcs
+	s.channels = pendingState.channels
+	s.signers = pendingState.signers
+	s.votes = pendingState.votes
+	s.recentSigners = pendingState.recentSigners
+	s.validators = pendingState.validators
+	s.unbonding = pendingState.unbonding
+	s.powDifficulty = pendingState.powDifficulty
+	s.powRetargetTime = pendingState.powRetargetTime
+	s.powRetargetBlocks = pendingState.powRetargetBlocks
+	s.totalWork = pendingState.totalWork
+}
+
 func (s *State) NextBlockNumber() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	if !s.hasGenesisBlock {
 		return uint64(0)
 	}
 
-	return s.LatestBlock().Header.Number + 1
+	return s.latestBlock.Header.Number + 1
 }
 
 func (s *State) LatestBlock() Block {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.latestBlock
 }
 
 func (s *State) LatestBlockHash() Hash {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.latestBlockHash
 }
 
+// TotalWork is the cumulative work of the chain, the fork choice of PoW prefers the chain with the most.
+func (s *State) TotalWork() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.totalWork
+}
+
+// DryRun returns an in-memory copy of the State.
+//
+// Blocks added to the copy are fully validated and applied to its balances but never persisted to disk.
+func (s *State) DryRun() *State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c := s.copy()
+	for hash, number := range s.chainBlocks {
+		c.chainBlocks[hash] = number
+	}
+
+	return c
+}
+
 func (s *State) Close() error {
-	return s.dbFile.Close()
+	if s.dbFile != nil {
+		err := s.dbFile.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.lock.release()
 }
 
-func (s *State) copy() State {
+func (s *State) copy() *State {
 	// For validation purposes, we want to make a copy of State, without any pointers to the original State{}
-	c := State{}
+	c := &State{}
+	c.limits = s.limits
+	c.upgrades = s.upgrades
+	c.totalSupply = s.totalSupply
+	c.maxSupply = s.maxSupply
 	c.latestBlock = s.latestBlock
 	c.latestBlockHash = s.latestBlockHash
-	c.txMempool = make([]Tx, len(s.txMempool))
-	c.Balances = make(map[Account]uint)
+	c.hasGenesisBlock = s.hasGenesisBlock
+	c.recentBlockTimes = make([]uint64, len(s.recentBlockTimes))
+	copy(c.recentBlockTimes, s.recentBlockTimes)
+	c.txMempool = make([]Tx, 0, len(s.txMempool))
+	c.dataDir = s.dataDir
+	// The chain blocks index is only kept up to date by the State the blocks are added to
+	c.chainBlocks = make(map[Hash]uint64)
+	c.orphans = make(map[Hash]Block)
+	c.sideBlocks = make(map[Hash]SideBlock)
+	c.Balances = make(map[Account]Amount)
 
 	for acc, balance := range s.Balances {
 		c.Balances[acc] = balance
 	}
 
+	c.assets = make(map[AssetID]Asset)
+	for id, asset := range s.assets {
+		c.assets[id] = asset
+	}
+
+	c.assetBalances = make(map[AssetID]map[Account]Amount)
+	for id, balances := range s.assetBalances {
+		c.assetBalances[id] = make(map[Account]Amount)
+		for acc, balance := range balances {
+			c.assetBalances[id][acc] = balance
+		}
+	}
+
 	for _, tx := range s.txMempool {
 		c.txMempool = append(c.txMempool, tx)
 	}
 
+	c.nonces = make(map[Account]uint64)
+	for acc, nonce := range s.nonces {
+		c.nonces[acc] = nonce
+	}
+
+	c.scheduled = make([]ScheduledTransfer, len(s.scheduled))
+	copy(c.scheduled, s.scheduled)
+
+	c.locked = make(map[Account]Amount)
+	for acc, locked := range s.locked {
+		c.locked[acc] = locked
+	}
+
+	c.names = make(map[string]NameRecord)
+	for name, record := range s.names {
+		c.names[name] = record
+	}
+
+	c.scripts = make(map[Account]string)
+	for acc, script := range s.scripts {
+		c.scripts[acc] = script
+	}
+
+	c.storage = make(map[Account]map[string]string)
+	for acc, storage := range s.storage {
+		c.storage[acc] = make(map[string]string)
+		for key, value := range storage {
+			c.storage[acc][key] = value
+		}
+	}
+
+	c.htlcs = make(map[Hash]Htlc)
+	for hashLock, htlc := range s.htlcs {
+		c.htlcs[hashLock] = htlc
+	}
+
+	c.channels = make(map[Hash]Channel)
+	for id, channel := range s.channels {
+		c.channels[id] = channel
+	}
+
+	c.consensus = s.consensus
+	c.signers = make(map[Account]PublicKey)
+	for signer, publicKey := range s.signers {
+		c.signers[signer] = publicKey
+	}
+
+	c.votes = make(map[Account]map[Account]PoaVote)
+	for candidate, votes := range s.votes {
+		c.votes[candidate] = make(map[Account]PoaVote)
+		for voter, vote := range votes {
+			c.votes[candidate][voter] = vote
+		}
+	}
+
+	c.recentSigners = make([]Account, len(s.recentSigners))
+	copy(c.recentSigners, s.recentSigners)
+
+	c.validators = make(map[Account]Validator)
+	for acc, validator := range s.validators {
+		c.validators[acc] = validator
+	}
+
+	c.unbonding = make([]Unbonding, len(s.unbonding))
+	copy(c.unbonding, s.unbonding)
+	c.unbondingPeriod = s.unbondingPeriod
+	c.powDifficulty = s.powDifficulty
+	c.powRetargetTime = s.powRetargetTime
+	c.powRetargetBlocks = s.powRetargetBlocks
+	c.totalWork = s.totalWork
+
+	// Vesting schedules come from genesis and never change, neither do checkpoints once the node runs
+	c.vesting = s.vesting
+	c.checkpoints = s.checkpoints
+
 	return c
 }
 
 // verifies if a block can be added to the blockchain
 // block metadata are verified as well as transactions within (sufficient balances, etc).
-func applyBlock(b Block, s State) error {
+func applyBlock(b Block, s *State) error {
 	nextExpectedBlockNumber := s.latestBlock.Header.Number + 1
 
 	if s.hasGenesisBlock && b.Header.Number != nextExpectedBlockNumber {
@@ -182,12 +526,73 @@ func applyBlock(b Block, s State) error {
 		)
 	}
 
-	return applyTXs(b.TXs, &s)
+	err := verifyBlockCheckpoint(b, s)
+	if err != nil {
+		return err
+	}
+
+	if s.IsUpgradeActive(UpgradeBlockTime, b.Header.Number) {
+		err = validateBlockTime(b, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.IsUpgradeActive(UpgradeBlockLimits, b.Header.Number) {
+		err = s.CheckBlockLimits(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.ConsensusAt(b.Header.Number).VerifyHeader(b, s)
+	if err != nil {
+		return err
+	}
+
+	return applyBlockPayload(b, s)
+}
+
+// applyBlockPayload applies the block TXs and the effects the block has on the State on its own,
+// such as unlocking vested TBB, releasing the scheduled transfers it makes eligible, settling channels
+// or the consensus rewards.
+func applyBlockPayload(b Block, s *State) error {
+	err := releaseVested(b.Header, s)
+	if err != nil {
+		return err
+	}
+
+	err = applyTXs(b.TXs, b.Header, s)
+	if err != nil {
+		return err
+	}
+
+	err = releaseScheduledTransfers(b.Header, s)
+	if err != nil {
+		return err
+	}
+
+	err = settleChannels(b.Header, s)
+	if err != nil {
+		return err
+	}
+
+	err = s.ConsensusAt(b.Header.Number).Finalize(b, s)
+	if err != nil {
+		return err
+	}
+
+	if b.Header.Work() > ^uint64(0)-s.totalWork {
+		return fmt.Errorf("chain total work overflows")
+	}
+	s.totalWork += b.Header.Work()
+
+	return validateSupply(s)
 }
 
-func applyTXs(txs []Tx, s *State) error {
+func applyTXs(txs []Tx, header BlockHeader, s *State) error {
 	for _, tx := range txs {
-		err := applyTx(tx, s)
+		err := applyTx(tx, header, s)
 		if err != nil {
 			return err
 		}
@@ -195,22 +600,59 @@ func applyTXs(txs []Tx, s *State) error {
 	return nil
 }
 
-func applyTx(tx Tx, s *State) error {
+func applyTx(tx Tx, header BlockHeader, s *State) error {
+	err := validateTxUpgrades(tx, header, s)
+	if err != nil {
+		return err
+	}
+
+	if IsMultisigAccount(tx.From) && !tx.IsReward() {
+		err = verifyMultisig(tx, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch tx.Type {
+	case "":
+	case TxTypeAssetIssue:
+		return applyAssetIssue(tx, s)
+	case TxTypeNameRegister:
+		return applyNameRegister(tx, s)
+	case TxTypeScriptDeploy:
+		return applyScriptDeploy(tx, s)
+	case TxTypeScriptCall:
+		return applyScriptCall(tx, s)
+	case TxTypeHtlcLock, TxTypeHtlcClaim, TxTypeHtlcRefund:
+		return applyHtlcTx(tx, s)
+	case TxTypeChannelOpen:
+		return applyChannelOpen(tx, s)
+	case TxTypeChannelClose:
+		return applyChannelClose(tx, s)
+	case TxTypePoaVote:
+		return applyPoaVote(tx, s)
+	case TxTypeStakeBond, TxTypeStakeUnbond, TxTypeStakeSlash:
+		return applyStakeTx(tx, s)
+	default:
+		return fmt.Errorf("bad TX. Unknown TX type '%s'", tx.Type)
+	}
+
 	if tx.IsReward() {
-		s.Balances[tx.To] += tx.Value
-		return nil
+		if tx.AssetID() != NativeAsset {
+			return fmt.Errorf("bad TX. Rewards can only be paid in %s", NativeAsset)
+		}
+
+		return s.mint(tx.To, tx.Value)
 	}
 
-	if tx.Value > s.Balances[tx.From] {
-		return fmt.Errorf("bad TX. Sender '%s' balance is %d TBB. Tx cost is %d",
-			tx.From,
-			s.Balances[tx.From],
-			tx.Value,
-		)
+	err = s.debit(tx.From, tx.AssetID(), tx.Value)
+	if err != nil {
+		return err
 	}
 
-	s.Balances[tx.From] -= tx.Value
-	s.Balances[tx.To] += tx.Value
+	if tx.IsTimeLocked() {
+		return scheduleTransfer(tx, s)
+	}
 
-	return nil
+	return s.creditAsset(tx.To, tx.AssetID(), tx.Value)
 }
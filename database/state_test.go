@@ -0,0 +1,40 @@
+package database
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestDryRunDoesNotPersistBlocks(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	dryRun := state.DryRun()
+	_, err = dryRun.AddBlock(NewBlock(Hash{}, 0, 1600000000, []Tx{NewTx("jrhodes", "meads", NewAmount(10), "")}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dryRun.Balances["meads"] != NewAmount(10) || dryRun.NextBlockNumber() != 1 {
+		t.Errorf("the dry run must apply the block, meads balance is %s", dryRun.Balances["meads"])
+	}
+
+	if state.Balances["meads"] != 0 || state.NextBlockNumber() != 0 {
+		t.Errorf("the dry run must not change the State it copies")
+	}
+
+	content, err := ioutil.ReadFile(getBlocksDbFilePath(dataDir))
+	if err != nil || len(content) > 0 {
+		t.Errorf("the dry run must not write to block.db")
+	}
+
+	_, err = dryRun.AddBlock(NewBlock(Hash{}, 1, 1600000015, []Tx{NewTx("meads", "jrhodes", NewAmount(11), "")}))
+	if err == nil {
+		t.Errorf("the dry run must validate the blocks added to it")
+	}
+}
@@ -0,0 +1,149 @@
+package database
+
+import (
+	"fmt"
+)
+
+// BalanceOverflowError is returned when crediting an account would wrap its balance around.
+type BalanceOverflowError struct {
+	Account Account
+	Asset   AssetID
+	Balance Amount
+	Credit  Amount
+}
+
+func (e *BalanceOverflowError) Error() string {
+	return fmt.Sprintf(
+		"crediting %s %s to '%s' overflows its balance of %s %s",
+		e.Credit.Format(DenominationTBB),
+		e.Asset,
+		e.Account,
+		e.Balance.Format(DenominationTBB),
+		e.Asset,
+	)
+}
+
+func (s *State) TotalSupply() Amount {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.totalSupply
+}
+
+// Supply breaks down the TBB supply at the latest block.
+type Supply struct {
+	BlockHash   Hash
+	Total       Amount
+	Circulating Amount
+	Locked      Amount
+	Staked      Amount
+	Max         Amount
+}
+
+// Supply returns every figure of the supply at once, so they all describe the same block.
+func (s *State) Supply() Supply {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	locked := s.lockedSupply()
+	staked := s.stakedSupply()
+
+	return Supply{
+		BlockHash:   s.latestBlockHash,
+		Total:       s.totalSupply,
+		Circulating: s.totalSupply - locked - staked,
+		Locked:      locked,
+		Staked:      staked,
+		Max:         s.maxSupply,
+	}
+}
+
+// MaxSupply returns the total supply cap configured in genesis, 0 when the supply is unlimited.
+func (s *State) MaxSupply() Amount {
+	return s.maxSupply
+}
+
+func (s *State) credit(account Account, value Amount) error {
+	if value > maxAmount-s.Balances[account] {
+		return &BalanceOverflowError{account, NativeAsset, s.Balances[account], value}
+	}
+
+	s.Balances[account] += value
+
+	return nil
+}
+
+// creditAsset credits value of any asset to an account.
+func (s *State) creditAsset(account Account, asset AssetID, value Amount) error {
+	if asset == NativeAsset {
+		return s.credit(account, value)
+	}
+
+	balances, exists := s.assetBalances[asset]
+	if !exists {
+		return fmt.Errorf("bad TX. Asset '%s' doesn't exist", asset)
+	}
+
+	if value > maxAmount-balances[account] {
+		return &BalanceOverflowError{account, asset, balances[account], value}
+	}
+
+	balances[account] += value
+
+	return nil
+}
+
+// debit takes value of any asset from an account, failing when its balance is insufficient.
+func (s *State) debit(account Account, asset AssetID, value Amount) error {
+	balances := s.BalancesOf(asset)
+	if balances == nil {
+		return fmt.Errorf("bad TX. Asset '%s' doesn't exist", asset)
+	}
+
+	if value > balances[account] && asset == NativeAsset && s.locked[account] > 0 {
+		return fmt.Errorf("bad TX. Sender '%s' liquid balance is %s, %s more are still locked by vesting. Tx cost is %s",
+			account,
+			balances[account],
+			s.locked[account],
+			value,
+		)
+	}
+
+	if value > balances[account] {
+		return fmt.Errorf("bad TX. Sender '%s' balance is %s %s. Tx cost is %s %s",
+			account,
+			balances[account].Format(DenominationTBB),
+			asset,
+			value.Format(DenominationTBB),
+			asset,
+		)
+	}
+
+	balances[account] -= value
+
+	return nil
+}
+
+// mint credits newly created TBB to an account, increasing the total supply.
+func (s *State) mint(account Account, value Amount) error {
+	if value > maxAmount-s.totalSupply {
+		return fmt.Errorf("minting %s overflows the total supply of %s", value, s.totalSupply)
+	}
+
+	err := s.credit(account, value)
+	if err != nil {
+		return err
+	}
+
+	s.totalSupply += value
+
+	return nil
+}
+
+func validateSupply(s *State) error {
+	if s.maxSupply > 0 && s.totalSupply > s.maxSupply {
+		return fmt.Errorf("total supply of %s exceeds the max supply of %s", s.totalSupply, s.maxSupply)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMaxSupplyCapsRewards(t *testing.T) {
+	genesis := `{"balances": {"jrhodes": 900}, "max_supply": 1000}`
+
+	tests := []struct {
+		name    string
+		rewards []uint64
+		supply  uint64
+		err     string
+	}{
+		{"under the cap", []uint64{50}, 950, ""},
+		{"reaching the cap", []uint64{50, 50}, 1000, ""},
+		{"over the cap", []uint64{50, 51}, 950, "total supply of 1001 TBB exceeds the max supply of 1000 TBB"},
+		{"over the cap within a block", []uint64{150}, 900, "exceeds the max supply"},
+	}
+
+	for _, test := range tests {
+		s := newTestState(t, genesis)
+
+		var err error
+		for _, reward := range test.rewards {
+			_, err = s.AddBlock(nextTestBlock(s, NewTx("jrhodes", "jrhodes", NewAmount(reward), "reward")))
+			if err != nil {
+				break
+			}
+		}
+
+		if test.err == "" && err != nil {
+			t.Errorf("%s: expected the rewards to be minted, got '%s'", test.name, err)
+		}
+
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+
+		if s.TotalSupply() != NewAmount(test.supply) || s.Balances["jrhodes"] != NewAmount(test.supply) {
+			t.Errorf("%s: total supply is %s, expected %d TBB", test.name, s.TotalSupply(), test.supply)
+		}
+	}
+}
+
+func TestSupplyOverflow(t *testing.T) {
+	tests := []struct {
+		name    string
+		genesis string
+		reward  Amount
+		err     string
+	}{
+		{"genesis over the max supply", `{"balances": {"jrhodes": 1001}, "max_supply": 1000}`, 0, "invalid genesis"},
+		{"genesis balance overflow", fmt.Sprintf(`{"balances": {"jrhodes": %s, "meads": 1}}`, maxAmount.Format(DenominationTBB)), 0, "overflows the total supply"},
+		{"reward overflow", fmt.Sprintf(`{"balances": {"jrhodes": %s}}`, (maxAmount - 1).Format(DenominationTBB)), 2, "overflows the total supply"},
+		{"reward up to the max balance", fmt.Sprintf(`{"balances": {"jrhodes": %s}}`, (maxAmount - 1).Format(DenominationTBB)), 1, ""},
+	}
+
+	for _, test := range tests {
+		dataDir := newTestDataDir(t)
+
+		err := InitDataDir(dataDir, []byte(test.genesis))
+		if err == nil {
+			var s *State
+			s, err = NewStateFromDisk(dataDir)
+			if err == nil {
+				_, err = s.AddBlock(nextTestBlock(s, NewTx("jrhodes", "jrhodes", test.reward, "reward")))
+				s.Close()
+			}
+		}
+
+		if test.err == "" && err != nil {
+			t.Errorf("%s: expected no error, got '%s'", test.name, err)
+		}
+
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+	}
+}
+
+func TestCreditOverflow(t *testing.T) {
+	s := State{Balances: map[Account]Amount{"meads": maxAmount}}
+
+	err := s.credit("meads", 1)
+	if _, ok := err.(*BalanceOverflowError); !ok {
+		t.Errorf("expected a BalanceOverflowError, got '%v'", err)
+	}
+
+	if s.Balances["meads"] != maxAmount {
+		t.Errorf("an overflowing credit must leave the balance untouched")
+	}
+}
+
+func TestSupply(t *testing.T) {
+	keys := newTestKeys(t, "alice")
+	pos := newPosTestState(t, keys, map[Account]Amount{"alice": NewAmount(1000)})
+
+	tests := []struct {
+		name     string
+		state    *State
+		expected Supply
+	}{
+		{
+			"locked and capped",
+			newTestState(t, `{"balances": {"jrhodes": 1000, "meads": 10}, "max_supply": 5000, "vesting": {"meads": {"amount": 100, "start_height": 0, "cliff_height": 2, "end_height": 4}}}`),
+			Supply{Total: NewAmount(1110), Circulating: NewAmount(1010), Locked: NewAmount(100), Max: NewAmount(5000)},
+		},
+		{
+			"staked",
+			pos,
+			Supply{Total: pos.TotalSupply(), Circulating: pos.TotalSupply() - NewAmount(1000), Staked: NewAmount(1000)},
+		},
+	}
+
+	for _, test := range tests {
+		test.expected.BlockHash = test.state.LatestBlockHash()
+
+		if supply := test.state.Supply(); supply != test.expected {
+			t.Errorf("%s: supply is %+v, expected %+v", test.name, supply, test.expected)
+		}
+	}
+}
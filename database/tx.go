@@ -1,22 +1,97 @@
 package database
 
+import (
+	"crypto/sha256"
+	"encoding/json"
+)
+
 type Account string
 
 func NewAccount(value string) Account {
 	return Account(value)
 }
 
+// TxType tells how a TX is applied, plain transfers and rewards have no type.
+type TxType string
+
+const TxTypeAssetIssue TxType = "asset_issue"
+
 type Tx struct {
 	From  Account `json:"from"`
 	To    Account `json:"to"`
-	Value uint    `json:"value"`
+	Value Amount  `json:"value"`
 	Data  string  `json:"data"`
+	Type  TxType  `json:"type,omitempty"`
+	Asset AssetID `json:"asset,omitempty"`
+
+	// Name registered by a name_register TX
+	Name string `json:"name,omitempty"`
+
+	// Script deployed by a script_deploy TX, or the arguments and gas limit of a script_call TX
+	Script   string   `json:"script,omitempty"`
+	Args     []string `json:"args,omitempty"`
+	GasLimit uint64   `json:"gas_limit,omitempty"`
+
+	// HTLC TXs lock value under the SHA-256 hash of a secret until a timeout height, claims reveal the secret
+	HashLock      *Hash  `json:"hash_lock,omitempty"`
+	Preimage      string `json:"preimage,omitempty"`
+	TimeoutHeight uint64 `json:"timeout_height,omitempty"`
+
+	// Payment channels are opened with the key signing their off-chain updates and closed with the latest update
+	ChannelKey      *PublicKey     `json:"channel_key,omitempty"`
+	ChallengePeriod uint64         `json:"challenge_period,omitempty"`
+	ChannelUpdate   *ChannelUpdate `json:"channel_update,omitempty"`
+
+	// Vote of a PoA signer about the signer To
+	Vote *PoaVote `json:"vote,omitempty"`
+
+	// Validator key of a first stake_bond TX, double sign evidence of a stake_slash TX
+	ValidatorKey *PublicKey          `json:"validator_key,omitempty"`
+	Evidence     *DoubleSignEvidence `json:"evidence,omitempty"`
+
+	// Time-locked TXs credit their recipient from the given block number and time on
+	UnlockHeight uint64 `json:"unlock_height,omitempty"`
+	UnlockTime   uint64 `json:"unlock_time,omitempty"`
+
+	// Multisig accounts spend with their policy, enough owner signatures and the account next nonce
+	Nonce      uint64          `json:"nonce,omitempty"`
+	Multisig   *MultisigPolicy `json:"multisig,omitempty"`
+	Signatures []TxSignature   `json:"signatures,omitempty"`
 }
 
-func NewTx(from Account, to Account, value uint, data string) Tx {
-	return Tx{from, to, value, data}
+func NewTx(from Account, to Account, value Amount, data string) Tx {
+	return Tx{From: from, To: to, Value: value, Data: data}
+}
+
+// NewAssetTx transfers value of the given asset instead of TBB.
+func NewAssetTx(from Account, to Account, value Amount, asset AssetID, data string) Tx {
+	return Tx{From: from, To: to, Value: value, Data: data, Asset: asset}
+}
+
+// NewAssetIssueTx issues value of a new or existing asset to an account. Only the account
+// which first issued an asset may issue more of it.
+func NewAssetIssueTx(issuer Account, to Account, value Amount, asset AssetID) Tx {
+	return Tx{From: issuer, To: to, Value: value, Type: TxTypeAssetIssue, Asset: asset}
+}
+
+func (t Tx) Hash() (Hash, error) {
+	txJson, err := json.Marshal(t)
+	if err != nil {
+		return Hash{}, err
+	}
+
+	return sha256.Sum256(txJson), nil
 }
 
 func (t Tx) IsReward() bool {
 	return t.Data == "reward"
 }
+
+// AssetID returns the asset the TX moves, TBB unless another asset is set.
+func (t Tx) AssetID() AssetID {
+	if t.Asset == "" {
+		return NativeAsset
+	}
+
+	return t.Asset
+}
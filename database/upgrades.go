@@ -0,0 +1,259 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Names of the rule upgrades. Genesis activates each of them at a block height,
+// blocks below it are validated by the rules the chain had before the upgrade.
+const (
+	UpgradeBlockTime   = "block_time"
+	UpgradeBlockLimits = "block_limits"
+	UpgradeAssets      = "assets"
+	UpgradeMultisig    = "multisig"
+	UpgradeTimeLocks   = "time_locks"
+	UpgradeNames       = "names"
+	UpgradeScripts     = "scripts"
+	UpgradeHtlc        = "htlc"
+	UpgradeChannels    = "channels"
+	UpgradeConsensus   = "consensus"
+)
+
+type Upgrade struct {
+	Name        string
+	Description string
+}
+
+// Upgrades lists the rule upgrades this build supports, in the order they were introduced.
+//
+// Upgrades genesis doesn't mention activate with the next block the first time the data dir is opened by a build
+// supporting them, and that height is recorded in the data dir. New chains always run the latest rules, and the
+// blocks of an existing chain keep validating under the rules they were written with.
+var Upgrades = []Upgrade{
+	{UpgradeBlockTime, "block times must be greater than the median time past and not too far in the future"},
+	{UpgradeBlockLimits, "blocks and TXs must respect the genesis size, TX count and data limits"},
+	{UpgradeAssets, "assets can be issued and transferred next to TBB"},
+	{UpgradeMultisig, "M-of-N multisig accounts can spend with their owner signatures"},
+	{UpgradeTimeLocks, "TXs can be time-locked until a block height or time"},
+	{UpgradeNames, "names can be registered and used in place of accounts"},
+	{UpgradeScripts, "scripts can be deployed and called"},
+	{UpgradeHtlc, "hash-time-locked contracts can be locked, claimed and refunded"},
+	{UpgradeChannels, "payment channels can be opened and closed"},
+	{UpgradeConsensus, "blocks are sealed by the genesis consensus, which enables its votes and staking TXs"},
+}
+
+// txTypeUpgrades maps the TX types to the upgrade introducing them.
+var txTypeUpgrades = map[TxType]string{
+	TxTypeAssetIssue:   UpgradeAssets,
+	TxTypeNameRegister: UpgradeNames,
+	TxTypeScriptDeploy: UpgradeScripts,
+	TxTypeScriptCall:   UpgradeScripts,
+	TxTypeHtlcLock:     UpgradeHtlc,
+	TxTypeHtlcClaim:    UpgradeHtlc,
+	TxTypeHtlcRefund:   UpgradeHtlc,
+	TxTypeChannelOpen:  UpgradeChannels,
+	TxTypeChannelClose: UpgradeChannels,
+	TxTypePoaVote:      UpgradeConsensus,
+	TxTypeStakeBond:    UpgradeConsensus,
+	TxTypeStakeUnbond:  UpgradeConsensus,
+	TxTypeStakeSlash:   UpgradeConsensus,
+}
+
+// loadUpgradeHeights returns the activation height of every supported upgrade, from genesis or, for the upgrades
+// genesis doesn't mention, from the data dir record.
+//
+// The upgrades the data dir hasn't recorded yet activate with the next block on disk, they are returned too.
+func loadUpgradeHeights(dataDir string, gen genesis) (map[string]uint64, []string, error) {
+	for name := range gen.Upgrades {
+		if !isSupportedUpgrade(name) {
+			return nil, nil, fmt.Errorf("invalid genesis. %s", unknownUpgradeErr(name).Error())
+		}
+	}
+
+	recorded, err := readRecordedUpgrades(dataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for name := range recorded {
+		if !isSupportedUpgrade(name) {
+			return nil, nil, fmt.Errorf("data directory '%s' recorded an %s", dataDir, unknownUpgradeErr(name).Error())
+		}
+	}
+
+	heights := make(map[string]uint64)
+	unrecorded := make([]string, 0)
+	for _, upgrade := range Upgrades {
+		if height, ok := gen.Upgrades[upgrade.Name]; ok {
+			heights[upgrade.Name] = height
+			continue
+		}
+
+		if height, ok := recorded[upgrade.Name]; ok {
+			heights[upgrade.Name] = height
+			continue
+		}
+
+		unrecorded = append(unrecorded, upgrade.Name)
+	}
+
+	if len(unrecorded) == 0 {
+		return heights, unrecorded, nil
+	}
+
+	next, err := nextBlockNumberOnDisk(dataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, name := range unrecorded {
+		heights[name] = next
+	}
+
+	return heights, unrecorded, nil
+}
+
+// recordUpgradeHeights records the activation height of the upgrades genesis doesn't mention
+// and the data dir hasn't recorded yet, so they keep activating at the same block.
+func recordUpgradeHeights(dataDir string) error {
+	err := checkDbVersion(dataDir)
+	if err != nil {
+		return err
+	}
+
+	gen, err := loadGenesis(getGenesisJsonFilePath(dataDir))
+	if err != nil {
+		return err
+	}
+
+	heights, unrecorded, err := loadUpgradeHeights(dataDir, gen)
+	if err != nil || len(unrecorded) == 0 {
+		return err
+	}
+
+	recorded, err := readRecordedUpgrades(dataDir)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range unrecorded {
+		recorded[name] = heights[name]
+	}
+
+	content, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(getUpgradesJsonFilePath(dataDir), content, 0644)
+}
+
+func readRecordedUpgrades(dataDir string) (map[string]uint64, error) {
+	recorded := make(map[string]uint64)
+
+	path := getUpgradesJsonFilePath(dataDir)
+	if !fileExist(path) {
+		return recorded, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(content, &recorded)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the upgrade heights from '%s'. %s", path, err.Error())
+	}
+
+	return recorded, nil
+}
+
+// nextBlockNumberOnDisk returns the number of the block following the latest one on disk, 0 without blocks.
+func nextBlockNumberOnDisk(dataDir string) (uint64, error) {
+	next := uint64(0)
+	err := ForEachBlock(dataDir, func(blockFs BlockFS) error {
+		next = blockFs.Value.Header.Number + 1
+
+		return nil
+	})
+
+	return next, err
+}
+
+func isSupportedUpgrade(name string) bool {
+	for _, upgrade := range Upgrades {
+		if upgrade.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func unknownUpgradeErr(name string) error {
+	return fmt.Errorf("unknown upgrade '%s', this build supports '%s'. Upgrade tbb to run this chain", name, strings.Join(upgradeNames(), "', '"))
+}
+
+func upgradeNames() []string {
+	names := make([]string, 0, len(Upgrades))
+	for _, upgrade := range Upgrades {
+		names = append(names, upgrade.Name)
+	}
+
+	return names
+}
+
+// IsUpgradeActive tells if the block with the given number follows the rules of the upgrade.
+func (s *State) IsUpgradeActive(upgrade string, number uint64) bool {
+	height, ok := s.upgrades[upgrade]
+
+	return ok && number >= height
+}
+
+// UpgradeHeight returns the block height the upgrade activates at.
+func (s *State) UpgradeHeight(upgrade string) uint64 {
+	return s.upgrades[upgrade]
+}
+
+// validateTxUpgrades verifies the TX only uses features active at the block height.
+func validateTxUpgrades(tx Tx, header BlockHeader, s *State) error {
+	required := make([]string, 0, 2)
+
+	if upgrade, ok := txTypeUpgrades[tx.Type]; ok {
+		required = append(required, upgrade)
+	}
+
+	if tx.AssetID() != NativeAsset {
+		required = append(required, UpgradeAssets)
+	}
+
+	if IsMultisigAccount(tx.From) || tx.Multisig != nil || len(tx.Signatures) > 0 {
+		required = append(required, UpgradeMultisig)
+	}
+
+	if tx.IsTimeLocked() {
+		required = append(required, UpgradeTimeLocks)
+	}
+
+	for _, upgrade := range required {
+		if !s.IsUpgradeActive(upgrade, header.Number) {
+			return fmt.Errorf("bad TX. The '%s' upgrade only activates at block %d", upgrade, s.UpgradeHeight(upgrade))
+		}
+	}
+
+	return nil
+}
+
+// ConsensusAt returns the consensus sealing the block with the given number. Blocks below the consensus
+// upgrade are unsealed, as the chain had no consensus before it.
+func (s *State) ConsensusAt(number uint64) Consensus {
+	if !s.IsUpgradeActive(UpgradeConsensus, number) {
+		return instantSealConsensus{}
+	}
+
+	return s.consensus
+}
@@ -0,0 +1,263 @@
+package database
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upgradesAt activates every upgrade at the given height, but the ones listed in others.
+func upgradesAt(height uint64, others map[string]uint64) map[string]uint64 {
+	upgrades := make(map[string]uint64)
+	for _, upgrade := range Upgrades {
+		upgrades[upgrade.Name] = height
+	}
+
+	for name, otherHeight := range others {
+		upgrades[name] = otherHeight
+	}
+
+	return upgrades
+}
+
+func newUpgradeTestState(t *testing.T, gen genesis) *State {
+	t.Helper()
+
+	gen.Balances = map[Account]Amount{"jrhodes": NewAmount(1000000)}
+
+	genesisJson, err := json.Marshal(gen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return newTestState(t, string(genesisJson))
+}
+
+func TestTxsRequireTheirUpgrade(t *testing.T) {
+	state := newUpgradeTestState(t, genesis{Upgrades: upgradesAt(2, nil)})
+
+	tests := []struct {
+		name    string
+		tx      Tx
+		upgrade string
+	}{
+		{"asset issue", NewAssetIssueTx("jrhodes", "jrhodes", NewAmount(5), "TAB"), UpgradeAssets},
+		{"asset transfer", NewAssetTx("jrhodes", "meads", NewAmount(1), "TAB", ""), UpgradeAssets},
+		{"multisig spend", Tx{From: "jrhodes", To: "meads", Value: NewAmount(1), Multisig: &MultisigPolicy{}}, UpgradeMultisig},
+		{"time-locked transfer", Tx{From: "jrhodes", To: "meads", Value: NewAmount(1), UnlockHeight: 10}, UpgradeTimeLocks},
+		{"name registration", NewNameRegisterTx("jrhodes", "bar", "jrhodes"), UpgradeNames},
+		{"script deploy", NewScriptDeployTx("jrhodes", "split", 0, "STOP"), UpgradeScripts},
+		{"script call", NewScriptCallTx("jrhodes", "split", NewAmount(1), nil, 100), UpgradeScripts},
+		{"HTLC lock", NewHtlcLockTx("jrhodes", "meads", NewAmount(1), "", Hash{0x01}, 10), UpgradeHtlc},
+		{"channel open", NewChannelOpenTx("jrhodes", "meads", NewAmount(1), "", PublicKey{0x01}, 10), UpgradeChannels},
+		{"PoA vote", NewPoaVoteTx("jrhodes", "meads", PoaVote{Authorize: true}), UpgradeConsensus},
+		{"stake bond", NewStakeBondTx("jrhodes", NewAmount(1), &PublicKey{0x01}), UpgradeConsensus},
+	}
+
+	for _, test := range tests {
+		_, err := state.AddBlock(nextTestBlock(state, test.tx))
+		expected := "The '" + test.upgrade + "' upgrade only activates at block 2"
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing \"%s\", got '%v'", test.name, expected, err)
+		}
+	}
+
+	addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+	addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+
+	addTestBlock(t, state, SealKey{}, NewAssetIssueTx("jrhodes", "jrhodes", NewAmount(5), "TAB"), NewNameRegisterTx("jrhodes", "bar", "jrhodes"))
+	if balance := state.BalancesOf("TAB")["jrhodes"]; balance != NewAmount(5) {
+		t.Errorf("TAB balance is %s once the upgrade is active, expected 5", balance)
+	}
+}
+
+func TestBlockTimeRulesFollowTheirUpgrade(t *testing.T) {
+	state := newUpgradeTestState(t, genesis{Upgrades: upgradesAt(0, map[string]uint64{UpgradeBlockTime: 3})})
+
+	future := uint64(time.Now().Add(24 * time.Hour).Unix())
+	times := []uint64{testBlockTime, testBlockTime - 100, future}
+	for i, blockTime := range times {
+		_, err := state.AddBlock(NewBlock(state.LatestBlockHash(), uint64(i), blockTime, nil))
+		if err != nil {
+			t.Fatalf("block %d with time %d must be accepted before the upgrade: %s", i, blockTime, err)
+		}
+	}
+
+	_, err := state.AddBlock(NewBlock(state.LatestBlockHash(), 3, testBlockTime, nil))
+	if _, ok := err.(*BlockTimeTooOldError); !ok {
+		t.Errorf("expected a block time too old once the upgrade is active, got '%v'", err)
+	}
+
+	_, err = state.AddBlock(NewBlock(state.LatestBlockHash(), 3, future+uint64(MaxFutureBlockTime.Seconds()), nil))
+	if _, ok := err.(*BlockTimeTooNewError); !ok {
+		t.Errorf("expected a block time too new once the upgrade is active, got '%v'", err)
+	}
+
+	_, err = state.AddBlock(NewBlock(state.LatestBlockHash(), 3, testBlockTime+1, nil))
+	if err != nil {
+		t.Errorf("a block younger than the median time past must be accepted: %s", err)
+	}
+}
+
+func TestConsensusActivatesWithItsUpgrade(t *testing.T) {
+	keys := newTestKeys(t, "alice")
+	state := newUpgradeTestState(t, genesis{
+		Consensus: ConsensusPoA,
+		Signers:   map[Account]PublicKey{"alice": publicKeyOf(keys["alice"])},
+		Upgrades:  upgradesAt(0, map[string]uint64{UpgradeConsensus: 2}),
+	})
+
+	if name := state.ConsensusAt(1).Name(); name != ConsensusInstantSeal {
+		t.Errorf("consensus of block 1 is '%s', expected '%s' before the upgrade", name, ConsensusInstantSeal)
+	}
+	if name := state.ConsensusAt(2).Name(); name != ConsensusPoA {
+		t.Errorf("consensus of block 2 is '%s', expected '%s' from the upgrade on", name, ConsensusPoA)
+	}
+
+	// Blocks below the upgrade are unsealed, and signed ones are rejected as they were before the upgrade
+	signed, err := nextTestBlock(state).Sign(keys["alice"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = state.AddBlock(signed)
+	if err == nil {
+		t.Errorf("a signed block must be rejected before the consensus upgrade")
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = state.AddBlock(nextTestBlock(state, NewTx("jrhodes", "meads", NewAmount(1), "")))
+		if err != nil {
+			t.Fatalf("unsealed block %d must be accepted before the upgrade: %s", i, err)
+		}
+	}
+
+	_, err = state.AddBlock(nextTestBlock(state))
+	if err == nil || !strings.Contains(err.Error(), "isn't an authorized signer") {
+		t.Errorf("expected an unsealed block to be rejected once the upgrade is active, got '%v'", err)
+	}
+
+	addTestBlock(t, state, keys["alice"], NewTx("jrhodes", "meads", NewAmount(1), ""))
+}
+
+func TestUnknownGenesisUpgrade(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "tbb-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dataDir)
+
+	err = InitDataDir(dataDir, []byte(`{"balances": {"jrhodes": 1000000}, "upgrades": {"warp_drive": 1}}`))
+	if err == nil {
+		var state *State
+		state, err = NewStateFromDisk(dataDir)
+		if err == nil {
+			state.Close()
+		}
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "unknown upgrade 'warp_drive'") {
+		t.Errorf("expected a genesis with an unknown upgrade to be refused, got '%v'", err)
+	}
+}
+
+func TestUpgradeHeightsDefaultToTheNextBlock(t *testing.T) {
+	state := newUpgradeTestState(t, genesis{Upgrades: map[string]uint64{UpgradeScripts: 1}})
+	dataDir := state.dataDir
+
+	// A new chain runs the latest rules from its first block
+	for _, upgrade := range Upgrades {
+		expected := uint64(0)
+		if upgrade.Name == UpgradeScripts {
+			expected = 1
+		}
+
+		if height := state.UpgradeHeight(upgrade.Name); height != expected {
+			t.Errorf("'%s' activates at block %d on a new chain, expected %d", upgrade.Name, height, expected)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		addTestBlock(t, state, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+	}
+
+	err := state.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A data dir written by a build without upgrades has no record
+	err = os.Remove(getUpgradesJsonFilePath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readOnly, err := NewStateFromDiskReadOnly(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+
+	if height := readOnly.UpgradeHeight(UpgradeAssets); height != 3 {
+		t.Errorf("'%s' activates at block %d on an existing chain, expected the next block 3", UpgradeAssets, height)
+	}
+
+	if fileExist(getUpgradesJsonFilePath(dataDir)) {
+		t.Errorf("a read-only State must not record the upgrade heights")
+	}
+
+	for i := 0; i < 2; i++ {
+		reopened, err := NewStateFromDisk(dataDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, upgrade := range Upgrades {
+			expected := uint64(3)
+			if upgrade.Name == UpgradeScripts {
+				expected = 1
+			}
+
+			if height := reopened.UpgradeHeight(upgrade.Name); height != expected {
+				t.Errorf("'%s' activates at block %d on reopening %d, expected %d", upgrade.Name, height, i, expected)
+			}
+		}
+
+		// The recorded heights don't move with the chain
+		addTestBlock(t, reopened, SealKey{}, NewTx("jrhodes", "meads", NewAmount(1), ""))
+
+		err = reopened.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	recorded, err := readRecordedUpgrades(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := recorded[UpgradeScripts]; ok || len(recorded) != len(Upgrades)-1 {
+		t.Errorf("recorded upgrades are %v, expected every upgrade but the genesis one", recorded)
+	}
+}
+
+func TestNewDataDirRunsEveryUpgradeFromItsFirstBlock(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	for _, upgrade := range Upgrades {
+		if !state.IsUpgradeActive(upgrade.Name, 0) {
+			t.Errorf("'%s' must be active from block 0 on a new data dir, it activates at block %d", upgrade.Name, state.UpgradeHeight(upgrade.Name))
+		}
+	}
+
+	addTestBlock(t, state, SealKey{}, NewAssetIssueTx("jrhodes", "jrhodes", NewAmount(5), "TAB"), NewNameRegisterTx("jrhodes", "bar", "jrhodes"))
+}
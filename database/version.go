@@ -0,0 +1,266 @@
+package database
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// DbVersion is the on-disk format version written and understood by this build.
+//
+// Version history:
+//
+//	0 - legacy format, block headers without a 'number' field (no version file)
+//	1 - block headers carry their 'number', version file introduced
+const DbVersion = 1
+
+type dbVersion struct {
+	Version uint `json:"version"`
+}
+
+// dbUpgrades maps a format version to the function rewriting a data dir into the next version.
+var dbUpgrades = map[uint]func(dataDir string) error{
+	0: upgradeV0ToV1,
+}
+
+// UpgradeDataDir rewrites an older data dir format into the current one, one version at a time.
+//
+// Returns the format version the data dir had before the upgrade.
+func UpgradeDataDir(dataDir string) (uint, error) {
+	if !fileExist(getGenesisJsonFilePath(dataDir)) {
+		return 0, fmt.Errorf("no tbb data directory found in '%s'", dataDir)
+	}
+
+	lock, err := lockDataDir(dataDir)
+	if err != nil {
+		return 0, err
+	}
+	defer lock.release()
+
+	version, err := readDbVersion(dataDir)
+	if err != nil {
+		return 0, err
+	}
+
+	if version > DbVersion {
+		return version, unsupportedDbVersionErr(dataDir, version)
+	}
+
+	err = initDbVersionIfNotExists(dataDir)
+	if err != nil {
+		return version, err
+	}
+
+	for v := version; v < DbVersion; v++ {
+		upgrade, ok := dbUpgrades[v]
+		if !ok {
+			return version, fmt.Errorf("no upgrade path from data dir format version %d", v)
+		}
+
+		err = upgrade(dataDir)
+		if err != nil {
+			return version, fmt.Errorf("upgrading data dir format from version %d to %d failed. %s", v, v+1, err.Error())
+		}
+
+		err = writeDbVersionToDisk(getVersionJsonFilePath(dataDir), v+1)
+		if err != nil {
+			return version, err
+		}
+	}
+
+	return version, recordUpgradeHeights(dataDir)
+}
+
+func checkDbVersion(dataDir string) error {
+	version, err := readDbVersion(dataDir)
+	if err != nil {
+		return err
+	}
+
+	if version > DbVersion {
+		return unsupportedDbVersionErr(dataDir, version)
+	}
+
+	if version < DbVersion {
+		return fmt.Errorf(
+			"data directory '%s' uses the outdated format version %d, this build requires version %d. Run 'tbb db upgrade --datadir=%s' first",
+			dataDir,
+			version,
+			DbVersion,
+			dataDir,
+		)
+	}
+
+	return nil
+}
+
+func unsupportedDbVersionErr(dataDir string, version uint) error {
+	return fmt.Errorf(
+		"data directory '%s' uses the unknown format version %d, this build supports up to version %d. Upgrade tbb to open it",
+		dataDir,
+		version,
+		DbVersion,
+	)
+}
+
+// readDbVersion reads the data dir format version.
+//
+// Data dirs created before the version file existed are considered legacy (version 0)
+// unless they don't hold any blocks yet, in which case there is nothing to upgrade.
+func readDbVersion(dataDir string) (uint, error) {
+	versionPath := getVersionJsonFilePath(dataDir)
+
+	if !fileExist(versionPath) {
+		info, err := os.Stat(getBlocksDbFilePath(dataDir))
+		if err != nil {
+			return 0, err
+		}
+
+		if info.Size() > 0 {
+			return 0, nil
+		}
+
+		return DbVersion, nil
+	}
+
+	content, err := ioutil.ReadFile(versionPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var v dbVersion
+	err = json.Unmarshal(content, &v)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read data dir format version from '%s'. %s", versionPath, err.Error())
+	}
+
+	return v.Version, nil
+}
+
+// initDbVersionIfNotExists writes the version file of a data dir created before it existed,
+// which holds no blocks yet and so is already in the current format.
+func initDbVersionIfNotExists(dataDir string) error {
+	if fileExist(getVersionJsonFilePath(dataDir)) {
+		return nil
+	}
+
+	version, err := readDbVersion(dataDir)
+	if err != nil || version != DbVersion {
+		return err
+	}
+
+	return writeDbVersionToDisk(getVersionJsonFilePath(dataDir), DbVersion)
+}
+
+func writeDbVersionToDisk(path string, version uint) error {
+	content, err := json.Marshal(dbVersion{version})
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, content, 0644)
+}
+
+type blockHeaderV0 struct {
+	Parent Hash   `json:"parent"`
+	Time   uint64 `json:"time"`
+}
+
+type blockV0 struct {
+	Header blockHeaderV0 `json:"header"`
+	TXs    []Tx          `json:"payload"`
+}
+
+type blockFSV0 struct {
+	Key   Hash    `json:"hash"`
+	Value blockV0 `json:"block"`
+}
+
+// upgradeV0ToV1 numbers the legacy blocks and recomputes their hashes and parent links.
+//
+// The original block.db is kept next to the upgraded one as block.db.v0.bak.
+func upgradeV0ToV1(dataDir string) error {
+	dbFilePath := getBlocksDbFilePath(dataDir)
+
+	f, err := os.OpenFile(dbFilePath, os.O_RDONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tmpFilePath := dbFilePath + ".upgrade"
+	tmp, err := os.OpenFile(tmpFilePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+
+	var number uint64
+	legacyParent := Hash{}
+	parent := Hash{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var legacyBlockFs blockFSV0
+		err = json.Unmarshal(scanner.Bytes(), &legacyBlockFs)
+		if err != nil {
+			return err
+		}
+
+		legacyBlockJson, err := json.Marshal(legacyBlockFs.Value)
+		if err != nil {
+			return err
+		}
+
+		if Hash(sha256.Sum256(legacyBlockJson)) != legacyBlockFs.Key {
+			return fmt.Errorf("legacy block '%x' doesn't match its hash", legacyBlockFs.Key)
+		}
+
+		if legacyBlockFs.Value.Header.Parent != legacyParent {
+			return fmt.Errorf("legacy block '%x' parent must be '%x' not '%x'", legacyBlockFs.Key, legacyParent, legacyBlockFs.Value.Header.Parent)
+		}
+
+		block := NewBlock(parent, number, legacyBlockFs.Value.Header.Time, legacyBlockFs.Value.TXs)
+		blockHash, err := block.Hash()
+		if err != nil {
+			return err
+		}
+
+		blockFsJson, err := json.Marshal(BlockFS{blockHash, block})
+		if err != nil {
+			return err
+		}
+
+		_, err = tmp.Write(append(blockFsJson, '\n'))
+		if err != nil {
+			return err
+		}
+
+		legacyParent = legacyBlockFs.Key
+		parent = blockHash
+		number++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(dbFilePath, dbFilePath+".v0.bak")
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFilePath, dbFilePath)
+}
@@ -0,0 +1,286 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newLegacyDataDir returns a data dir in the legacy format, holding the block.db shipped with the repository.
+func newLegacyDataDir(t *testing.T) string {
+	t.Helper()
+
+	dataDir := newTestDataDir(t)
+	err := os.MkdirAll(getDatabaseDirPath(dataDir), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyTestFile(t, "genesis.json", getGenesisJsonFilePath(dataDir))
+	copyTestFile(t, "block.db", getBlocksDbFilePath(dataDir))
+
+	return dataDir
+}
+
+// writeLegacyBlocks writes the blocks into block.db in the legacy format, hashing them and linking them to their parent
+// unless change alters a block after that.
+func writeLegacyBlocks(t *testing.T, dataDir string, blocks []blockV0, change func(i int, blockFs *blockFSV0)) {
+	t.Helper()
+
+	content := make([]byte, 0)
+	parent := Hash{}
+	for i, b := range blocks {
+		b.Header.Parent = parent
+
+		blockJson, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blockFs := blockFSV0{Key: sha256.Sum256(blockJson), Value: b}
+		parent = blockFs.Key
+
+		if change != nil {
+			change(i, &blockFs)
+		}
+
+		blockFsJson, err := json.Marshal(blockFs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = append(content, append(blockFsJson, '\n')...)
+	}
+
+	err := ioutil.WriteFile(getBlocksDbFilePath(dataDir), content, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpgradeLegacyDataDir(t *testing.T) {
+	dataDir := newLegacyDataDir(t)
+
+	legacy, err := ioutil.ReadFile(getBlocksDbFilePath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewStateFromDisk(dataDir)
+	if err == nil || !strings.Contains(err.Error(), "uses the outdated format version 0") {
+		t.Fatalf("expected a legacy data dir to be refused until upgraded, got '%v'", err)
+	}
+
+	fromVersion, err := UpgradeDataDir(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fromVersion != 0 {
+		t.Errorf("upgraded from version %d, expected 0", fromVersion)
+	}
+
+	backup, err := ioutil.ReadFile(getBlocksDbFilePath(dataDir) + ".v0.bak")
+	if err != nil {
+		t.Fatalf("the legacy block.db must be kept as block.db.v0.bak: %s", err)
+	}
+
+	if string(backup) != string(legacy) {
+		t.Errorf("block.db.v0.bak doesn't match the legacy block.db")
+	}
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state.LatestBlock().Header.Number != uint64(strings.Count(string(legacy), "\n")-1) {
+		t.Errorf("latest block is %d, expected every legacy block to be numbered from 0", state.LatestBlock().Header.Number)
+	}
+	state.Close()
+
+	// An upgraded data dir has nothing left to upgrade
+	fromVersion, err = UpgradeDataDir(dataDir)
+	if err != nil || fromVersion != DbVersion {
+		t.Errorf("upgrading again returned version %d and '%v', expected version %d", fromVersion, err, DbVersion)
+	}
+}
+
+func TestUpgradeNumbersAndRelinksLegacyBlocks(t *testing.T) {
+	dataDir := newLegacyDataDir(t)
+	blocks := []blockV0{
+		{Header: blockHeaderV0{Time: 1600000000}, TXs: []Tx{NewTx("jrhodes", "meads", NewAmount(10), "")}},
+		{Header: blockHeaderV0{Time: 1600000015}, TXs: []Tx{NewTx("meads", "lhendricks", NewAmount(4), "")}},
+		{Header: blockHeaderV0{Time: 1600000030}, TXs: []Tx{NewTx("jrhodes", "jrhodes", NewAmount(700), "reward")}},
+	}
+	writeLegacyBlocks(t, dataDir, blocks, nil)
+
+	_, err := UpgradeDataDir(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(getBlocksDbFilePath(dataDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != len(blocks) {
+		t.Fatalf("block.db holds %d blocks, expected %d", len(lines), len(blocks))
+	}
+
+	parent := Hash{}
+	for i, line := range lines {
+		var blockFs BlockFS
+		err = json.Unmarshal([]byte(line), &blockFs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hash, err := blockFs.Value.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		header := blockFs.Value.Header
+		if header.Number != uint64(i) || header.Parent != parent || header.Time != blocks[i].Header.Time || blockFs.Key != hash {
+			t.Errorf("block %d is %+v with hash '%s', expected number %d, parent '%s' and its own hash '%s'", i, header, blockFs.Key.Hex(), i, parent.Hex(), hash.Hex())
+		}
+		parent = hash
+	}
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if state.Balances["meads"] != NewAmount(6) || state.Balances["lhendricks"] != NewAmount(4) || state.Balances["jrhodes"] != NewAmount(1000000-10+700) {
+		t.Errorf("balances are %v after the upgrade", state.Balances)
+	}
+}
+
+func TestUpgradeRejectsInvalidLegacyBlocks(t *testing.T) {
+	blocks := []blockV0{
+		{Header: blockHeaderV0{Time: 1600000000}, TXs: []Tx{NewTx("jrhodes", "meads", NewAmount(10), "")}},
+		{Header: blockHeaderV0{Time: 1600000015}, TXs: []Tx{NewTx("meads", "lhendricks", NewAmount(4), "")}},
+	}
+
+	tests := []struct {
+		name   string
+		change func(i int, blockFs *blockFSV0)
+		err    string
+	}{
+		{"block changed after hashing", func(i int, blockFs *blockFSV0) {
+			if i == 1 {
+				blockFs.Value.TXs[0].Value = 5
+			}
+		}, "doesn't match its hash"},
+		{"block with another parent", func(i int, blockFs *blockFSV0) {
+			if i == 1 {
+				blockFs.Value.Header.Parent = Hash{0x01}
+				blockJson, _ := json.Marshal(blockFs.Value)
+				blockFs.Key = sha256.Sum256(blockJson)
+			}
+		}, "parent must be"},
+	}
+
+	for _, test := range tests {
+		dataDir := newLegacyDataDir(t)
+		writeLegacyBlocks(t, dataDir, blocks, test.change)
+
+		legacy, err := ioutil.ReadFile(getBlocksDbFilePath(dataDir))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = UpgradeDataDir(dataDir)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+
+		content, err := ioutil.ReadFile(getBlocksDbFilePath(dataDir))
+		if err != nil || string(content) != string(legacy) {
+			t.Errorf("%s: a failed upgrade must leave block.db untouched", test.name)
+		}
+
+		if version, err := readDbVersion(dataDir); err != nil || version != 0 {
+			t.Errorf("%s: a failed upgrade must leave the format version at 0, got %d", test.name, version)
+		}
+	}
+}
+
+func TestUnknownDbVersion(t *testing.T) {
+	dataDir := newLegacyDataDir(t)
+
+	err := writeDbVersionToDisk(getVersionJsonFilePath(dataDir), DbVersion+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewStateFromDisk(dataDir)
+	if err == nil || !strings.Contains(err.Error(), "unknown format version") {
+		t.Errorf("expected a data dir from a newer build to be refused, got '%v'", err)
+	}
+
+	_, err = UpgradeDataDir(dataDir)
+	if err == nil || !strings.Contains(err.Error(), "unknown format version") {
+		t.Errorf("expected upgrading a data dir from a newer build to fail, got '%v'", err)
+	}
+}
+
+func TestNewDataDirUsesTheCurrentVersion(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	version, err := readDbVersion(dataDir)
+	if err != nil || version != DbVersion {
+		t.Errorf("a new data dir is at version %d, expected %d", version, DbVersion)
+	}
+}
+
+func TestReadingTheVersionWritesNothing(t *testing.T) {
+	dataDir := newTestDataDir(t)
+	err := InitDataDir(dataDir, []byte(testGenesis))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Remove(getVersionJsonFilePath(dataDir))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+
+	version, err := readDbVersion(dataDir)
+	if err != nil || version != DbVersion {
+		t.Errorf("an empty data dir is at version %d, expected %d", version, DbVersion)
+	}
+
+	readOnly, err := NewStateFromDiskReadOnly(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readOnly.Close()
+
+	if fileExist(getVersionJsonFilePath(dataDir)) {
+		t.Errorf("reading the version of a data dir must not write its version file")
+	}
+
+	state, err := NewStateFromDisk(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Close()
+
+	if !fileExist(getVersionJsonFilePath(dataDir)) {
+		t.Errorf("opening an empty data dir for writing must record its version")
+	}
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVestedAt(t *testing.T) {
+	schedule := VestingSchedule{Amount: NewAmount(1000), StartHeight: 10, CliffHeight: 20, EndHeight: 50}
+
+	tests := []struct {
+		height uint64
+		vested Amount
+	}{
+		{0, 0},
+		{19, 0},
+		{20, NewAmount(250)},
+		{30, NewAmount(500)},
+		{31, NewAmount(525)},
+		{49, NewAmount(975)},
+		{50, NewAmount(1000)},
+		{1000, NewAmount(1000)},
+	}
+
+	for _, test := range tests {
+		if vested := schedule.VestedAt(test.height); vested != test.vested {
+			t.Errorf("vested %s at height %d, expected %s", vested, test.height, test.vested)
+		}
+	}
+
+	huge := VestingSchedule{Amount: maxAmount, StartHeight: 0, CliffHeight: 0, EndHeight: 3}
+	if vested := huge.VestedAt(2); vested != maxAmount/3*2 {
+		t.Errorf("vested %d of the max amount at 2/3 of the schedule, expected %d", vested, maxAmount/3*2)
+	}
+}
+
+func TestVestingUnlocksBalance(t *testing.T) {
+	s := newTestState(t, `{"balances": {"jrhodes": 1000000, "meads": 10}, "vesting": {"meads": {"amount": 100, "start_height": 0, "cliff_height": 2, "end_height": 4}}}`)
+
+	if s.TotalSupply() != NewAmount(1000110) || s.LockedSupply() != NewAmount(100) {
+		t.Errorf("total supply is %s with %s locked, expected the vesting amount to be part of the supply", s.TotalSupply(), s.LockedSupply())
+	}
+
+	expected := []struct {
+		liquid Amount
+		locked Amount
+	}{
+		{NewAmount(10), NewAmount(100)},
+		{NewAmount(10), NewAmount(100)},
+		{NewAmount(60), NewAmount(50)},
+		{NewAmount(85), NewAmount(25)},
+		{NewAmount(110), 0},
+		{NewAmount(110), 0},
+	}
+
+	for number, e := range expected {
+		addTestBlock(t, s, SealKey{})
+
+		if s.Balances["meads"] != e.liquid || s.LockedBalances()["meads"] != e.locked {
+			t.Errorf("at block %d meads holds %s with %s locked, expected %s with %s locked", number, s.Balances["meads"], s.LockedBalances()["meads"], e.liquid, e.locked)
+		}
+	}
+}
+
+func TestLockedBalanceCantBeSpent(t *testing.T) {
+	s := newTestState(t, `{"balances": {"jrhodes": 1000000, "meads": 10}, "vesting": {"meads": {"amount": 100, "start_height": 0, "cliff_height": 5, "end_height": 5}}}`)
+
+	_, err := s.AddBlock(nextTestBlock(s, NewTx("meads", "jrhodes", NewAmount(11), "")))
+	if err == nil || !strings.Contains(err.Error(), "liquid balance is 10 TBB, 100 TBB more are still locked by vesting") {
+		t.Errorf("expected spending locked TBB to fail, got '%v'", err)
+	}
+
+	addTestBlock(t, s, SealKey{}, NewTx("meads", "jrhodes", NewAmount(10), ""))
+}
+
+func TestInvalidVestingGenesis(t *testing.T) {
+	tests := []struct {
+		name    string
+		genesis string
+		err     string
+	}{
+		{"cliff before start", `{"balances": {}, "vesting": {"meads": {"amount": 1, "start_height": 5, "cliff_height": 4, "end_height": 10}}}`, "'meads' vesting heights must be ordered"},
+		{"end before cliff", `{"balances": {}, "vesting": {"meads": {"amount": 1, "start_height": 0, "cliff_height": 4, "end_height": 3}}}`, "'meads' vesting heights must be ordered"},
+		{"over the max supply", `{"balances": {"jrhodes": 10}, "max_supply": 100, "vesting": {"meads": {"amount": 91, "end_height": 3}}}`, "exceeds the max supply"},
+	}
+
+	for _, test := range tests {
+		dataDir := newTestDataDir(t)
+
+		err := InitDataDir(dataDir, []byte(test.genesis))
+		if err == nil {
+			var s *State
+			s, err = NewStateFromDisk(dataDir)
+			if err == nil {
+				s.Close()
+			}
+		}
+
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error containing '%s', got '%v'", test.name, test.err, err)
+		}
+	}
+}
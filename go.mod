@@ -2,4 +2,7 @@ module github.com/jsrhodes15/the-blockchain-bar
 
 go 1.14
 
-require github.com/spf13/cobra v1.0.0
+require (
+	github.com/spf13/cobra v1.0.0
+	gopkg.in/yaml.v2 v2.4.0
+)
@@ -5,7 +5,7 @@ import (
 	"github.com/jsrhodes15/the-blockchain-bar/database"
 	"net/http"
 	"strconv"
-	"time"
+	"strings"
 )
 
 type ErrRes struct {
@@ -13,15 +13,53 @@ type ErrRes struct {
 }
 
 type BalancesRes struct {
-	Hash     database.Hash             `json:"block_hash"`
-	Balances map[database.Account]uint `json:"balances"`
+	Hash     database.Hash                        `json:"block_hash"`
+	Asset    database.AssetID                     `json:"asset"`
+	Balances map[database.Account]database.Amount `json:"balances"`
+	Locked   map[database.Account]database.Amount `json:"locked,omitempty"`
+}
+
+type SupplyRes struct {
+	Hash        database.Hash   `json:"block_hash"`
+	Total       database.Amount `json:"total"`
+	Circulating database.Amount `json:"circulating"`
+	Locked      database.Amount `json:"locked"`
+	Staked      database.Amount `json:"staked"`
+	Max         database.Amount `json:"max"`
 }
 
 type TxAddReq struct {
-	From  string `json:"from"`
-	To    string `json:"to"`
-	Value uint   `json:"value"`
-	Data  string `json:"data"`
+	From  string          `json:"from"`
+	To    string          `json:"to"`
+	Value database.Amount `json:"value"`
+	Data  string          `json:"data"`
+	Type  string          `json:"type"`
+	Asset string          `json:"asset"`
+	Name  string          `json:"name"`
+
+	Script   string   `json:"script"`
+	Args     []string `json:"args"`
+	GasLimit uint64   `json:"gas_limit"`
+
+	HashLock      *database.Hash `json:"hash_lock"`
+	Preimage      string         `json:"preimage"`
+	TimeoutHeight uint64         `json:"timeout_height"`
+
+	ChannelKey      *database.PublicKey     `json:"channel_key"`
+	ChallengePeriod uint64                  `json:"challenge_period"`
+	ChannelUpdate   *database.ChannelUpdate `json:"channel_update"`
+
+	Vote *database.PoaVote `json:"vote"`
+
+	ValidatorKey *database.PublicKey          `json:"validator_key"`
+	Evidence     *database.DoubleSignEvidence `json:"evidence"`
+
+	UnlockHeight uint64 `json:"unlock_height"`
+	UnlockTime   uint64 `json:"unlock_time"`
+
+	Nonce      uint64                   `json:"nonce"`
+	Multisig   *database.MultisigPolicy `json:"multisig"`
+	Signatures []database.TxSignature   `json:"signatures"`
 }
 
 type TxAddRes struct {
@@ -31,23 +69,103 @@ type TxAddRes struct {
 type StatusRes struct {
 	Hash       database.Hash `json:"block_hash"`
 	Number     uint64        `json:"block_number"`
+	TotalWork  uint64        `json:"total_work"`
 	KnownPeers KnownPeers    `json:"peers_known"`
+
+	Finalized *database.Checkpoint `json:"finalized"`
+	Orphans   int                  `json:"orphans"`
+}
+
+type NameRes struct {
+	Hash database.Hash `json:"block_hash"`
+	database.NameRecord
+}
+
+type ScriptRes struct {
+	Hash    database.Hash     `json:"block_hash"`
+	Account database.Account  `json:"account"`
+	Script  string            `json:"script"`
+	Storage map[string]string `json:"storage"`
+}
+
+type HtlcsRes struct {
+	Hash  database.Hash   `json:"block_hash"`
+	Htlcs []database.Htlc `json:"htlcs"`
+}
+
+type ChannelsRes struct {
+	Hash     database.Hash      `json:"block_hash"`
+	Channels []database.Channel `json:"channels"`
+}
+
+type ValidatorsRes struct {
+	Hash         database.Hash        `json:"block_hash"`
+	Validators   []database.Validator `json:"validators"`
+	Unbonding    []database.Unbonding `json:"unbonding"`
+	NextProposer database.Account     `json:"next_proposer"`
+}
+
+type ScheduledTxsRes struct {
+	Hash      database.Hash                `json:"block_hash"`
+	Scheduled []database.ScheduledTransfer `json:"scheduled"`
 }
 
 type SyncRes struct {
 	Blocks []database.Block `json:"blocks"`
 }
 
+type ForksRes struct {
+	Head  database.ChainHead `json:"head"`
+	Forks []database.Fork    `json:"forks"`
+	Stats database.ForkStats `json:"stats"`
+}
+
+type BlockRes struct {
+	Hash  database.Hash  `json:"block_hash"`
+	Block database.Block `json:"block"`
+}
+
 type AddPeerRes struct {
 	Success bool   `json:"success"`
 	Error   string `json:"error"`
 }
 
 func listBalancesHandler(w http.ResponseWriter, req *http.Request, state *database.State) {
-	writeRes(w, BalancesRes{state.LatestBlockHash(), state.Balances})
+	asset := database.NativeAsset
+	if reqAsset := req.URL.Query().Get(endpointBalancesQueryKeyAsset); reqAsset != "" {
+		asset = database.AssetID(reqAsset)
+	}
+
+	balances := state.BalancesOf(asset)
+	if balances == nil {
+		writeErrRes(w, fmt.Errorf("asset '%s' doesn't exist", asset))
+		return
+	}
+
+	res := BalancesRes{Hash: state.LatestBlockHash(), Asset: asset, Balances: balances}
+	if asset == database.NativeAsset {
+		res.Locked = state.LockedBalances()
+	}
+
+	writeRes(w, res)
+}
+
+func supplyHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	supply := state.Supply()
+
+	writeRes(w, SupplyRes{
+		Hash:        supply.BlockHash,
+		Total:       supply.Total,
+		Circulating: supply.Circulating,
+		Locked:      supply.Locked,
+		Staked:      supply.Staked,
+		Max:         supply.Max,
+	})
 }
 
-func txAddHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+func txAddHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	state := node.state
+
 	req := TxAddReq{}
 	err := readReq(r, &req)
 	if err != nil {
@@ -55,20 +173,53 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, state *database.State)
 		return
 	}
 
+	// Senders and recipients can be given by their registered name
 	tx := database.NewTx(
-		database.NewAccount(req.From),
-		database.NewAccount(req.To),
+		state.ResolveAccount(req.From),
+		state.ResolveAccount(req.To),
 		req.Value,
 		req.Data,
 	)
+	tx.Type = database.TxType(req.Type)
+	tx.Asset = database.AssetID(req.Asset)
+	tx.Name = req.Name
+	tx.Script = req.Script
+	tx.Args = req.Args
+	tx.GasLimit = req.GasLimit
+	tx.HashLock = req.HashLock
+	tx.Preimage = req.Preimage
+	tx.TimeoutHeight = req.TimeoutHeight
+	tx.ChannelKey = req.ChannelKey
+	tx.ChallengePeriod = req.ChallengePeriod
+	tx.ChannelUpdate = req.ChannelUpdate
+	tx.Vote = req.Vote
+	tx.ValidatorKey = req.ValidatorKey
+	tx.Evidence = req.Evidence
+	tx.UnlockHeight = req.UnlockHeight
+	tx.UnlockTime = req.UnlockTime
+	tx.Nonce = req.Nonce
+	tx.Multisig = req.Multisig
+	tx.Signatures = req.Signatures
+
+	err = state.CheckTxLimits(tx)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
 
 	block := database.NewBlock(
 		state.LatestBlockHash(),
 		state.LatestBlock().Header.Number+1,
-		uint64(time.Now().Unix()),
+		state.NextBlockTime(),
 		[]database.Tx{tx},
 	)
 
+	block, err = node.sealBlock(block)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
 	hash, err := state.AddBlock(block)
 	if err != nil {
 		writeErrRes(w, err)
@@ -78,11 +229,68 @@ func txAddHandler(w http.ResponseWriter, r *http.Request, state *database.State)
 	writeRes(w, TxAddRes{hash})
 }
 
+func nameHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	name := strings.TrimPrefix(r.URL.Path, endpointNames)
+
+	record, ok := state.LookupName(name)
+	if !ok {
+		writeErrRes(w, fmt.Errorf("name '%s' is not registered", name))
+		return
+	}
+
+	writeRes(w, NameRes{state.LatestBlockHash(), record})
+}
+
+func scriptHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	account := state.ResolveAccount(strings.TrimPrefix(r.URL.Path, endpointScripts))
+
+	script, ok := state.Script(account)
+	if !ok {
+		writeErrRes(w, fmt.Errorf("account '%s' has no script", account))
+		return
+	}
+
+	writeRes(w, ScriptRes{state.LatestBlockHash(), account, script, state.Storage(account)})
+}
+
+func scheduledTxsHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	writeRes(w, ScheduledTxsRes{state.LatestBlockHash(), state.ScheduledTransfers()})
+}
+
+func htlcsHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	writeRes(w, HtlcsRes{state.LatestBlockHash(), state.Htlcs()})
+}
+
+func channelsHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	writeRes(w, ChannelsRes{state.LatestBlockHash(), state.Channels()})
+}
+
+func validatorsHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	if state.Consensus().Name() != database.ConsensusPoS {
+		writeErrRes(w, fmt.Errorf("the chain doesn't use the '%s' consensus", database.ConsensusPoS))
+		return
+	}
+
+	proposer, err := state.Proposer(state.LatestBlock().Header.Number+1, state.LatestBlockHash())
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, ValidatorsRes{state.LatestBlockHash(), state.Validators(), state.Unbondings(), proposer})
+}
+
 func statusHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	res := StatusRes{
 		Hash:       node.state.LatestBlockHash(),
 		Number:     node.state.LatestBlock().Header.Number,
+		TotalWork:  node.state.TotalWork(),
 		KnownPeers: node.knownPeers,
+		Orphans:    len(node.state.Orphans()),
+	}
+
+	if finalized, ok := node.state.LatestFinalized(); ok {
+		res.Finalized = &finalized
 	}
 
 	writeRes(w, res)
@@ -103,6 +311,33 @@ func syncHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	writeRes(w, SyncRes{Blocks: blocks})
 }
 
+func forksHandler(w http.ResponseWriter, r *http.Request, state *database.State) {
+	head := database.ChainHead{
+		Hash:      state.LatestBlockHash(),
+		Number:    state.LatestBlock().Header.Number,
+		TotalWork: state.TotalWork(),
+	}
+
+	writeRes(w, ForksRes{head, state.Forks(), state.ForkStats()})
+}
+
+func blockHandler(w http.ResponseWriter, r *http.Request, node *Node) {
+	hash := database.Hash{}
+	err := hash.UnmarshalText([]byte(r.URL.Query().Get(endpointBlockQueryKeyHash)))
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	block, err := database.GetBlock(hash, node.dataDir)
+	if err != nil {
+		writeErrRes(w, err)
+		return
+	}
+
+	writeRes(w, BlockRes{hash, block})
+}
+
 func addPeerHandler(w http.ResponseWriter, r *http.Request, node *Node) {
 	peerIP := r.URL.Query().Get(endpointAddPeerQueryKeyIP)
 	peerPortRaw := r.URL.Query().Get(endpointAddPeerQueryKeyPort)
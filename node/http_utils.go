@@ -3,6 +3,7 @@ package node
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 )
@@ -26,12 +27,19 @@ func writeRes(w http.ResponseWriter, content interface{}) {
 	w.Write(contentJson)
 }
 
+// maxReqBodySize bounds the body of requests sent to the node HTTP API.
+const maxReqBodySize = 64 * 1024
+
+// maxResBodySize bounds the body of responses read from peers, sync responses carry whole blocks.
+const maxResBodySize = 64 * 1024 * 1024
+
 func readReq(r *http.Request, reqBody interface{}) error {
-	reqBodyJson, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	reqBodyJson, err := readLimited(r.Body, maxReqBodySize)
 	if err != nil {
 		return fmt.Errorf("unable to read request body. %s", err.Error())
 	}
-	defer r.Body.Close()
 
 	err = json.Unmarshal(reqBodyJson, reqBody)
 	if err != nil {
@@ -42,11 +50,12 @@ func readReq(r *http.Request, reqBody interface{}) error {
 }
 
 func readRes(r *http.Response, reqBody interface{}) error {
-	reqBodyJson, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	reqBodyJson, err := readLimited(r.Body, maxResBodySize)
 	if err != nil {
 		return fmt.Errorf("unable to read response body. %s", err.Error())
 	}
-	defer r.Body.Close()
 
 	err = json.Unmarshal(reqBodyJson, reqBody)
 	if err != nil {
@@ -55,3 +64,16 @@ func readRes(r *http.Response, reqBody interface{}) error {
 
 	return nil
 }
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	content, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("body exceeds the %d bytes limit", limit)
+	}
+
+	return content, nil
+}
@@ -10,11 +10,22 @@ import (
 const DefaultIP = "127.0.0.1"
 const DefaultHttpPort = 8080
 
+const endpointBalancesQueryKeyAsset = "asset"
+
+const endpointNames = "/names/"
+
+const endpointScripts = "/scripts/"
+
 const endpointStatus = "/node/status"
 
 const endpointSync = "/node/sync"
 const endpointSyncQueryKeyFromBlock = "fromBlock"
 
+const endpointForks = "/chain/forks"
+
+const endpointBlock = "/node/block"
+const endpointBlockQueryKeyHash = "hash"
+
 const endpointAddPeer = "/node/peer"
 const endpointAddPeerQueryKeyIP = "ip"
 const endpointAddPeerQueryKeyPort = "port"
@@ -32,17 +43,26 @@ func (pn PeerNode) TcpAddress() string {
 
 type KnownPeers map[string]PeerNode
 
+// ConsensusConfig tells what consensus the node expects genesis to use, as which signer,
+// validator or miner it seals the blocks it produces and which blocks it declares final.
+type ConsensusConfig struct {
+	Engine      string
+	SealKey     database.SealKey
+	Checkpoints []database.Checkpoint
+}
+
 type Node struct {
 	dataDir string
 	ip      string
 	port    uint64
 
-	state *database.State
+	state     *database.State
+	consensus ConsensusConfig
 
 	knownPeers KnownPeers
 }
 
-func New(dataDir string, ip string, port uint64, bootstrap PeerNode) *Node {
+func New(dataDir string, ip string, port uint64, bootstrap PeerNode, consensus ConsensusConfig) *Node {
 	// Initialize a new map with only one known peer, the bootstrap node
 	knownPeers := make(map[string]PeerNode)
 	knownPeers[bootstrap.TcpAddress()] = bootstrap
@@ -51,6 +71,7 @@ func New(dataDir string, ip string, port uint64, bootstrap PeerNode) *Node {
 		dataDir:    dataDir,
 		ip:         ip,
 		port:       port,
+		consensus:  consensus,
 		knownPeers: knownPeers,
 	}
 }
@@ -71,14 +92,51 @@ func (n *Node) Run() error {
 
 	n.state = state
 
+	err = n.checkConsensus()
+	if err != nil {
+		return err
+	}
+
 	go n.sync(ctx)
 
 	http.HandleFunc("/balances/list", func(w http.ResponseWriter, r *http.Request) {
 		listBalancesHandler(w, r, state)
 	})
 
+	http.HandleFunc("/supply", func(w http.ResponseWriter, r *http.Request) {
+		supplyHandler(w, r, state)
+	})
+
 	http.HandleFunc("/tx/add", func(w http.ResponseWriter, r *http.Request) {
-		txAddHandler(w, r, state)
+		txAddHandler(w, r, n)
+	})
+
+	http.HandleFunc("/tx/scheduled", func(w http.ResponseWriter, r *http.Request) {
+		scheduledTxsHandler(w, r, state)
+	})
+
+	http.HandleFunc("/tx/htlcs", func(w http.ResponseWriter, r *http.Request) {
+		htlcsHandler(w, r, state)
+	})
+
+	http.HandleFunc("/tx/channels", func(w http.ResponseWriter, r *http.Request) {
+		channelsHandler(w, r, state)
+	})
+
+	http.HandleFunc("/validators", func(w http.ResponseWriter, r *http.Request) {
+		validatorsHandler(w, r, state)
+	})
+
+	http.HandleFunc(endpointNames, func(w http.ResponseWriter, r *http.Request) {
+		nameHandler(w, r, state)
+	})
+
+	http.HandleFunc(endpointScripts, func(w http.ResponseWriter, r *http.Request) {
+		scriptHandler(w, r, state)
+	})
+
+	http.HandleFunc(endpointForks, func(w http.ResponseWriter, r *http.Request) {
+		forksHandler(w, r, state)
 	})
 
 	http.HandleFunc(endpointStatus, func(w http.ResponseWriter, r *http.Request) {
@@ -89,6 +147,10 @@ func (n *Node) Run() error {
 		syncHandler(w, r, n)
 	})
 
+	http.HandleFunc(endpointBlock, func(w http.ResponseWriter, r *http.Request) {
+		blockHandler(w, r, n)
+	})
+
 	http.HandleFunc(endpointAddPeer, func(w http.ResponseWriter, r *http.Request) {
 		addPeerHandler(w, r, n)
 	})
@@ -96,6 +158,46 @@ func (n *Node) Run() error {
 	return http.ListenAndServe(fmt.Sprintf("%s:%d", n.ip, n.port), nil)
 }
 
+func (n *Node) checkConsensus() error {
+	engine := n.state.Consensus().Name()
+	if n.consensus.Engine != "" && n.consensus.Engine != engine {
+		return fmt.Errorf("node expects the '%s' consensus but genesis uses '%s'", n.consensus.Engine, engine)
+	}
+
+	fmt.Printf("Running the '%s' consensus\n", engine)
+	if n.consensus.SealKey.Account != "" {
+		fmt.Printf("Sealing blocks as '%s'\n", n.consensus.SealKey.Account)
+	}
+
+	for _, checkpoint := range n.consensus.Checkpoints {
+		err := n.state.AddCheckpoint(checkpoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	if finalized, ok := n.state.LatestFinalized(); ok {
+		fmt.Printf("Blocks are final up to block %d '%s'\n", finalized.Number, finalized.Hash.Hex())
+	}
+
+	return nil
+}
+
+// sealBlock lets the consensus prepare and seal a block produced by the node.
+//
+// The block is sealed against a snapshot of the State, so mining doesn't hold up the sync and the handlers.
+func (n *Node) sealBlock(b database.Block) (database.Block, error) {
+	state := n.state.DryRun()
+	consensus := state.ConsensusAt(b.Header.Number)
+
+	err := consensus.Prepare(&b.Header, state)
+	if err != nil {
+		return database.Block{}, err
+	}
+
+	return consensus.Seal(b, state, n.consensus.SealKey)
+}
+
 func (n *Node) AddPeer(peer PeerNode) {
 	n.knownPeers[peer.TcpAddress()] = peer
 }
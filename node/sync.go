@@ -47,6 +47,14 @@ func (n *Node) doSync() {
 		}
 
 		err = n.syncBlocks(peer, status)
+		if _, ok := err.(*database.CheckpointMismatchError); ok {
+			fmt.Printf("ERROR: %s\n", err)
+			fmt.Printf("Peer '%s' conflicts with a checkpoint and was removed from KnownPeers\n", peer.TcpAddress())
+
+			n.RemovePeer(peer)
+
+			continue
+		}
 		if err != nil {
 			fmt.Printf("ERROR: %s\n", err)
 			continue
@@ -68,30 +76,95 @@ func (n *Node) syncBlocks(peer PeerNode, status StatusRes) error {
 		return nil
 	}
 
-	// If peer has less blocks than us, ignore it
-	if status.Number < localBlockNumber {
-		return nil
+	// A peer whose head or finalized block conflicts with our checkpoints is on another chain
+	err := n.state.VerifyCheckpoint(status.Number, status.Hash)
+	if err != nil {
+		return err
 	}
 
-	// If it's the genesis block and we already synced it, ignore it
-	if status.Number == 0 && !n.state.LatestBlockHash().IsEmpty() {
+	if status.Finalized != nil {
+		err = n.state.VerifyCheckpoint(status.Finalized.Number, status.Finalized.Hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Never reorg below our latest finalized block, whatever the fork choice says
+	if finalized, ok := n.state.LatestFinalized(); ok && status.Number < finalized.Number {
 		return nil
 	}
 
-	// Display found 1 new block if we sync the genesis block (block0)
-	newBlocksCount := status.Number - localBlockNumber
-	if localBlockNumber == 0 && status.Number == 0 {
-		newBlocksCount = 1
+	// Nothing to sync if we already have the peer latest block, on the chain or on a side chain
+	if n.state.IsKnownBlock(status.Hash) {
+		return nil
 	}
 
-	fmt.Printf("Found %d new blocks from Peer %s\n", newBlocksCount, peer.TcpAddress())
+	if status.Number >= localBlockNumber {
+		fmt.Printf("Found new blocks up to block %d from Peer %s\n", status.Number, peer.TcpAddress())
+	}
 
 	blocks, err := fetchBlocksFromPeer(peer, n.state.LatestBlockHash())
 	if err != nil {
 		return err
 	}
 
-	return n.state.AddBlocks(blocks)
+	// A peer which doesn't know our latest block is on another branch. The State validates it as a side chain
+	// and reorgs to it once the consensus fork choice prefers it, based on the work of its validated blocks
+	if len(blocks) == 0 && !n.state.LatestBlockHash().IsEmpty() {
+		return n.syncFork(peer, status)
+	}
+
+	err = n.state.AddBlocks(blocks)
+	if err != nil {
+		return err
+	}
+
+	return n.syncMissingAncestors(peer)
+}
+
+// syncFork fetches the branch the peer is on when its latest block isn't known yet, the State retains it
+// as a side chain, so the forks between nodes can be diagnosed, and reorgs to it if it's the better chain.
+func (n *Node) syncFork(peer PeerNode, status StatusRes) error {
+	if n.state.IsKnownBlock(status.Hash) {
+		return nil
+	}
+
+	fmt.Printf("Peer %s is on another branch, its latest block is %d '%s'\n", peer.TcpAddress(), status.Number, status.Hash.Hex())
+
+	block, err := fetchBlockFromPeer(peer, status.Hash)
+	if err != nil {
+		return err
+	}
+
+	err = n.state.AddBlocks([]database.Block{block})
+	if err != nil {
+		return err
+	}
+
+	return n.syncMissingAncestors(peer)
+}
+
+// syncMissingAncestors requests from the peer, one by one, the blocks the orphans are waiting for
+// so they connect to the chain.
+func (n *Node) syncMissingAncestors(peer PeerNode) error {
+	for i := 0; i < database.MaxOrphanBlocks; i++ {
+		missing := n.state.MissingAncestors()
+		if len(missing) == 0 {
+			return nil
+		}
+
+		block, err := fetchBlockFromPeer(peer, missing[0])
+		if err != nil {
+			return err
+		}
+
+		err = n.state.AddBlocks([]database.Block{block})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func (n *Node) syncKnownPeers(peer PeerNode, status StatusRes) error {
@@ -163,6 +236,50 @@ func queryPeerStatus(peer PeerNode) (StatusRes, error) {
 	return statusRes, nil
 }
 
+func fetchBlockFromPeer(peer PeerNode, hash database.Hash) (database.Block, error) {
+	fmt.Printf("Requesting missing block '%s' from Peer %s...\n", hash.Hex(), peer.TcpAddress())
+
+	url := fmt.Sprintf(
+		"http://%s%s?%s=%s",
+		peer.TcpAddress(),
+		endpointBlock,
+		endpointBlockQueryKeyHash,
+		hash.Hex(),
+	)
+
+	res, err := http.Get(url)
+	if err != nil {
+		return database.Block{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		errRes := ErrRes{}
+		err = readRes(res, &errRes)
+		if err != nil {
+			return database.Block{}, err
+		}
+
+		return database.Block{}, fmt.Errorf("peer %s can't send block '%s'. %s", peer.TcpAddress(), hash.Hex(), errRes.Error)
+	}
+
+	blockRes := BlockRes{}
+	err = readRes(res, &blockRes)
+	if err != nil {
+		return database.Block{}, err
+	}
+
+	blockHash, err := blockRes.Block.Hash()
+	if err != nil {
+		return database.Block{}, err
+	}
+
+	if blockHash != hash {
+		return database.Block{}, fmt.Errorf("peer %s sent block '%s' instead of '%s'", peer.TcpAddress(), blockHash.Hex(), hash.Hex())
+	}
+
+	return blockRes.Block, nil
+}
+
 func fetchBlocksFromPeer(peer PeerNode, fromBlock database.Hash) ([]database.Block, error) {
 	fmt.Printf("Importing blocks from Peer %s...\n", peer.TcpAddress())
 
@@ -0,0 +1,344 @@
+// Package vm implements the small, deterministic and metered stack language TBB scripts are written in.
+//
+// A script is a whitespace separated list of tokens. Numbers and "quoted strings" are pushed on
+// the stack, ':label' marks a jump target, '#' starts a comment and every other token is an opcode.
+// Stack items are strings, arithmetic opcodes read them as unsigned 64 bit decimal numbers and
+// booleans are 0 or 1. Amounts are counted in the smallest TBB unit.
+package vm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const MaxStackDepth = 256
+const MaxItemLength = 256
+
+// Context describes the TX executing the script.
+type Context struct {
+	Caller string
+	Self   string
+	Value  uint64
+	Height uint64
+	Args   []string
+}
+
+// Host gives the script access to the ledger, on behalf of the Self account.
+type Host interface {
+	Load(key string) string
+	Store(key string, value string) error
+	Balance(account string) uint64
+	Transfer(to string, amount uint64) error
+}
+
+type opcode struct {
+	name string
+	gas  uint64
+	// arguments popped from the stack, deepest first
+	pops int
+	exec func(m *machine, args []string) error
+}
+
+type instruction struct {
+	op      *opcode
+	literal string
+	target  int
+}
+
+type Program struct {
+	instructions []instruction
+}
+
+type machine struct {
+	ctx   Context
+	host  Host
+	stack []string
+	pc    int
+	// pc of the next instruction, set by jumps
+	next int
+	halt bool
+}
+
+// OutOfGasError is returned when a script needs more gas than its limit.
+type OutOfGasError struct {
+	Limit uint64
+}
+
+func (e *OutOfGasError) Error() string {
+	return fmt.Sprintf("script ran out of gas, its limit is %d", e.Limit)
+}
+
+var opcodes = map[string]*opcode{}
+
+func init() {
+	for _, op := range []*opcode{
+		{"DUP", 1, 1, func(m *machine, a []string) error { return m.push(a[0], a[0]) }},
+		{"DROP", 1, 1, func(m *machine, a []string) error { return nil }},
+		{"SWAP", 1, 2, func(m *machine, a []string) error { return m.push(a[1], a[0]) }},
+		{"OVER", 1, 2, func(m *machine, a []string) error { return m.push(a[0], a[1], a[0]) }},
+		{"ADD", 2, 2, arithmetic(func(x, y uint64) (uint64, bool) { return x + y, x+y >= x })},
+		{"SUB", 2, 2, arithmetic(func(x, y uint64) (uint64, bool) { return x - y, y <= x })},
+		{"MUL", 3, 2, arithmetic(func(x, y uint64) (uint64, bool) { return x * y, x == 0 || (x*y)/x == y })},
+		{"DIV", 3, 2, arithmetic(func(x, y uint64) (uint64, bool) {
+			if y == 0 {
+				return 0, false
+			}
+			return x / y, true
+		})},
+		{"MOD", 3, 2, arithmetic(func(x, y uint64) (uint64, bool) {
+			if y == 0 {
+				return 0, false
+			}
+			return x % y, true
+		})},
+		{"LT", 2, 2, arithmetic(func(x, y uint64) (uint64, bool) { return boolToUint(x < y), true })},
+		{"GT", 2, 2, arithmetic(func(x, y uint64) (uint64, bool) { return boolToUint(x > y), true })},
+		{"AND", 2, 2, arithmetic(func(x, y uint64) (uint64, bool) { return boolToUint(x != 0 && y != 0), true })},
+		{"OR", 2, 2, arithmetic(func(x, y uint64) (uint64, bool) { return boolToUint(x != 0 || y != 0), true })},
+		{"EQ", 2, 2, func(m *machine, a []string) error { return m.pushUint(boolToUint(a[0] == a[1])) }},
+		{"NOT", 2, 1, func(m *machine, a []string) error {
+			x, err := toUint(a[0])
+			if err != nil {
+				return err
+			}
+			return m.pushUint(boolToUint(x == 0))
+		}},
+		{"CONCAT", 2, 2, func(m *machine, a []string) error { return m.push(a[0] + a[1]) }},
+		{"CALLER", 1, 0, func(m *machine, a []string) error { return m.push(m.ctx.Caller) }},
+		{"SELF", 1, 0, func(m *machine, a []string) error { return m.push(m.ctx.Self) }},
+		{"VALUE", 1, 0, func(m *machine, a []string) error { return m.pushUint(m.ctx.Value) }},
+		{"HEIGHT", 1, 0, func(m *machine, a []string) error { return m.pushUint(m.ctx.Height) }},
+		{"ARGC", 1, 0, func(m *machine, a []string) error { return m.pushUint(uint64(len(m.ctx.Args))) }},
+		{"ARG", 2, 1, func(m *machine, a []string) error {
+			i, err := toUint(a[0])
+			if err != nil {
+				return err
+			}
+			if i >= uint64(len(m.ctx.Args)) {
+				return fmt.Errorf("script reads argument %d, the TX has %d", i, len(m.ctx.Args))
+			}
+			return m.push(m.ctx.Args[i])
+		}},
+		{"SLOAD", 20, 1, func(m *machine, a []string) error { return m.push(m.host.Load(a[0])) }},
+		{"SSTORE", 100, 2, func(m *machine, a []string) error { return m.host.Store(a[0], a[1]) }},
+		{"BALANCE", 20, 1, func(m *machine, a []string) error { return m.pushUint(m.host.Balance(a[0])) }},
+		{"TRANSFER", 100, 2, func(m *machine, a []string) error {
+			amount, err := toUint(a[1])
+			if err != nil {
+				return err
+			}
+			return m.host.Transfer(a[0], amount)
+		}},
+		{"VERIFY", 1, 1, func(m *machine, a []string) error {
+			x, err := toUint(a[0])
+			if err != nil {
+				return err
+			}
+			if x == 0 {
+				return fmt.Errorf("script verification failed at instruction %d", m.pc)
+			}
+			return nil
+		}},
+		{"JUMP", 2, 0, func(m *machine, a []string) error { return nil }},
+		{"JUMPI", 3, 1, func(m *machine, a []string) error { return nil }},
+		{"STOP", 0, 0, func(m *machine, a []string) error { m.halt = true; return nil }},
+		{"REVERT", 0, 0, func(m *machine, a []string) error { return fmt.Errorf("script reverted at instruction %d", m.pc) }},
+	} {
+		opcodes[op.name] = op
+	}
+}
+
+var pushOp = &opcode{"PUSH", 1, 0, func(m *machine, a []string) error { return nil }}
+
+// Parse compiles a script source into a Program, resolving its labels.
+func Parse(source string) (Program, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return Program{}, err
+	}
+
+	labels := make(map[string]int)
+	instructions := make([]instruction, 0, len(tokens))
+	jumps := make(map[int]string)
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+
+		switch {
+		case strings.HasPrefix(token, ":"):
+			label := token[1:]
+			if _, exists := labels[label]; exists || label == "" {
+				return Program{}, fmt.Errorf("invalid or duplicate label '%s'", token)
+			}
+			labels[label] = len(instructions)
+		case strings.HasPrefix(token, "\""):
+			instructions = append(instructions, instruction{op: pushOp, literal: token[1 : len(token)-1]})
+		case token[0] >= '0' && token[0] <= '9':
+			_, err := toUint(token)
+			if err != nil {
+				return Program{}, err
+			}
+			instructions = append(instructions, instruction{op: pushOp, literal: token})
+		default:
+			op, ok := opcodes[token]
+			if !ok {
+				return Program{}, fmt.Errorf("unknown opcode '%s'", token)
+			}
+
+			if op.name == "JUMP" || op.name == "JUMPI" {
+				if i+1 >= len(tokens) {
+					return Program{}, fmt.Errorf("%s requires a label", op.name)
+				}
+				i++
+				jumps[len(instructions)] = tokens[i]
+			}
+
+			instructions = append(instructions, instruction{op: op})
+		}
+	}
+
+	for pc, label := range jumps {
+		target, ok := labels[label]
+		if !ok {
+			return Program{}, fmt.Errorf("unknown label '%s'", label)
+		}
+		instructions[pc].target = target
+	}
+
+	return Program{instructions}, nil
+}
+
+// Execute runs the program until it stops, fails or exhausts its gas. Returns the gas used.
+func Execute(program Program, ctx Context, host Host, gasLimit uint64) (uint64, error) {
+	m := &machine{ctx: ctx, host: host, stack: make([]string, 0)}
+	gasUsed := uint64(0)
+
+	for m.pc = 0; m.pc < len(program.instructions) && !m.halt; m.pc = m.next {
+		in := program.instructions[m.pc]
+		m.next = m.pc + 1
+
+		if in.op.gas > gasLimit-gasUsed {
+			return gasLimit, &OutOfGasError{gasLimit}
+		}
+		gasUsed += in.op.gas
+
+		if len(m.stack) < in.op.pops {
+			return gasUsed, fmt.Errorf("%s at instruction %d needs %d stack items, the stack has %d", in.op.name, m.pc, in.op.pops, len(m.stack))
+		}
+
+		args := make([]string, in.op.pops)
+		copy(args, m.stack[len(m.stack)-in.op.pops:])
+		m.stack = m.stack[:len(m.stack)-in.op.pops]
+
+		var err error
+		switch in.op.name {
+		case "PUSH":
+			err = m.push(in.literal)
+		case "JUMP":
+			m.next = in.target
+		case "JUMPI":
+			var cond uint64
+			cond, err = toUint(args[0])
+			if err == nil && cond != 0 {
+				m.next = in.target
+			}
+		default:
+			err = in.op.exec(m, args)
+		}
+		if err != nil {
+			return gasUsed, err
+		}
+	}
+
+	return gasUsed, nil
+}
+
+func (m *machine) push(items ...string) error {
+	for _, item := range items {
+		if len(item) > MaxItemLength {
+			return fmt.Errorf("stack item of %d bytes exceeds the %d bytes limit", len(item), MaxItemLength)
+		}
+
+		if len(m.stack) >= MaxStackDepth {
+			return fmt.Errorf("stack exceeds its %d items limit", MaxStackDepth)
+		}
+
+		m.stack = append(m.stack, item)
+	}
+
+	return nil
+}
+
+func (m *machine) pushUint(x uint64) error {
+	return m.push(strconv.FormatUint(x, 10))
+}
+
+func arithmetic(fn func(x, y uint64) (uint64, bool)) func(m *machine, a []string) error {
+	return func(m *machine, a []string) error {
+		x, err := toUint(a[0])
+		if err != nil {
+			return err
+		}
+
+		y, err := toUint(a[1])
+		if err != nil {
+			return err
+		}
+
+		result, ok := fn(x, y)
+		if !ok {
+			return fmt.Errorf("arithmetic overflow, underflow or division by zero at instruction %d", m.pc)
+		}
+
+		return m.pushUint(result)
+	}
+}
+
+func toUint(item string) (uint64, error) {
+	x, err := strconv.ParseUint(item, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a number", item)
+	}
+
+	return x, nil
+}
+
+func boolToUint(b bool) uint64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func tokenize(source string) ([]string, error) {
+	tokens := make([]string, 0)
+
+	for _, line := range strings.Split(source, "\n") {
+		for i := 0; i < len(line); {
+			switch c := line[i]; {
+			case c == '#':
+				i = len(line)
+			case c == ' ' || c == '\t' || c == '\r':
+				i++
+			case c == '"':
+				end := strings.IndexByte(line[i+1:], '"')
+				if end < 0 {
+					return nil, fmt.Errorf("unterminated string in '%s'", line)
+				}
+				tokens = append(tokens, line[i:i+end+2])
+				i += end + 2
+			default:
+				end := strings.IndexAny(line[i:], " \t\r#")
+				if end < 0 {
+					end = len(line) - i
+				}
+				tokens = append(tokens, line[i:i+end])
+				i += end
+			}
+		}
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,220 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type testHost struct {
+	storage   map[string]string
+	balances  map[string]uint64
+	transfers []string
+}
+
+func newTestHost() *testHost {
+	return &testHost{storage: make(map[string]string), balances: map[string]uint64{"split": 90}}
+}
+
+func (h *testHost) Load(key string) string {
+	return h.storage[key]
+}
+
+func (h *testHost) Store(key string, value string) error {
+	h.storage[key] = value
+
+	return nil
+}
+
+func (h *testHost) Balance(account string) uint64 {
+	return h.balances[account]
+}
+
+func (h *testHost) Transfer(to string, amount uint64) error {
+	if amount > h.balances["split"] {
+		return fmt.Errorf("insufficient balance")
+	}
+
+	h.balances["split"] -= amount
+	h.balances[to] += amount
+	h.transfers = append(h.transfers, fmt.Sprintf("%s:%d", to, amount))
+
+	return nil
+}
+
+func TestParseRejectsInvalidScripts(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{"unknown opcode", "1 2 PLUS", "unknown opcode 'PLUS'"},
+		{"unknown label", "JUMP nowhere", "unknown label 'nowhere'"},
+		{"duplicate label", ":a :a STOP", "duplicate label ':a'"},
+		{"empty label", ": STOP", "duplicate label ':'"},
+		{"jump without label", "1 JUMPI", "JUMPI requires a label"},
+		{"unterminated string", "\"abc", "unterminated string"},
+		{"invalid number", "12a", "'12a' is not a number"},
+		{"number overflow", "18446744073709551616", "is not a number"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.source)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: Parse(%q) returned '%v', expected an error containing '%s'", test.name, test.source, err, test.err)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		args     []string
+		expected string
+		gasUsed  uint64
+	}{
+		{"arithmetic", `"r" 2 3 ADD 4 MUL 5 SUB 3 DIV 4 MOD SSTORE`, nil, "1", 1 + 1 + 1 + 2 + 1 + 3 + 1 + 2 + 1 + 3 + 1 + 3 + 100},
+		{"comparisons", `"r" 1 2 LT 2 1 GT AND 0 NOT AND SSTORE`, nil, "1", 0},
+		{"stack operations", `"r" 1 2 SWAP DROP DUP ADD SSTORE`, nil, "4", 0},
+		{"over", `"r" 7 8 OVER CONCAT CONCAT SSTORE`, nil, "787", 0},
+		{"strings and comments", "\"r\" \"a b\" # ignored\n\"#c\" CONCAT SSTORE", nil, "a b#c", 0},
+		{"equality", `"r" "x" "x" EQ SSTORE`, nil, "1", 0},
+		{"arguments", `"r" 1 ARG ARGC CONCAT SSTORE`, []string{"a", "b"}, "b2", 0},
+		{"context", `"r" CALLER SELF CONCAT VALUE CONCAT HEIGHT CONCAT SSTORE`, nil, "jrhodessplit9042", 0},
+		{"jump skips instructions", `"r" 1 JUMP end DROP 2 :end SSTORE`, nil, "1", 0},
+		{"jumpi taken", `"r" 1 1 JUMPI end DROP 2 :end SSTORE`, nil, "1", 0},
+		{"jumpi not taken", `"r" 1 0 JUMPI end DROP 2 :end SSTORE`, nil, "2", 0},
+		{"loop", "\"r\" 0\n:loop\nDUP 5 LT JUMPI inc\nSSTORE STOP\n:inc\n1 ADD JUMP loop", nil, "5", 0},
+		{"stop halts", `"r" 1 SSTORE STOP "r" 2 SSTORE`, nil, "1", 0},
+		{"storage round trip", `"k" "v" SSTORE "r" "k" SLOAD SSTORE`, nil, "v", 0},
+		{"balance", `"r" "split" BALANCE SSTORE`, nil, "90", 0},
+		{"verify passes", `"r" 1 VERIFY 1 SSTORE`, nil, "1", 0},
+	}
+
+	for _, test := range tests {
+		program, err := Parse(test.source)
+		if err != nil {
+			t.Errorf("%s: Parse failed: %s", test.name, err)
+			continue
+		}
+
+		host := newTestHost()
+		ctx := Context{Caller: "jrhodes", Self: "split", Value: 90, Height: 42, Args: test.args}
+		gasUsed, err := Execute(program, ctx, host, 10000)
+		if err != nil {
+			t.Errorf("%s: Execute failed: %s", test.name, err)
+			continue
+		}
+
+		if host.storage["r"] != test.expected {
+			t.Errorf("%s: stored '%s', expected '%s'", test.name, host.storage["r"], test.expected)
+		}
+
+		if test.gasUsed != 0 && gasUsed != test.gasUsed {
+			t.Errorf("%s: used %d gas, expected %d", test.name, gasUsed, test.gasUsed)
+		}
+	}
+}
+
+func TestExecuteFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		gasLimit uint64
+		err      string
+	}{
+		{"stack underflow", "1 ADD", 100, "ADD at instruction 1 needs 2 stack items, the stack has 1"},
+		{"stack underflow on empty stack", "DROP", 100, "DROP at instruction 0 needs 1 stack items, the stack has 0"},
+		{"stack overflow", ":loop 1 JUMP loop", 100000, "stack exceeds its 256 items limit"},
+		{"item too long", "\"aaaaaaaaaaaaaaaa\"\n:loop\nDUP CONCAT JUMP loop", 100000, "exceeds the 256 bytes limit"},
+		{"addition overflow", "18446744073709551615 1 ADD", 100, "arithmetic overflow"},
+		{"multiplication overflow", "4294967296 4294967296 MUL", 100, "arithmetic overflow"},
+		{"subtraction underflow", "1 2 SUB", 100, "underflow"},
+		{"division by zero", "1 0 DIV", 100, "division by zero"},
+		{"modulo by zero", "1 0 MOD", 100, "division by zero"},
+		{"not a number", "\"x\" 1 ADD", 100, "'x' is not a number"},
+		{"missing argument", "0 ARG", 100, "script reads argument 0, the TX has 0"},
+		{"verification", "0 VERIFY", 100, "script verification failed at instruction 1"},
+		{"revert", "1 REVERT", 100, "script reverted at instruction 1"},
+		{"failed transfer", "\"meads\" 91 TRANSFER", 1000, "insufficient balance"},
+	}
+
+	for _, test := range tests {
+		program, err := Parse(test.source)
+		if err != nil {
+			t.Errorf("%s: Parse failed: %s", test.name, err)
+			continue
+		}
+
+		_, err = Execute(program, Context{Self: "split"}, newTestHost(), test.gasLimit)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: Execute returned '%v', expected an error containing '%s'", test.name, err, test.err)
+		}
+	}
+}
+
+func TestExecuteRunsOutOfGas(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		gasLimit uint64
+	}{
+		{"no gas", "1", 0},
+		{"infinite loop", ":loop JUMP loop", 1000},
+		{"expensive opcode", "\"k\" \"v\" SSTORE", 101},
+	}
+
+	for _, test := range tests {
+		program, err := Parse(test.source)
+		if err != nil {
+			t.Errorf("%s: Parse failed: %s", test.name, err)
+			continue
+		}
+
+		host := newTestHost()
+		gasUsed, err := Execute(program, Context{}, host, test.gasLimit)
+		if _, ok := err.(*OutOfGasError); !ok {
+			t.Errorf("%s: Execute returned '%v', expected an out of gas error", test.name, err)
+			continue
+		}
+
+		if gasUsed != test.gasLimit {
+			t.Errorf("%s: used %d gas, a script running out of gas uses its whole limit of %d", test.name, gasUsed, test.gasLimit)
+		}
+
+		if len(host.storage) > 0 {
+			t.Errorf("%s: the instruction running out of gas must not execute", test.name)
+		}
+	}
+}
+
+func TestExecuteSplitsTheValue(t *testing.T) {
+	source := `
+		# split.tbbs: sends an equal share of the value to every argument
+		0
+		:loop
+		DUP ARGC LT JUMPI pay
+		STOP
+		:pay
+		DUP ARG VALUE ARGC DIV TRANSFER
+		1 ADD
+		JUMP loop`
+
+	program, err := Parse(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := newTestHost()
+	ctx := Context{Caller: "jrhodes", Self: "split", Value: 90, Args: []string{"meads", "lhendricks", "babayaga"}}
+	_, err = Execute(program, ctx, host, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "meads:30 lhendricks:30 babayaga:30"
+	if transfers := strings.Join(host.transfers, " "); transfers != expected {
+		t.Errorf("transfers are '%s', expected '%s'", transfers, expected)
+	}
+}